@@ -0,0 +1,177 @@
+package psqlfront
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	// AccessActionAllow allows the users of the rule to access the tables.
+	AccessActionAllow = "allow"
+	// AccessActionDeny denies the users of the rule to access the tables.
+	AccessActionDeny = "deny"
+)
+
+// systemSchemas are always accessible, because the clients such as psql and BI tools need them to list the tables.
+var systemSchemas = []string{"pg_catalog", "information_schema"}
+
+// AccessControl decides whether the user can access the table by the rules.
+// The rules are evaluated in order, the first rule that matches both the user and the table decides.
+// If no rule matches, the access is denied.
+type AccessControl struct {
+	groups map[string][]string
+	rules  []*accessRule
+}
+
+type accessRule struct {
+	users  []string
+	groups []string
+	tables []tablePattern
+	allow  bool
+}
+
+type tablePattern struct {
+	schema string
+	table  string
+}
+
+// NewAccessControl returns AccessControl of the config.
+func NewAccessControl(cfg *AccessControlConfig) (*AccessControl, error) {
+	ac := &AccessControl{
+		groups: make(map[string][]string),
+		rules:  make([]*accessRule, 0, len(cfg.Rules)),
+	}
+	for group, users := range cfg.Groups {
+		for _, user := range users {
+			ac.groups[user] = append(ac.groups[user], group)
+		}
+	}
+	for i, ruleCfg := range cfg.Rules {
+		if len(ruleCfg.Users) == 0 && len(ruleCfg.Groups) == 0 {
+			return nil, fmt.Errorf("rules[%d]: users or groups is required", i)
+		}
+		for _, group := range ruleCfg.Groups {
+			if _, ok := cfg.Groups[group]; !ok {
+				return nil, fmt.Errorf("rules[%d]: group `%s` is not defined", i, group)
+			}
+		}
+		if len(ruleCfg.Tables) == 0 {
+			return nil, fmt.Errorf("rules[%d]: tables is required", i)
+		}
+		rule := &accessRule{
+			users:  ruleCfg.Users,
+			groups: ruleCfg.Groups,
+		}
+		switch ruleCfg.Action {
+		case "", AccessActionAllow:
+			rule.allow = true
+		case AccessActionDeny:
+		default:
+			return nil, fmt.Errorf("rules[%d]: action `%s` is invalid, must be %s or %s", i, ruleCfg.Action, AccessActionAllow, AccessActionDeny)
+		}
+		for _, str := range ruleCfg.Tables {
+			pattern, err := parseTablePattern(str)
+			if err != nil {
+				return nil, fmt.Errorf("rules[%d]: %w", i, err)
+			}
+			rule.tables = append(rule.tables, pattern)
+		}
+		ac.rules = append(ac.rules, rule)
+	}
+	return ac, nil
+}
+
+// parseTablePattern parses `<schema>.<table>` or `*`, both parts can have the wildcards of path.Match.
+func parseTablePattern(str string) (tablePattern, error) {
+	if str == "*" {
+		return tablePattern{schema: "*", table: "*"}, nil
+	}
+	schema, table, ok := strings.Cut(str, ".")
+	if !ok {
+		return tablePattern{}, fmt.Errorf("table pattern `%s` must be `<schema>.<table>` or `*`", str)
+	}
+	p := tablePattern{
+		schema: strings.Trim(schema, `"`),
+		table:  strings.Trim(table, `"`),
+	}
+	for _, part := range []string{p.schema, p.table} {
+		if _, err := path.Match(part, ""); err != nil {
+			return tablePattern{}, fmt.Errorf("table pattern `%s`: %w", str, err)
+		}
+	}
+	return p, nil
+}
+
+func (p tablePattern) match(table *Table) bool {
+	schemaMatched, _ := path.Match(p.schema, table.SchemaName)
+	tableMatched, _ := path.Match(p.table, table.RelName)
+	return schemaMatched && tableMatched
+}
+
+func (rule *accessRule) matchUser(user string, groups []string) bool {
+	for _, u := range rule.users {
+		if u == "*" || u == user {
+			return true
+		}
+	}
+	for _, g := range rule.groups {
+		for _, group := range groups {
+			if g == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsAllowed returns true if the user can access the table.
+func (ac *AccessControl) IsAllowed(user string, table *Table) bool {
+	for _, schema := range systemSchemas {
+		if table.SchemaName == schema {
+			return true
+		}
+	}
+	groups := ac.groups[user]
+	for _, rule := range ac.rules {
+		if !rule.matchUser(user, groups) {
+			continue
+		}
+		for _, pattern := range rule.tables {
+			if pattern.match(table) {
+				return rule.allow
+			}
+		}
+	}
+	return false
+}
+
+// Check returns QueryRejectedError of 42501 insufficient_privilege if the user can not access any of the tables.
+func (ac *AccessControl) Check(user string, tables []*Table) error {
+	for _, table := range tables {
+		if !ac.IsAllowed(user, table) {
+			return &QueryRejectedError{
+				Code:    "42501",
+				Message: fmt.Sprintf("permission denied for table %s", table),
+				Detail:  fmt.Sprintf("user `%s` is not allowed by access_control of psql-front", user),
+			}
+		}
+	}
+	return nil
+}
+
+var userCtxKey psqlfrontCtxKey = "__user"
+
+func withUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userCtxKey, user)
+}
+
+// GetUser returns the user of the startup message of the connection.
+func GetUser(ctx context.Context) string {
+	user, ok := ctx.Value(userCtxKey).(string)
+	if ok {
+		return user
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package psqlfront_test
+
+import (
+	"testing"
+
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessControl(t *testing.T) {
+	ac, err := psqlfront.NewAccessControl(&psqlfront.AccessControlConfig{
+		Groups: map[string][]string{
+			"hr": {"alice"},
+		},
+		Rules: []*psqlfront.AccessRuleConfig{
+			{Groups: []string{"hr"}, Tables: []string{"hr.*"}},
+			{Users: []string{"*"}, Tables: []string{"hr.*"}, Action: psqlfront.AccessActionDeny},
+			{Users: []string{"bob"}, Tables: []string{"example.hoge"}, Action: psqlfront.AccessActionDeny},
+			{Users: []string{"*"}, Tables: []string{"*"}},
+		},
+	})
+	require.NoError(t, err)
+	cases := []struct {
+		user     string
+		table    *psqlfront.Table
+		expected bool
+	}{
+		{user: "alice", table: &psqlfront.Table{SchemaName: "hr", RelName: "salary"}, expected: true},
+		{user: "bob", table: &psqlfront.Table{SchemaName: "hr", RelName: "salary"}, expected: false},
+		{user: "bob", table: &psqlfront.Table{SchemaName: "example", RelName: "hoge"}, expected: false},
+		{user: "bob", table: &psqlfront.Table{SchemaName: "example", RelName: "fuga"}, expected: true},
+		{user: "alice", table: &psqlfront.Table{SchemaName: "example", RelName: "hoge"}, expected: true},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.expected, ac.IsAllowed(c.user, c.table), "%s %s", c.user, c.table)
+	}
+
+	err = ac.Check("bob", []*psqlfront.Table{
+		{SchemaName: "pg_catalog", RelName: "pg_class"},
+		{SchemaName: "hr", RelName: "salary"},
+	})
+	var qre *psqlfront.QueryRejectedError
+	require.ErrorAs(t, err, &qre)
+	require.Equal(t, "42501", qre.Code)
+}
+
+func TestAccessControlDefaultDeny(t *testing.T) {
+	ac, err := psqlfront.NewAccessControl(&psqlfront.AccessControlConfig{
+		Rules: []*psqlfront.AccessRuleConfig{
+			{Users: []string{"alice"}, Tables: []string{"public.*"}},
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, ac.IsAllowed("alice", &psqlfront.Table{SchemaName: "public", RelName: "syukujitsu"}))
+	require.False(t, ac.IsAllowed("bob", &psqlfront.Table{SchemaName: "public", RelName: "syukujitsu"}))
+	require.True(t, ac.IsAllowed("bob", &psqlfront.Table{SchemaName: "information_schema", RelName: "tables"}))
+
+	_, err = psqlfront.NewAccessControl(&psqlfront.AccessControlConfig{
+		Rules: []*psqlfront.AccessRuleConfig{
+			{Groups: []string{"undefined"}, Tables: []string{"public.*"}},
+		},
+	})
+	require.Error(t, err)
+	_, err = psqlfront.NewAccessControl(&psqlfront.AccessControlConfig{
+		Rules: []*psqlfront.AccessRuleConfig{
+			{Users: []string{"alice"}, Tables: []string{"public"}},
+		},
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,377 @@
+package psqlfront
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgproto3/v2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// AuthMethodSCRAMSHA256 authenticates the clients by SCRAM-SHA-256.
+	AuthMethodSCRAMSHA256 = "scram-sha-256"
+	// AuthMethodMD5 authenticates the clients by md5 password.
+	AuthMethodMD5 = "md5"
+)
+
+const (
+	scramSHA256Mechanism  = "SCRAM-SHA-256"
+	scramSHA256Iterations = 4096
+)
+
+// ErrAuthenticationFailed is returned by Authenticator when the client sends a wrong password or an unknown user.
+var ErrAuthenticationFailed = errors.New("authentication failed")
+
+// Authenticator authenticates the clients by the users managed by psql-front, instead of the roles of the cache database.
+type Authenticator struct {
+	method  string
+	secrets map[string]*userSecret
+}
+
+// userSecret is the password of a user in the forms the authentication methods need.
+type userSecret struct {
+	md5   string
+	scram *scramVerifier
+}
+
+type scramVerifier struct {
+	iterations int
+	salt       []byte
+	storedKey  []byte
+	serverKey  []byte
+}
+
+// NewAuthenticator returns an Authenticator of the method for the users.
+// passwords maps the user name to a plain password, an md5 password `md5<hex>`
+// or a SCRAM-SHA-256 verifier `SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>` in the same form as pg_authid.
+func NewAuthenticator(method string, passwords map[string]string) (*Authenticator, error) {
+	if method == "" {
+		method = AuthMethodSCRAMSHA256
+	}
+	if method != AuthMethodSCRAMSHA256 && method != AuthMethodMD5 {
+		return nil, fmt.Errorf("method `%s` is invalid, must be %s or %s", method, AuthMethodSCRAMSHA256, AuthMethodMD5)
+	}
+	a := &Authenticator{
+		method:  method,
+		secrets: make(map[string]*userSecret, len(passwords)),
+	}
+	for name, password := range passwords {
+		if name == "" {
+			return nil, errors.New("user name is empty")
+		}
+		secret, err := parseUserSecret(name, password)
+		if err != nil {
+			return nil, fmt.Errorf("user `%s`: %w", name, err)
+		}
+		if method == AuthMethodMD5 && secret.md5 == "" {
+			return nil, fmt.Errorf("user `%s`: md5 method needs a plain or md5 password", name)
+		}
+		if method == AuthMethodSCRAMSHA256 && secret.scram == nil {
+			return nil, fmt.Errorf("user `%s`: scram-sha-256 method needs a plain password or a SCRAM-SHA-256 verifier", name)
+		}
+		a.secrets[name] = secret
+	}
+	return a, nil
+}
+
+// ParseUsersFile parses the htpasswd style users file, each line is `<user>:<password>`.
+// Empty lines and lines starting with `#` are ignored.
+func ParseUsersFile(src []byte) (map[string]string, error) {
+	passwords := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	var lineNo int
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, password, ok := strings.Cut(line, ":")
+		if !ok || name == "" || password == "" {
+			return nil, fmt.Errorf("line %d: must be `<user>:<password>`", lineNo)
+		}
+		if _, ok := passwords[name]; ok {
+			return nil, fmt.Errorf("line %d: user `%s` is duplicated", lineNo, name)
+		}
+		passwords[name] = password
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return passwords, nil
+}
+
+func parseUserSecret(name, password string) (*userSecret, error) {
+	if strings.HasPrefix(password, scramSHA256Mechanism+"$") {
+		verifier, err := parseSCRAMVerifier(password)
+		if err != nil {
+			return nil, err
+		}
+		return &userSecret{scram: verifier}, nil
+	}
+	if isMD5Password(password) {
+		return &userSecret{md5: password}, nil
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return &userSecret{
+		md5:   "md5" + md5Hex(password+name),
+		scram: newSCRAMVerifier(password, salt, scramSHA256Iterations),
+	}, nil
+}
+
+func isMD5Password(password string) bool {
+	if len(password) != 35 || !strings.HasPrefix(password, "md5") {
+		return false
+	}
+	_, err := hex.DecodeString(password[3:])
+	return err == nil
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func newSCRAMVerifier(password string, salt []byte, iterations int) *scramVerifier {
+	saltedPassword := pbkdf2.Key([]byte(password), salt, iterations, sha256.Size, sha256.New)
+	clientKey := hmacSHA256(saltedPassword, []byte("Client Key"))
+	storedKey := sha256.Sum256(clientKey)
+	return &scramVerifier{
+		iterations: iterations,
+		salt:       salt,
+		storedKey:  storedKey[:],
+		serverKey:  hmacSHA256(saltedPassword, []byte("Server Key")),
+	}
+}
+
+func parseSCRAMVerifier(str string) (*scramVerifier, error) {
+	invalid := errors.New("SCRAM-SHA-256 verifier must be `SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>`")
+	parts := strings.Split(str, "$")
+	if len(parts) != 3 {
+		return nil, invalid
+	}
+	iterationsStr, saltStr, ok := strings.Cut(parts[1], ":")
+	if !ok {
+		return nil, invalid
+	}
+	storedKeyStr, serverKeyStr, ok := strings.Cut(parts[2], ":")
+	if !ok {
+		return nil, invalid
+	}
+	iterations, err := strconv.Atoi(iterationsStr)
+	if err != nil || iterations <= 0 {
+		return nil, invalid
+	}
+	v := &scramVerifier{iterations: iterations}
+	for _, f := range []struct {
+		dst *[]byte
+		src string
+	}{
+		{dst: &v.salt, src: saltStr},
+		{dst: &v.storedKey, src: storedKeyStr},
+		{dst: &v.serverKey, src: serverKeyStr},
+	} {
+		*f.dst, err = base64.StdEncoding.DecodeString(f.src)
+		if err != nil {
+			return nil, invalid
+		}
+	}
+	if len(v.storedKey) != sha256.Size || len(v.serverKey) != sha256.Size {
+		return nil, invalid
+	}
+	return v, nil
+}
+
+func hmacSHA256(key, msg []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
+
+// Method returns the authentication method.
+func (a *Authenticator) Method() string {
+	return a.method
+}
+
+// Authenticate runs the authentication exchange with the client of the backend as the user.
+// It returns ErrAuthenticationFailed if the password is wrong or the user is unknown, the caller sends the ErrorResponse.
+// AuthenticationOk is not sent, because the caller sends it after connecting upstream.
+func (a *Authenticator) Authenticate(backend *pgproto3.Backend, user string) error {
+	secret := a.secrets[user]
+	if a.method == AuthMethodMD5 {
+		return a.authenticateMD5(backend, user, secret)
+	}
+	return a.authenticateSCRAM(backend, user, secret)
+}
+
+func (a *Authenticator) authenticateMD5(backend *pgproto3.Backend, user string, secret *userSecret) error {
+	var salt [4]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return err
+	}
+	if err := backend.Send(&pgproto3.AuthenticationMD5Password{Salt: salt}); err != nil {
+		return fmt.Errorf("send AuthenticationMD5Password:%w", err)
+	}
+	if err := backend.SetAuthType(pgproto3.AuthTypeMD5Password); err != nil {
+		return err
+	}
+	msg, err := backend.Receive()
+	if err != nil {
+		return fmt.Errorf("receive PasswordMessage:%w", err)
+	}
+	pm, ok := msg.(*pgproto3.PasswordMessage)
+	if !ok {
+		return fmt.Errorf("unexpected message %T, expected PasswordMessage", msg)
+	}
+	if secret == nil {
+		return ErrAuthenticationFailed
+	}
+	expected := "md5" + md5Hex(secret.md5[3:]+string(salt[:]))
+	if subtle.ConstantTimeCompare([]byte(pm.Password), []byte(expected)) != 1 {
+		return ErrAuthenticationFailed
+	}
+	return nil
+}
+
+func (a *Authenticator) authenticateSCRAM(backend *pgproto3.Backend, user string, secret *userSecret) error {
+	if err := backend.Send(&pgproto3.AuthenticationSASL{AuthMechanisms: []string{scramSHA256Mechanism}}); err != nil {
+		return fmt.Errorf("send AuthenticationSASL:%w", err)
+	}
+	if err := backend.SetAuthType(pgproto3.AuthTypeSASL); err != nil {
+		return err
+	}
+	msg, err := backend.Receive()
+	if err != nil {
+		return fmt.Errorf("receive SASLInitialResponse:%w", err)
+	}
+	initial, ok := msg.(*pgproto3.SASLInitialResponse)
+	if !ok {
+		return fmt.Errorf("unexpected message %T, expected SASLInitialResponse", msg)
+	}
+	if initial.AuthMechanism != scramSHA256Mechanism {
+		return fmt.Errorf("SASL mechanism `%s` is not supported", initial.AuthMechanism)
+	}
+	gs2Header, clientFirstBare, clientNonce, err := parseSCRAMClientFirst(string(initial.Data))
+	if err != nil {
+		return err
+	}
+	verifier := secret.scramVerifier()
+	if verifier == nil {
+		// the unknown user continues the exchange with a random verifier, so that it can not be told from a wrong password.
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		verifier = newSCRAMVerifier(user, salt, scramSHA256Iterations)
+	}
+	nonce := make([]byte, 18)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	serverNonce := clientNonce + base64.StdEncoding.EncodeToString(nonce)
+	serverFirst := fmt.Sprintf("r=%s,s=%s,i=%d", serverNonce, base64.StdEncoding.EncodeToString(verifier.salt), verifier.iterations)
+	if err := backend.Send(&pgproto3.AuthenticationSASLContinue{Data: []byte(serverFirst)}); err != nil {
+		return fmt.Errorf("send AuthenticationSASLContinue:%w", err)
+	}
+	if err := backend.SetAuthType(pgproto3.AuthTypeSASLContinue); err != nil {
+		return err
+	}
+	msg, err = backend.Receive()
+	if err != nil {
+		return fmt.Errorf("receive SASLResponse:%w", err)
+	}
+	resp, ok := msg.(*pgproto3.SASLResponse)
+	if !ok {
+		return fmt.Errorf("unexpected message %T, expected SASLResponse", msg)
+	}
+	clientFinal := string(resp.Data)
+	idx := strings.LastIndex(clientFinal, ",p=")
+	if idx < 0 {
+		return errors.New("SCRAM client-final-message has no proof")
+	}
+	clientFinalWithoutProof := clientFinal[:idx]
+	proof, err := base64.StdEncoding.DecodeString(clientFinal[idx+len(",p="):])
+	if err != nil || len(proof) != sha256.Size {
+		return errors.New("SCRAM client proof is invalid")
+	}
+	attrs := parseSCRAMAttributes(clientFinalWithoutProof)
+	if attrs["c"] != base64.StdEncoding.EncodeToString([]byte(gs2Header)) {
+		return errors.New("SCRAM channel binding does not match")
+	}
+	if attrs["r"] != serverNonce {
+		return errors.New("SCRAM nonce does not match")
+	}
+	authMessage := []byte(clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof)
+	clientSignature := hmacSHA256(verifier.storedKey, authMessage)
+	clientKey := make([]byte, sha256.Size)
+	for i := range clientKey {
+		clientKey[i] = proof[i] ^ clientSignature[i]
+	}
+	storedKey := sha256.Sum256(clientKey)
+	if subtle.ConstantTimeCompare(storedKey[:], verifier.storedKey) != 1 || secret == nil {
+		return ErrAuthenticationFailed
+	}
+	serverSignature := hmacSHA256(verifier.serverKey, authMessage)
+	if err := backend.Send(&pgproto3.AuthenticationSASLFinal{Data: []byte("v=" + base64.StdEncoding.EncodeToString(serverSignature))}); err != nil {
+		return fmt.Errorf("send AuthenticationSASLFinal:%w", err)
+	}
+	return nil
+}
+
+func (secret *userSecret) scramVerifier() *scramVerifier {
+	if secret == nil {
+		return nil
+	}
+	return secret.scram
+}
+
+// parseSCRAMClientFirst splits client-first-message into gs2-header and client-first-message-bare, and returns the client nonce.
+func parseSCRAMClientFirst(msg string) (gs2Header string, bare string, nonce string, err error) {
+	parts := strings.SplitN(msg, ",", 3)
+	if len(parts) != 3 {
+		return "", "", "", errors.New("SCRAM client-first-message is invalid")
+	}
+	switch {
+	case parts[0] == "n", parts[0] == "y":
+	case strings.HasPrefix(parts[0], "p="):
+		return "", "", "", errors.New("SCRAM channel binding is not supported")
+	default:
+		return "", "", "", errors.New("SCRAM gs2-header is invalid")
+	}
+	gs2Header = parts[0] + "," + parts[1] + ","
+	bare = parts[2]
+	nonce = parseSCRAMAttributes(bare)["r"]
+	if nonce == "" {
+		return "", "", "", errors.New("SCRAM client nonce is empty")
+	}
+	return gs2Header, bare, nonce, nil
+}
+
+func parseSCRAMAttributes(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, attr := range strings.Split(msg, ",") {
+		key, value, ok := strings.Cut(attr, "=")
+		if !ok {
+			continue
+		}
+		if _, exists := attrs[key]; !exists {
+			attrs[key] = value
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,118 @@
+package psqlfront_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticator(t *testing.T) {
+	passwords := map[string]string{
+		"alice": "alice-password",
+		"bob":   "md58f1147f2f7926449f25de748409f6ec2",
+		// SCRAM-SHA-256 verifier of `carol-password`
+		"carol": "SCRAM-SHA-256$4096:c2FsdHNhbHRzYWx0c2FsdA==$cSw7gTL/MnaWbJh2EnDMH6YG+Vw2kKfwwTVSJrSTppE=:/5OsaRIlQG2EoCmUdA91v6S1NmOR2lD113bjcHk62m0=",
+	}
+	cases := []struct {
+		method   string
+		user     string
+		password string
+		expected bool
+	}{
+		{method: psqlfront.AuthMethodSCRAMSHA256, user: "alice", password: "alice-password", expected: true},
+		{method: psqlfront.AuthMethodSCRAMSHA256, user: "alice", password: "wrong", expected: false},
+		{method: psqlfront.AuthMethodSCRAMSHA256, user: "carol", password: "carol-password", expected: true},
+		{method: psqlfront.AuthMethodSCRAMSHA256, user: "carol", password: "wrong", expected: false},
+		{method: psqlfront.AuthMethodSCRAMSHA256, user: "unknown", password: "alice-password", expected: false},
+		{method: psqlfront.AuthMethodMD5, user: "alice", password: "alice-password", expected: true},
+		{method: psqlfront.AuthMethodMD5, user: "alice", password: "wrong", expected: false},
+		{method: psqlfront.AuthMethodMD5, user: "bob", password: "bob-password", expected: true},
+		{method: psqlfront.AuthMethodMD5, user: "unknown", password: "alice-password", expected: false},
+	}
+	for _, c := range cases {
+		t.Run(c.method+"/"+c.user+"/"+c.password, func(t *testing.T) {
+			users := make(map[string]string)
+			for name, password := range passwords {
+				if c.method == psqlfront.AuthMethodMD5 && name == "carol" {
+					continue
+				}
+				if c.method == psqlfront.AuthMethodSCRAMSHA256 && name == "bob" {
+					continue
+				}
+				users[name] = password
+			}
+			authenticator, err := psqlfront.NewAuthenticator(c.method, users)
+			require.NoError(t, err)
+			err = connectWithAuthenticator(t, authenticator, c.user, c.password)
+			if c.expected {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func connectWithAuthenticator(t *testing.T, authenticator *psqlfront.Authenticator, user, password string) error {
+	t.Helper()
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		backend := pgproto3.NewBackend(pgproto3.NewChunkReader(server), server)
+		msg, err := backend.ReceiveStartupMessage()
+		if err != nil {
+			return
+		}
+		sm := msg.(*pgproto3.StartupMessage)
+		if err := authenticator.Authenticate(backend, sm.Parameters["user"]); err != nil {
+			backend.Send(&pgproto3.ErrorResponse{Severity: "FATAL", Code: "28P01", Message: err.Error()})
+			return
+		}
+		backend.Send(&pgproto3.AuthenticationOk{})
+		backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	}()
+	cfg, err := pgconn.ParseConfig("sslmode=disable")
+	require.NoError(t, err)
+	cfg.User = user
+	cfg.Password = password
+	cfg.LookupFunc = func(_ context.Context, host string) ([]string, error) {
+		return []string{host}, nil
+	}
+	cfg.DialFunc = func(_ context.Context, _, _ string) (net.Conn, error) {
+		return client, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = pgconn.ConnectConfig(ctx, cfg)
+	return err
+}
+
+func TestNewAuthenticatorInvalid(t *testing.T) {
+	_, err := psqlfront.NewAuthenticator("password", map[string]string{"alice": "alice-password"})
+	require.Error(t, err)
+	_, err = psqlfront.NewAuthenticator(psqlfront.AuthMethodMD5, map[string]string{"carol": "SCRAM-SHA-256$4096:c2FsdA==$AAAA:AAAA"})
+	require.Error(t, err)
+	_, err = psqlfront.NewAuthenticator(psqlfront.AuthMethodSCRAMSHA256, map[string]string{"bob": "md58f1147f2f7926449f25de748409f6ec2"})
+	require.Error(t, err)
+}
+
+func TestParseUsersFile(t *testing.T) {
+	passwords, err := psqlfront.ParseUsersFile([]byte("# analysts\nalice:alice-password\n\nbob:md58f1147f2f7926449f25de748409f6ec2\n"))
+	require.NoError(t, err)
+	require.EqualValues(t, map[string]string{
+		"alice": "alice-password",
+		"bob":   "md58f1147f2f7926449f25de748409f6ec2",
+	}, passwords)
+
+	_, err = psqlfront.ParseUsersFile([]byte("alice\n"))
+	require.Error(t, err)
+	_, err = psqlfront.ParseUsersFile([]byte("alice:a\nalice:b\n"))
+	require.Error(t, err)
+}
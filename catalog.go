@@ -0,0 +1,95 @@
+package psqlfront
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/samber/lo"
+)
+
+// resolveRelationsSQL returns the relations of the name, and the relations the views of them depend on recursively.
+// If $1 is empty, the relations of the name in all schemas except the temporary ones are returned.
+const resolveRelationsSQL = `WITH RECURSIVE rels(oid) AS (
+    SELECT c.oid FROM pg_catalog.pg_class c JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+    WHERE c.relname = $2::text AND ($1::text = '' OR n.nspname = $1::text) AND n.nspname NOT LIKE 'pg\_temp\_%' AND n.nspname NOT LIKE 'pg\_toast%'
+    UNION
+    SELECT d.refobjid FROM rels
+    JOIN pg_catalog.pg_rewrite r ON r.ev_class = rels.oid
+    JOIN pg_catalog.pg_depend d ON d.classid = 'pg_catalog.pg_rewrite'::regclass AND d.objid = r.oid
+        AND d.refclassid = 'pg_catalog.pg_class'::regclass AND d.refobjid <> rels.oid
+)
+SELECT n.nspname, c.relname FROM rels
+JOIN pg_catalog.pg_class c ON c.oid = rels.oid
+JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace`
+
+// resolveFunctionsSQL returns the functions of the name except the ones of the system schemas and the extensions.
+// If $1 is empty, the functions of the name in all schemas are returned.
+const resolveFunctionsSQL = `SELECT DISTINCT n.nspname, p.proname FROM pg_catalog.pg_proc p
+JOIN pg_catalog.pg_namespace n ON n.oid = p.pronamespace
+WHERE p.proname = $2::text AND ($1::text = '' OR n.nspname = $1::text) AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+AND NOT EXISTS (
+    SELECT 1 FROM pg_catalog.pg_depend d
+    WHERE d.classid = 'pg_catalog.pg_proc'::regclass AND d.objid = p.oid AND d.deptype = 'e'
+)`
+
+// resolveRelations returns the relations the names may refer to, with the relations the views of them depend on.
+// The unqualified name is resolved by search_path of the session, which the client can change by SET, set_config() or the startup options,
+// so it is resolved to the relations of the name in all schemas. The name of no relation is resolved to public, the default of search_path.
+func (server *Server) resolveRelations(ctx context.Context, names []*Table) ([]*Table, error) {
+	resolved := make([]*Table, 0, len(names))
+	for _, name := range names {
+		tables, err := server.queryCatalog(ctx, resolveRelationsSQL, name)
+		if err != nil {
+			return nil, fmt.Errorf("resolve relation `%s`:%w", name.RelName, err)
+		}
+		if len(tables) == 0 {
+			table := *name
+			if table.SchemaName == "" {
+				table.SchemaName = "public"
+			}
+			tables = append(tables, &table)
+		}
+		resolved = append(resolved, tables...)
+	}
+	return lo.UniqBy(resolved, func(t *Table) string {
+		return t.String()
+	}), nil
+}
+
+// resolveFunctions returns the functions the names may refer to, which are defined in the cache database by the users.
+// The functions of the system schemas and the extensions are not returned.
+func (server *Server) resolveFunctions(ctx context.Context, names []*Table) ([]*Table, error) {
+	resolved := make([]*Table, 0)
+	for _, name := range names {
+		if name.SchemaName != "" && lo.Contains(systemSchemas, name.SchemaName) {
+			continue
+		}
+		functions, err := server.queryCatalog(ctx, resolveFunctionsSQL, name)
+		if err != nil {
+			return nil, fmt.Errorf("resolve function `%s`:%w", name.RelName, err)
+		}
+		resolved = append(resolved, functions...)
+	}
+	return lo.UniqBy(resolved, func(t *Table) string {
+		return t.String()
+	}), nil
+}
+
+func (server *Server) queryCatalog(ctx context.Context, sql string, name *Table) ([]*Table, error) {
+	log.Printf("[debug][%s] execute: %s; [%s %s]", GetRemoteAddr(ctx), sql, name.SchemaName, name.RelName)
+	rows, err := server.db.Query(ctx, sql, name.SchemaName, name.RelName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	objects := make([]*Table, 0)
+	for rows.Next() {
+		var object Table
+		if err := rows.Scan(&object.SchemaName, &object.RelName); err != nil {
+			return nil, fmt.Errorf("row scan: %w", err)
+		}
+		objects = append(objects, &object)
+	}
+	return objects, rows.Err()
+}
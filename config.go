@@ -3,6 +3,7 @@ package psqlfront
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -24,12 +25,18 @@ import (
 type Config struct {
 	RequiredVersion string `yaml:"required_version,omitempty"`
 
-	CacheDatabase *CacheDatabaseConfig  `yaml:"cache_database,omitempty"`
-	Certificates  []*CertificateConfig  `yaml:"certificates,omitempty"`
-	DefaultTTL    time.Duration         `yaml:"default_ttl,omitempty"`
-	Origins       []*CommonOriginConfig `yaml:"origins,omitempty"`
+	CacheDatabase       *CacheDatabaseConfig  `yaml:"cache_database,omitempty"`
+	Certificates        []*CertificateConfig  `yaml:"certificates,omitempty"`
+	Authentication      *AuthenticationConfig `yaml:"authentication,omitempty"`
+	AccessControl       *AccessControlConfig  `yaml:"access_control,omitempty"`
+	ReadOnly            *ReadOnlyConfig       `yaml:"read_only,omitempty"`
+	Pool                *PoolConfig           `yaml:"pool,omitempty"`
+	DefaultTTL          time.Duration         `yaml:"default_ttl,omitempty"`
+	DefaultMaxStaleness *time.Duration        `yaml:"default_max_staleness,omitempty"`
+	Origins             []*CommonOriginConfig `yaml:"origins,omitempty"`
 
 	InitialFetch         bool           `yaml:"initial_fetch,omitempty"`
+	LoadMethod           string         `yaml:"load_method,omitempty"`
 	IdleTimeout          *time.Duration `yaml:"idle_timeout,omitempty"`
 	CacheControllTimeout *time.Duration `yaml:"cache_controll_timeout,omitempty"`
 
@@ -38,6 +45,13 @@ type Config struct {
 	versionConstraints gv.Constraints `yaml:"-,omitempty"`
 }
 
+const (
+	// LoadMethodCopy loads the rows into the cache table by binary COPY, and falls back to INSERT if the values need coercion.
+	LoadMethodCopy = "copy"
+	// LoadMethodInsert loads the rows by multi-row INSERT.
+	LoadMethodInsert = "insert"
+)
+
 func PtrValue[T any](t T) *T {
 	return &t
 }
@@ -57,6 +71,7 @@ func DefaultConfig() *Config {
 			Enabled:            PtrValue(true),
 			MonitoringInterval: 30 * time.Second,
 		},
+		LoadMethod:           LoadMethodCopy,
 		IdleTimeout:          PtrValue(600 * time.Second),
 		CacheControllTimeout: PtrValue(60 * time.Second),
 	}
@@ -103,10 +118,42 @@ func (cfg *Config) Restrict() error {
 		cfg.Certificates[i].certificate = certificate
 	}
 
+	if cfg.Authentication != nil {
+		if err := cfg.Authentication.Restrict(cfg.CacheDatabase); err != nil {
+			return fmt.Errorf("authentication: %w", err)
+		}
+	}
+
+	if cfg.Pool != nil {
+		if cfg.Authentication == nil {
+			return errors.New("pool: authentication is required, because the pooled connections are authenticated by the service credential")
+		}
+		if err := cfg.Pool.Restrict(); err != nil {
+			return fmt.Errorf("pool: %w", err)
+		}
+	}
+
+	if cfg.AccessControl != nil {
+		if err := cfg.AccessControl.Restrict(); err != nil {
+			return fmt.Errorf("access_control: %w", err)
+		}
+	}
+
+	switch cfg.LoadMethod {
+	case "":
+		cfg.LoadMethod = LoadMethodCopy
+	case LoadMethodCopy, LoadMethodInsert:
+	default:
+		return fmt.Errorf("load_method `%s` is invalid, must be %s or %s", cfg.LoadMethod, LoadMethodCopy, LoadMethodInsert)
+	}
+
 	for i, originCfg := range cfg.Origins {
 		if originCfg.TTL == nil {
 			originCfg.TTL = &cfg.DefaultTTL
 		}
+		if originCfg.MaxStaleness == nil {
+			originCfg.MaxStaleness = cfg.DefaultMaxStaleness
+		}
 		if err := originCfg.Ristrict(); err != nil {
 			return fmt.Errorf("origins[%d]:%w", i, err)
 		}
@@ -156,6 +203,8 @@ type CacheDatabaseConfig struct {
 	Port     int    `yaml:"port,omitempty"`
 	Database string `yaml:"database,omitempty"`
 	SSLMode  string `yaml:"ssl_mode,omitempty"`
+	// SSLRootCert is the path of the CA certificates to verify the server certificate on ssl_mode verify-ca or verify-full.
+	SSLRootCert string `yaml:"ssl_root_cert,omitempty"`
 }
 
 func (cfg *CacheDatabaseConfig) DSN() string {
@@ -167,8 +216,15 @@ func (cfg *CacheDatabaseConfig) DSN() string {
 		cfg.Port,
 		cfg.Database,
 	)
+	params := url.Values{}
 	if cfg.SSLMode != "" {
-		dsn += fmt.Sprintf("?sslmode=%s", cfg.SSLMode)
+		params.Set("sslmode", cfg.SSLMode)
+	}
+	if cfg.SSLRootCert != "" {
+		params.Set("sslrootcert", cfg.SSLRootCert)
+	}
+	if len(params) > 0 {
+		dsn += "?" + params.Encode()
 	}
 	return dsn
 }
@@ -189,6 +245,59 @@ func (cfg *StatsConfig) enabled() bool {
 	return *cfg.Enabled
 }
 
+// PoolConfig enables the pooling of the upstream connections.
+type PoolConfig struct {
+	Mode         string         `yaml:"mode,omitempty"`
+	Size         int            `yaml:"size,omitempty"`
+	QueueTimeout *time.Duration `yaml:"queue_timeout,omitempty"`
+	MaxQueue     int            `yaml:"max_queue,omitempty"`
+}
+
+func (cfg *PoolConfig) Restrict() error {
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = PoolModeSession
+	case PoolModeSession, PoolModeTransaction:
+	default:
+		return fmt.Errorf("mode `%s` is invalid, must be %s or %s", cfg.Mode, PoolModeSession, PoolModeTransaction)
+	}
+	if cfg.Size == 0 {
+		cfg.Size = 10
+	}
+	if cfg.Size < 0 {
+		return errors.New("size must be positive")
+	}
+	if cfg.QueueTimeout == nil {
+		cfg.QueueTimeout = PtrValue(30 * time.Second)
+	}
+	if *cfg.QueueTimeout < 0 {
+		return errors.New("queue_timeout must not be negative")
+	}
+	if cfg.MaxQueue < 0 {
+		return errors.New("max_queue must not be negative")
+	}
+	return nil
+}
+
+// ReadOnlyConfig protects the tables managed by psql-front and psqlfront schema from the writes and DDL of the clients.
+// It is enabled by default, and admin_users can modify them.
+// RejectProceduralCode rejects DO and CREATE FUNCTION, because their procedural code can not be inspected.
+type ReadOnlyConfig struct {
+	Enabled              *bool    `yaml:"enabled,omitempty"`
+	AdminUsers           []string `yaml:"admin_users,omitempty"`
+	RejectProceduralCode bool     `yaml:"reject_procedural_code,omitempty"`
+}
+
+func (cfg *ReadOnlyConfig) enabled() bool {
+	if cfg == nil {
+		return true
+	}
+	if cfg.Enabled == nil {
+		return true
+	}
+	return *cfg.Enabled
+}
+
 type CertificateConfig struct {
 	Cert string `yaml:"cert,omitempty"`
 	Key  string `yaml:"key,omitempty"`
@@ -196,6 +305,107 @@ type CertificateConfig struct {
 	certificate tls.Certificate
 }
 
+// AuthenticationConfig enables psql-front to authenticate the clients by its own users,
+// and to connect upstream with the service credential instead of the client's.
+type AuthenticationConfig struct {
+	Method    string                    `yaml:"method,omitempty"`
+	Users     []*UserConfig             `yaml:"users,omitempty"`
+	UsersFile string                    `yaml:"users_file,omitempty"`
+	Upstream  *UpstreamCredentialConfig `yaml:"upstream,omitempty"`
+
+	authenticator *Authenticator
+}
+
+type UserConfig struct {
+	Name     string `yaml:"name,omitempty"`
+	Password string `yaml:"password,omitempty"`
+}
+
+// UpstreamCredentialConfig is the service credential to connect upstream, defaults to the credential of cache_database.
+type UpstreamCredentialConfig struct {
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	Database string `yaml:"database,omitempty"`
+}
+
+func (cfg *AuthenticationConfig) Restrict(cacheDatabase *CacheDatabaseConfig) error {
+	passwords := make(map[string]string, len(cfg.Users))
+	if cfg.UsersFile != "" {
+		src, err := loadSrcFrom(cfg.UsersFile)
+		if err != nil {
+			return fmt.Errorf("users_file can not load:%w", err)
+		}
+		passwords, err = ParseUsersFile(src)
+		if err != nil {
+			return fmt.Errorf("users_file: %w", err)
+		}
+	}
+	for i, user := range cfg.Users {
+		if user.Name == "" {
+			return fmt.Errorf("users[%d]: name is required", i)
+		}
+		if user.Password == "" {
+			return fmt.Errorf("users[%d]: password is required", i)
+		}
+		if _, ok := passwords[user.Name]; ok {
+			return fmt.Errorf("users[%d]: user `%s` is duplicated", i, user.Name)
+		}
+		passwords[user.Name] = user.Password
+	}
+	if len(passwords) == 0 {
+		return errors.New("users or users_file is required")
+	}
+	authenticator, err := NewAuthenticator(cfg.Method, passwords)
+	if err != nil {
+		return err
+	}
+	cfg.Method = authenticator.Method()
+	cfg.authenticator = authenticator
+	if cfg.Upstream == nil {
+		cfg.Upstream = &UpstreamCredentialConfig{}
+	}
+	if cfg.Upstream.Username == "" && cacheDatabase != nil {
+		cfg.Upstream.Username = cacheDatabase.Username
+		if cfg.Upstream.Password == "" {
+			cfg.Upstream.Password = cacheDatabase.Password
+		}
+	}
+	if cfg.Upstream.Database == "" && cacheDatabase != nil {
+		cfg.Upstream.Database = cacheDatabase.Database
+	}
+	if cfg.Upstream.Username == "" {
+		return errors.New("upstream.username is required")
+	}
+	return nil
+}
+
+// AccessControlConfig is the rules which users and groups can access which schemas and tables.
+type AccessControlConfig struct {
+	Groups map[string][]string `yaml:"groups,omitempty"`
+	Rules  []*AccessRuleConfig `yaml:"rules,omitempty"`
+
+	accessControl *AccessControl
+}
+
+type AccessRuleConfig struct {
+	Users  []string `yaml:"users,omitempty"`
+	Groups []string `yaml:"groups,omitempty"`
+	Tables []string `yaml:"tables,omitempty"`
+	Action string   `yaml:"action,omitempty"`
+}
+
+func (cfg *AccessControlConfig) Restrict() error {
+	if len(cfg.Rules) == 0 {
+		return errors.New("rules is required")
+	}
+	ac, err := NewAccessControl(cfg)
+	if err != nil {
+		return err
+	}
+	cfg.accessControl = ac
+	return nil
+}
+
 func loadSrcFrom(path string) ([]byte, error) {
 	u, err := url.Parse(path)
 	if err != nil {
@@ -0,0 +1,137 @@
+package psqlfront
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/samber/lo"
+)
+
+// canCopyBinary returns true if the rows can be loaded by binary COPY without coercion by the cache database.
+// The text values for the columns of the other types, such as '2022/08/11' for DATE, need the coercion.
+func (w *cacheWriter) canCopyBinary(rows [][]interface{}) bool {
+	for _, row := range rows {
+		if len(row) != len(w.table.Columns) {
+			return false
+		}
+		for i, v := range row {
+			if v == nil {
+				continue
+			}
+			_, isString := v.(string)
+			if isString != w.table.Columns[i].IsTextType() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// copyRowsBinary loads the rows by binary COPY, the values are encoded by the types of the columns.
+func (w *cacheWriter) copyRowsBinary(ctx context.Context, rows [][]interface{}) error {
+	target := w.table
+	copyFrom := w.tx.CopyFrom
+	if w.shadow != nil {
+		target = w.shadow
+		copyFrom = w.db.CopyFrom
+	}
+	columns := lo.Map(w.table.Columns, func(c *Column, _ int) string {
+		return strings.ToLower(c.Name)
+	})
+	log.Printf("[debug] execute: COPY %s (%s) FROM STDIN BINARY; %d rows", target, strings.Join(columns, ","), len(rows))
+	n, err := copyFrom(ctx, pgx.Identifier{target.SchemaName, target.RelName}, columns, pgx.CopyFromRows(rows))
+	if err != nil {
+		return fmt.Errorf("execute copy into `%s`:%w", target, err)
+	}
+	log.Printf("[info] %s %d rows copied", target, n)
+	return nil
+}
+
+// canCopyText returns true if all values can be encoded to the text format of COPY.
+func canCopyText(rows [][]interface{}) bool {
+	for _, row := range rows {
+		for _, v := range row {
+			if _, ok := encodeCopyText(v); !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// copyRowsText loads the rows by text COPY, the values are coerced by the cache database as well as INSERT.
+func (w *cacheWriter) copyRowsText(ctx context.Context, rows [][]interface{}) error {
+	target := w.table
+	conn := w.tx.Conn()
+	if w.shadow != nil {
+		target = w.shadow
+		c, err := w.db.Acquire(ctx)
+		if err != nil {
+			return fmt.Errorf("acquire connection:%w", err)
+		}
+		defer c.Release()
+		conn = c.Conn()
+	}
+	columns := lo.Map(w.table.Columns, func(c *Column, _ int) string {
+		return `"` + strings.ToLower(c.Name) + `"`
+	})
+	var buf bytes.Buffer
+	for _, row := range rows {
+		if len(row) != len(columns) {
+			return fmt.Errorf("expected columns %d, acutal columns %d", len(columns), len(row))
+		}
+		for i, v := range row {
+			if i > 0 {
+				buf.WriteByte('\t')
+			}
+			text, _ := encodeCopyText(v)
+			buf.WriteString(text)
+		}
+		buf.WriteByte('\n')
+	}
+	sql := fmt.Sprintf("COPY %s (%s) FROM STDIN", target, strings.Join(columns, ","))
+	log.Printf("[debug] execute: %s; %d rows", sql, len(rows))
+	tag, err := conn.PgConn().CopyFrom(ctx, &buf, sql)
+	if err != nil {
+		return fmt.Errorf("execute copy into `%s`:%w", target, err)
+	}
+	log.Printf("[info] %s %d rows copied", target, tag.RowsAffected())
+	return nil
+}
+
+var copyTextReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// encodeCopyText encodes the value to the text format of COPY, ok is false if the type is not supported.
+func encodeCopyText(v interface{}) (text string, ok bool) {
+	switch v := v.(type) {
+	case nil:
+		return `\N`, true
+	case string:
+		return copyTextReplacer.Replace(v), true
+	case int:
+		return strconv.Itoa(v), true
+	case int32:
+		return strconv.FormatInt(int64(v), 10), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		if v {
+			return "t", true
+		}
+		return "f", true
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999999Z07:00"), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,112 @@
+package e2e_test
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessControl(t *testing.T) {
+	originServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "text/csv")
+		w.WriteHeader(http.StatusOK)
+		csv.NewWriter(w).WriteAll([][]string{
+			{"ymd", "name"},
+			{"2022-08-11", "山の日"},
+		})
+	}))
+	defer originServer.Close()
+	os.Setenv("ORIGIN_SERVER_URL", originServer.URL)
+	cfg := psqlfront.DefaultConfig()
+	err := cfg.Load("testdata/config/access_control.yaml")
+	require.NoError(t, err)
+	cfg.CacheDatabase = preparePSQL(t)
+	cfg.CacheDatabase.SSLMode = "disable"
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	server, err := psqlfront.New(context.Background(), cfg)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		require.NoError(t, server.RunWithContextAndListener(ctx, listener))
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	// the objects which read the restricted table are created directly in the cache database.
+	direct, err := pgx.Connect(ctx, cfg.CacheDatabase.DSN())
+	require.NoError(t, err)
+	defer direct.Close(ctx)
+	for _, sql := range []string{
+		`CREATE OR REPLACE VIEW public.secret_view AS SELECT * FROM example_secret.hoge`,
+		`CREATE OR REPLACE FUNCTION public.secret_count() RETURNS BIGINT AS 'SELECT COUNT(*) FROM example_secret.hoge' LANGUAGE SQL`,
+	} {
+		_, err := direct.Exec(ctx, sql)
+		require.NoError(t, err)
+	}
+	defer func() {
+		direct.Exec(context.Background(), `DROP VIEW IF EXISTS public.secret_view`)
+		direct.Exec(context.Background(), `DROP FUNCTION IF EXISTS public.secret_count()`)
+	}()
+
+	var conn *pgx.Conn
+	require.Eventually(t, func() bool {
+		conn, err = pgx.Connect(ctx, fmt.Sprintf(
+			"postgres://%s:%s@%s/%s?sslmode=disable",
+			cfg.CacheDatabase.Username, cfg.CacheDatabase.Password, listener.Addr().String(), cfg.CacheDatabase.Database,
+		))
+		return err == nil
+	}, 30*time.Second, 200*time.Millisecond)
+	defer conn.Close(ctx)
+
+	var count int
+	require.NoError(t, conn.QueryRow(ctx, "SELECT COUNT(*) FROM example.hoge").Scan(&count))
+	require.Equal(t, 1, count)
+	var invalidated int64
+	require.NoError(t, conn.QueryRow(ctx, "SELECT psqlfront.invalidate('testdata')").Scan(&invalidated))
+	require.EqualValues(t, 1, invalidated)
+
+	for _, queries := range [][]string{
+		{"SELECT * FROM example_secret.hoge"},
+		{"SET search_path TO example_secret", "SELECT * FROM hoge"},
+		{"SELECT set_config('search_path', 'example_secret', false)", "SELECT * FROM hoge"},
+		{"SELECT * FROM public.secret_view"},
+		{"SELECT secret_count()"},
+		{"DO $$ BEGIN PERFORM * FROM example_secret.hoge; END $$"},
+		{"SELECT psqlfront.invalidate('testdata-secret')"},
+		{"SELECT psqlfront.invalidate('example_secret.hoge')"},
+		{"SELECT * FROM psqlfront.cache_status()"},
+	} {
+		var err error
+		for _, query := range queries {
+			if _, err = conn.Exec(ctx, query); err != nil {
+				break
+			}
+		}
+		require.ErrorContains(t, err, "42501", queries)
+		_, err = conn.Exec(ctx, "RESET search_path")
+		require.NoError(t, err)
+	}
+
+	_, err = conn.Exec(ctx, `CREATE FUNCTION public.purge_cache() RETURNS VOID AS 'DELETE FROM psqlfront.cache' LANGUAGE SQL`)
+	require.ErrorContains(t, err, "25006", "CREATE FUNCTION is rejected with reject_procedural_code")
+}
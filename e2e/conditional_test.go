@@ -0,0 +1,93 @@
+package e2e_test
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionalRequestToEmptyTable(t *testing.T) {
+	var mu sync.Mutex
+	var conditional []bool
+	originServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		conditional = append(conditional, r.Header.Get("If-None-Match") != "")
+		mu.Unlock()
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Add("Content-Type", "text/csv")
+		w.WriteHeader(http.StatusOK)
+		csv.NewWriter(w).WriteAll([][]string{
+			{"ymd", "name"},
+			{"2022-08-11", "山の日"},
+		})
+	}))
+	defer originServer.Close()
+	os.Setenv("ORIGIN_SERVER_URL", originServer.URL)
+	cfg := psqlfront.DefaultConfig()
+	err := cfg.Load("testdata/config/conditional.yaml")
+	require.NoError(t, err)
+	cfg.CacheDatabase = preparePSQL(t)
+	cfg.CacheDatabase.SSLMode = "disable"
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	server, err := psqlfront.New(context.Background(), cfg)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		require.NoError(t, server.RunWithContextAndListener(ctx, listener))
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	var conn *pgx.Conn
+	require.Eventually(t, func() bool {
+		conn, err = pgx.Connect(ctx, fmt.Sprintf(
+			"postgres://%s:%s@%s/%s?sslmode=disable",
+			cfg.CacheDatabase.Username, cfg.CacheDatabase.Password, listener.Addr().String(), cfg.CacheDatabase.Database,
+		))
+		return err == nil
+	}, 30*time.Second, 200*time.Millisecond)
+	defer conn.Close(ctx)
+
+	var count int
+	require.NoError(t, conn.QueryRow(ctx, "SELECT COUNT(*) FROM example_etag.hoge").Scan(&count))
+	require.Equal(t, 1, count)
+
+	// the cache table is emptied behind psql-front, such as recreated by the restart.
+	direct, err := pgx.Connect(ctx, cfg.CacheDatabase.DSN())
+	require.NoError(t, err)
+	defer direct.Close(ctx)
+	_, err = direct.Exec(ctx, "TRUNCATE example_etag.hoge")
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, "SELECT psqlfront.invalidate('testdata-etag')")
+	require.NoError(t, err)
+
+	require.NoError(t, conn.QueryRow(ctx, "SELECT COUNT(*) FROM example_etag.hoge").Scan(&count))
+	require.Equal(t, 1, count, "the empty table is refreshed without the validators")
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []bool{false, false}, conditional)
+}
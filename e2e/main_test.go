@@ -80,6 +80,102 @@ var serverTestCases = []serverTestCase{
 			require.EqualValues(t, expected, actual)
 		},
 	},
+	{
+		Name: "select example_swap.hoge refreshed by swap strategy",
+		TestFunc: func(t *testing.T, ctx context.Context, conn *pgx.Conn) {
+			for i := 0; i < 2; i++ {
+				_, err := conn.Exec(ctx, "SELECT psqlfront.invalidate('example_swap.hoge')")
+				require.NoError(t, err)
+				rows, err := conn.Query(ctx, "SELECT * FROM example_swap.hoge")
+				require.NoError(t, err)
+				actual := make([][]interface{}, 0)
+				for rows.Next() {
+					values, err := rows.Values()
+					require.NoError(t, err)
+					actual = append(actual, values)
+				}
+				expected := [][]interface{}{
+					{time.Date(2022, 8, 11, 0, 0, 0, 0, time.UTC), "山の日", int64(25), true},
+					{time.Date(2022, 8, 12, 0, 0, 0, 0, time.UTC), nil, nil, false},
+				}
+				require.EqualValues(t, expected, actual)
+			}
+			var shadows int
+			err := conn.QueryRow(ctx, `SELECT COUNT(*) FROM pg_tables WHERE schemaname = 'example_swap' AND tablename <> 'hoge'`).Scan(&shadows)
+			require.NoError(t, err)
+			require.Equal(t, 0, shadows, "shadow table is renamed")
+		},
+	},
+	{
+		Name: "refresh example_swap.fuga with primary key by swap strategy twice",
+		TestFunc: func(t *testing.T, ctx context.Context, conn *pgx.Conn) {
+			for i := 0; i < 2; i++ {
+				var cachedAt time.Time
+				err := conn.QueryRow(ctx, "SELECT psqlfront.refresh('example_swap.fuga')").Scan(&cachedAt)
+				require.NoError(t, err, "refresh %d", i)
+				var count int
+				err = conn.QueryRow(ctx, "SELECT COUNT(*) FROM example_swap.fuga").Scan(&count)
+				require.NoError(t, err)
+				require.Equal(t, 2, count)
+			}
+			rows, err := conn.Query(ctx, `SELECT indexname FROM pg_indexes WHERE schemaname = 'example_swap' AND tablename = 'fuga'`)
+			require.NoError(t, err)
+			indexes := make([]string, 0)
+			for rows.Next() {
+				var index string
+				require.NoError(t, rows.Scan(&index))
+				indexes = append(indexes, index)
+			}
+			require.NoError(t, rows.Err())
+			require.EqualValues(t, []string{"fuga_pkey"}, indexes, "the primary key is renamed for the table")
+		},
+	},
+	{
+		Name: "cache control functions",
+		TestFunc: func(t *testing.T, ctx context.Context, conn *pgx.Conn) {
+			var cachedAt time.Time
+			err := conn.QueryRow(ctx, "SELECT psqlfront.refresh('example.hoge')").Scan(&cachedAt)
+			require.NoError(t, err)
+			require.False(t, cachedAt.IsZero(), "refreshed")
+
+			var expired bool
+			err = conn.QueryRow(ctx, "SELECT expired FROM psqlfront.cache_status() WHERE schema_name = 'example' AND table_name = 'hoge'").Scan(&expired)
+			require.NoError(t, err)
+			require.False(t, expired)
+
+			var invalidated int64
+			err = conn.QueryRow(ctx, "SELECT psqlfront.invalidate('testdata')").Scan(&invalidated)
+			require.NoError(t, err)
+			require.NotZero(t, invalidated)
+			err = conn.QueryRow(ctx, "SELECT expired FROM psqlfront.cache_status() WHERE schema_name = 'example' AND table_name = 'hoge'").Scan(&expired)
+			require.NoError(t, err)
+			require.True(t, expired, "invalidated")
+
+			_, err = conn.Exec(ctx, "SELECT psqlfront.refresh('example.not_found')")
+			require.ErrorContains(t, err, "42P01")
+		},
+	},
+	{
+		Name: "managed tables are read only",
+		TestFunc: func(t *testing.T, ctx context.Context, conn *pgx.Conn) {
+			for _, query := range []string{
+				"DELETE FROM example.hoge",
+				"TRUNCATE psqlfront.cache",
+				"DROP SCHEMA example CASCADE",
+				"SET search_path TO psqlfront; TRUNCATE cache",
+			} {
+				_, err := conn.Exec(ctx, query)
+				require.ErrorContains(t, err, "25006", query)
+			}
+			var count int
+			err := conn.QueryRow(ctx, "SELECT COUNT(*) FROM example.hoge").Scan(&count)
+			require.NoError(t, err)
+			require.Equal(t, 2, count)
+
+			_, err = conn.Exec(ctx, "DO $$ BEGIN PERFORM 1; END $$")
+			require.NoError(t, err, "DO is allowed without reject_procedural_code")
+		},
+	},
 	{
 		Name: "trunc data",
 		TestFunc: func(t *testing.T, ctx context.Context, conn *pgx.Conn) {
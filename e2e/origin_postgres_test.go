@@ -0,0 +1,166 @@
+package e2e_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/mashiike/psql-front/origin"
+	postgresorigin "github.com/mashiike/psql-front/origin/postgres"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+type recordCacheWriter struct {
+	table     *psqlfront.Table
+	deleted   bool
+	rows      [][]interface{}
+	upserted  [][]interface{}
+	watermark string
+}
+
+func (w *recordCacheWriter) DeleteRows(_ context.Context) error {
+	w.deleted = true
+	w.rows = nil
+	return nil
+}
+
+func (w *recordCacheWriter) ReplaceCacheTable(_ context.Context, t *psqlfront.Table) error {
+	w.table = t
+	w.rows = nil
+	return nil
+}
+
+func (w *recordCacheWriter) AppendRows(_ context.Context, rows [][]interface{}) error {
+	w.rows = append(w.rows, rows...)
+	return nil
+}
+
+func (w *recordCacheWriter) AppendRowIterator(_ context.Context, iter psqlfront.RowIterator) error {
+	for iter.Next() {
+		values, err := iter.Values()
+		if err != nil {
+			return err
+		}
+		w.rows = append(w.rows, values)
+	}
+	return iter.Err()
+}
+
+func (w *recordCacheWriter) UpsertRows(_ context.Context, rows [][]interface{}) error {
+	w.upserted = append(w.upserted, rows...)
+	return nil
+}
+
+func (w *recordCacheWriter) TargetTable() *psqlfront.Table {
+	return w.table
+}
+
+func (w *recordCacheWriter) CacheValidators(_ context.Context) (*psqlfront.CacheValidators, error) {
+	return &psqlfront.CacheValidators{}, nil
+}
+
+func (w *recordCacheWriter) SetCacheValidators(_ context.Context, _ *psqlfront.CacheValidators) error {
+	return nil
+}
+
+func (w *recordCacheWriter) Watermark(_ context.Context) (string, error) {
+	return w.watermark, nil
+}
+
+func TestPostgreSQLOrigin(t *testing.T) {
+	dbCfg := preparePSQL(t)
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, dbCfg.DSN())
+	require.NoError(t, err)
+	defer conn.Close(ctx)
+	for _, sql := range []string{
+		`CREATE SCHEMA IF NOT EXISTS "origin_source"`,
+		`DROP TABLE IF EXISTS "origin_source"."sales"`,
+		`CREATE TABLE "origin_source"."sales" (id BIGINT NOT NULL, item TEXT, amount INTEGER)`,
+		`INSERT INTO "origin_source"."sales" VALUES (1, 'apple', 100), (2, 'orange', 200)`,
+	} {
+		_, err := conn.Exec(ctx, sql)
+		require.NoError(t, err)
+	}
+
+	cfg := &postgresorigin.OriginConfig{
+		Schema: "reporting",
+		DSN:    dbCfg.DSN(),
+		Tables: []*postgresorigin.TableConfig{
+			{
+				Query: `SELECT id, item, amount FROM "origin_source"."sales" ORDER BY id`,
+			},
+		},
+	}
+	cfg.Tables[0].Name = "sales"
+	require.NoError(t, cfg.Restrict())
+	o, err := cfg.NewOrigin("reporting")
+	require.NoError(t, err)
+	tables, err := o.GetTables(ctx)
+	require.NoError(t, err)
+	require.Len(t, tables, 1)
+	require.EqualValues(t, []string{"id:INT8", "item:TEXT", "amount:INT4"}, lo.Map(tables[0].Columns, func(c *psqlfront.Column, _ int) string {
+		return c.Name + ":" + c.DataType
+	}))
+
+	w := &recordCacheWriter{table: tables[0]}
+	require.NoError(t, o.RefreshCache(ctx, w))
+	require.True(t, w.deleted)
+	require.EqualValues(t, [][]interface{}{
+		{int64(1), "apple", int32(100)},
+		{int64(2), "orange", int32(200)},
+	}, w.rows)
+}
+
+func TestPostgreSQLOriginIncremental(t *testing.T) {
+	dbCfg := preparePSQL(t)
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, dbCfg.DSN())
+	require.NoError(t, err)
+	defer conn.Close(ctx)
+	for _, sql := range []string{
+		`CREATE SCHEMA IF NOT EXISTS "origin_source"`,
+		`DROP TABLE IF EXISTS "origin_source"."events"`,
+		`CREATE TABLE "origin_source"."events" (id BIGINT NOT NULL, name TEXT, updated_at TIMESTAMP NOT NULL)`,
+		`INSERT INTO "origin_source"."events" VALUES (1, 'signup', '2022-08-01 00:00:00'), (2, 'login', '2022-08-02 00:00:00'), (3, 'logout', '2022-08-03 00:00:00')`,
+	} {
+		_, err := conn.Exec(ctx, sql)
+		require.NoError(t, err)
+	}
+
+	cfg := &postgresorigin.OriginConfig{
+		Schema: "reporting",
+		DSN:    dbCfg.DSN(),
+		Tables: []*postgresorigin.TableConfig{
+			{
+				Query: `SELECT id, name, updated_at FROM "origin_source"."events" WHERE $1::timestamp IS NULL OR updated_at > $1::timestamp ORDER BY id`,
+				Incremental: &origin.IncrementalConfig{
+					KeyColumns:      []string{"id"},
+					WatermarkColumn: "updated_at",
+				},
+			},
+		},
+	}
+	cfg.Tables[0].Name = "events"
+	require.NoError(t, cfg.Restrict())
+	o, err := cfg.NewOrigin("reporting")
+	require.NoError(t, err)
+	tables, err := o.GetTables(ctx)
+	require.NoError(t, err)
+	require.Len(t, tables, 1)
+	require.True(t, tables[0].IsIncremental())
+
+	w := &recordCacheWriter{table: tables[0]}
+	require.NoError(t, o.RefreshCache(ctx, w))
+	require.True(t, w.deleted, "first refresh reloads all rows")
+	require.Len(t, w.rows, 3)
+
+	w = &recordCacheWriter{table: tables[0], watermark: "2022-08-02 00:00:00"}
+	require.NoError(t, o.RefreshCache(ctx, w))
+	require.False(t, w.deleted)
+	require.Empty(t, w.rows)
+	require.EqualValues(t, []interface{}{int64(3), "logout"}, w.upserted[0][:2], "only rows newer than watermark")
+	require.Len(t, w.upserted, 1)
+}
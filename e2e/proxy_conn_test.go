@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -162,3 +163,58 @@ func TestProxyConnIdleTimeout(t *testing.T) {
 	}
 	c.Run(t)
 }
+
+func TestProxyConnQueryRejected(t *testing.T) {
+	c := &proxyConnTestCase{
+		OnReceived: func(_ context.Context, query string, _ bool, _ psqlfront.Notifier) error {
+			if strings.Contains(query, "rejected") {
+				return &psqlfront.QueryRejectedError{
+					Code:    "42501",
+					Message: "permission denied",
+				}
+			}
+			return nil
+		},
+		TestFunc: func(t *testing.T, ctx context.Context, addr string, conn *pgx.Conn) {
+			_, err := conn.Exec(ctx, "SELECT 'rejected'")
+			require.ErrorContains(t, err, "SQLSTATE 42501")
+			_, err = conn.Exec(ctx, "SELECT 1")
+			require.NoError(t, err, "connection is usable after the rejected query")
+
+			var v int
+			err = conn.QueryRow(ctx, "SELECT $1::int, 'rejected'", 1).Scan(&v, new(string))
+			require.ErrorContains(t, err, "SQLSTATE 42501")
+			require.NoError(t, conn.QueryRow(ctx, "SELECT $1::int", 2).Scan(&v), "connection is usable after the rejected prepared statement")
+			require.Equal(t, 2, v)
+
+			_, err = conn.Exec(ctx, "CREATE TABLE IF NOT EXISTS public.proxy_conn_rejected (id INT)")
+			require.NoError(t, err)
+			defer conn.Exec(context.Background(), "DROP TABLE IF EXISTS public.proxy_conn_rejected")
+			for _, rejectedQuery := range []func() error{
+				func() error {
+					_, err := conn.Exec(ctx, "SELECT 'rejected'")
+					return err
+				},
+				func() error {
+					return conn.QueryRow(ctx, "SELECT $1::int, 'rejected'", 1).Scan(&v, new(string))
+				},
+			} {
+				_, err = conn.Exec(ctx, "BEGIN")
+				require.NoError(t, err)
+				_, err = conn.Exec(ctx, "INSERT INTO public.proxy_conn_rejected VALUES (1)")
+				require.NoError(t, err)
+				require.ErrorContains(t, rejectedQuery(), "SQLSTATE 42501")
+				require.EqualValues(t, 'E', conn.PgConn().TxStatus(), "the transaction is failed")
+				_, err = conn.Exec(ctx, "SELECT 1")
+				require.ErrorContains(t, err, "SQLSTATE 25P02", "upstream transaction is aborted")
+				tag, err := conn.Exec(ctx, "COMMIT")
+				require.NoError(t, err)
+				require.Equal(t, "ROLLBACK", tag.String())
+				var count int
+				require.NoError(t, conn.QueryRow(ctx, "SELECT COUNT(*) FROM public.proxy_conn_rejected").Scan(&count))
+				require.Equal(t, 0, count, "the rows of the failed transaction are not committed")
+			}
+		},
+	}
+	c.Run(t)
+}
@@ -0,0 +1,88 @@
+package e2e_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshWaitsForOtherRefresh(t *testing.T) {
+	requested := make(chan struct{}, 10)
+	release := make(chan struct{})
+	originServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested <- struct{}{}
+		<-release
+		http.NotFound(w, r)
+	}))
+	defer originServer.Close()
+	os.Setenv("ORIGIN_SERVER_URL", originServer.URL)
+	cfg := psqlfront.DefaultConfig()
+	err := cfg.Load("testdata/config/conditional.yaml")
+	require.NoError(t, err)
+	cfg.CacheDatabase = preparePSQL(t)
+	cfg.CacheDatabase.SSLMode = "disable"
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	server, err := psqlfront.New(context.Background(), cfg)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		require.NoError(t, server.RunWithContextAndListener(ctx, listener))
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	connect := func() *pgx.Conn {
+		var conn *pgx.Conn
+		require.Eventually(t, func() bool {
+			conn, err = pgx.Connect(ctx, fmt.Sprintf(
+				"postgres://%s:%s@%s/%s?sslmode=disable",
+				cfg.CacheDatabase.Username, cfg.CacheDatabase.Password, listener.Addr().String(), cfg.CacheDatabase.Database,
+			))
+			return err == nil
+		}, 30*time.Second, 200*time.Millisecond)
+		return conn
+	}
+	leader, waiter := connect(), connect()
+	defer leader.Close(ctx)
+	defer waiter.Close(ctx)
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err := leader.Exec(ctx, "SELECT psqlfront.refresh('example_etag.hoge')")
+		errs <- err
+	}()
+	<-requested
+	go func() {
+		_, err := waiter.Exec(ctx, "SELECT psqlfront.refresh('example_etag.hoge')")
+		errs <- err
+	}()
+	time.Sleep(500 * time.Millisecond)
+	close(release)
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			require.ErrorContains(t, err, "refresh failed", "the waiter gets the error of the running refresh")
+		case <-time.After(time.Minute):
+			t.Fatal("refresh is not finished")
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package psqlfront
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	json "github.com/goccy/go-json"
+	"github.com/jackc/pgproto3/v2"
+	pgquery "github.com/pganalyze/pg_query_go/v2"
+	"github.com/samber/lo"
+)
+
+// ErrRefreshArgument is returned by AnalyzeRefreshCalls when the argument of psqlfront.refresh() is not a string literal.
+var ErrRefreshArgument = errors.New("psqlfront.refresh() requires a string literal such as 'public.syukujitsu'")
+
+// ErrInvalidateArgument is returned by AnalyzeInvalidateCalls when the argument of psqlfront.invalidate() is not a string literal.
+var ErrInvalidateArgument = errors.New("psqlfront.invalidate() requires a string literal such as 'open_data' or 'public.syukujitsu'")
+
+// AnalyzeRefreshCalls returns the tables passed to psqlfront.refresh() in the query.
+// psqlfront.refresh() is intercepted by the proxy, and the tables are refreshed before the query is sent to the cache database.
+// psqlfront.invalidate() and psqlfront.cache_status() are the SQL functions defined in the cache database.
+func AnalyzeRefreshCalls(query string) ([]*Table, error) {
+	args, err := analyzeLiteralCalls(query, "refresh", ErrRefreshArgument)
+	if err != nil {
+		return nil, err
+	}
+	tables := lo.Map(args, func(arg string, _ int) *Table {
+		return ParseTableName(arg)
+	})
+	return lo.UniqBy(tables, func(t *Table) string {
+		return t.String()
+	}), nil
+}
+
+// AnalyzeInvalidateCalls returns the targets, the origin ids or the table names, passed to psqlfront.invalidate() in the query.
+// psqlfront.invalidate() is intercepted by the proxy to check the access control of the tables of the targets.
+func AnalyzeInvalidateCalls(query string) ([]string, error) {
+	args, err := analyzeLiteralCalls(query, "invalidate", ErrInvalidateArgument)
+	if err != nil {
+		return nil, err
+	}
+	return lo.Uniq(args), nil
+}
+
+// analyzeLiteralCalls returns the string literal arguments of psqlfront.<function>() in the query.
+// If the function is called with other than a string literal, errArgument is returned.
+func analyzeLiteralCalls(query string, function string, errArgument error) ([]string, error) {
+	if !strings.Contains(strings.ToLower(query), function) {
+		return nil, nil
+	}
+	tree, err := pgquery.ParseToJSON(query)
+	if err != nil {
+		return nil, fmt.Errorf("parse query: %w", err)
+	}
+	var obj interface{}
+	if err := json.Unmarshal([]byte(tree), &obj); err != nil {
+		return nil, err
+	}
+	funcCalls, err := findJSONValues[map[string]interface{}](obj, "FuncCall")
+	if err != nil {
+		return nil, err
+	}
+	literals := make([]string, 0)
+	for _, funcCall := range funcCalls {
+		names, err := findJSONValues[string](funcCall["funcname"], "str")
+		if err != nil {
+			return nil, err
+		}
+		if len(names) != 2 || names[0] != "psqlfront" || names[1] != function {
+			continue
+		}
+		args, ok := funcCall["args"].([]interface{})
+		if !ok || len(args) != 1 {
+			return nil, errArgument
+		}
+		aConst, ok := args[0].(map[string]interface{})["A_Const"]
+		if !ok {
+			return nil, errArgument
+		}
+		strs, err := findJSONValues[string](aConst, "str")
+		if err != nil {
+			return nil, err
+		}
+		if len(strs) != 1 {
+			return nil, errArgument
+		}
+		literals = append(literals, strs[0])
+	}
+	return literals, nil
+}
+
+// ParseTableName parses `schema.table` or `table`, the schema is public if omitted.
+func ParseTableName(name string) *Table {
+	parts := strings.SplitN(name, ".", 2)
+	for i, part := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(part), `"`)
+	}
+	if len(parts) == 1 {
+		return &Table{
+			SchemaName: "public",
+			RelName:    parts[0],
+		}
+	}
+	return &Table{
+		SchemaName: parts[0],
+		RelName:    parts[1],
+	}
+}
+
+// handleRefreshCalls refreshes the tables passed to psqlfront.refresh() regardless of the expiration.
+func (server *Server) handleRefreshCalls(ctx context.Context, tables []*Table, notifier Notifier) error {
+	remoteAddr := GetRemoteAddr(ctx)
+	for _, t := range tables {
+		table, ok := server.tables[t.String()]
+		if !ok {
+			return &QueryRejectedError{
+				Code:    "42P01",
+				Message: fmt.Sprintf("%s is not a cache table of psql-front", t),
+			}
+		}
+		log.Printf("[info][%s] %s refresh by psqlfront.refresh()", remoteAddr, table)
+		if err := server.refreshTableWithTx(ctx, ctx, table); err != nil {
+			return &QueryRejectedError{
+				Code:    "58030",
+				Message: fmt.Sprintf("%s refresh failed", table),
+				Detail:  err.Error(),
+			}
+		}
+		if err := server.analezeTables(ctx, []*Table{table}); err != nil {
+			log.Printf("[warn][%s] %s analyze after refresh failed: %v", remoteAddr, table, err)
+		}
+		notifier.Notify(ctx, &pgproto3.NoticeResponse{
+			Severity: "NOTICE",
+			Message:  fmt.Sprintf("%s refreshed", table),
+		})
+	}
+	return nil
+}
+
+// invalidateTargetTables returns the tables psqlfront.invalidate() expires by the target, the origin id or `schema.table`.
+func (server *Server) invalidateTargetTables(target string) []*Table {
+	tables := make([]*Table, 0)
+	for name, table := range server.tables {
+		if server.originIDsByTable[name] == target || table.SchemaName+"."+table.RelName == target {
+			tables = append(tables, table)
+		}
+	}
+	if strings.Contains(target, ".") {
+		// the cache of the table removed from the config is also expired.
+		tables = append(tables, ParseTableName(target))
+	}
+	return lo.UniqBy(tables, func(t *Table) string {
+		return t.String()
+	})
+}
@@ -11,9 +11,44 @@ type CacheWriter interface {
 	DeleteRows(ctx context.Context) error
 	ReplaceCacheTable(ctx context.Context, t *Table) error
 	AppendRows(context.Context, [][]interface{}) error
+	// AppendRowIterator appends all rows of the iterator, the rows are appended in bounded batches.
+	AppendRowIterator(context.Context, RowIterator) error
+	// UpsertRows inserts the rows, or updates the rows having the same KeyColumns of the target table.
+	UpsertRows(context.Context, [][]interface{}) error
 	TargetTable() *Table
+
+	// CacheValidators returns the validators saved by the previous refresh, if not saved or the table has no rows returns empty validators.
+	CacheValidators(ctx context.Context) (*CacheValidators, error)
+	// SetCacheValidators saves the validators of the current refresh for the next refresh.
+	SetCacheValidators(ctx context.Context, v *CacheValidators) error
+	// Watermark returns MAX(WatermarkColumn) saved by the previous refresh, if not saved returns empty string.
+	Watermark(ctx context.Context) (string, error)
+}
+
+// RowIterator iterates the rows to append, it has the same methods as pgx.Rows and pgx.CopyFromSource.
+type RowIterator interface {
+	// Next advances to the next row, returns false if no more rows or an error occurred.
+	Next() bool
+	// Values returns the values of the current row.
+	Values() ([]interface{}, error)
+	// Err returns the error occurred during the iteration, if any.
+	Err() error
+}
+
+// CacheValidators are the values for conditional requests to the origin, such as HTTP ETag and Last-Modified.
+type CacheValidators struct {
+	ETag         string
+	LastModified string
 }
 
+func (v *CacheValidators) IsEmpty() bool {
+	return v == nil || (v.ETag == "" && v.LastModified == "")
+}
+
+// ErrNotModified is returned by Origin.RefreshCache when the origin data is not modified since the previous refresh.
+// The cached rows are kept as is, and only the expiration is extended.
+var ErrNotModified = errors.New("origin not modified")
+
 type Origin interface {
 	ID() string
 	GetTables(ctx context.Context) ([]*Table, error)
@@ -47,10 +82,29 @@ func GetOriginConfig(typeName string) (OriginConfig, bool) {
 	return originConfigConstructor(), true
 }
 
+const (
+	// RefreshModeSync refreshes the expired table before the query is sent to the cache database.
+	RefreshModeSync = "sync"
+	// RefreshModeStaleWhileRevalidate serves the expired table immediately and refreshes it in background.
+	RefreshModeStaleWhileRevalidate = "stale_while_revalidate"
+)
+
+const (
+	// RefreshStrategyInPlace deletes and inserts the rows of the table in a transaction.
+	RefreshStrategyInPlace = "in_place"
+	// RefreshStrategySwap loads the rows into a shadow table, and swaps it with the table by RENAME at the end.
+	RefreshStrategySwap = "swap"
+)
+
 type CommonOriginConfig struct {
-	ID   string         `yaml:"id"`
-	Type string         `yaml:"type"`
-	TTL  *time.Duration `yaml:"ttl"`
+	ID              string         `yaml:"id"`
+	Type            string         `yaml:"type"`
+	TTL             *time.Duration `yaml:"ttl"`
+	MaxStaleness    *time.Duration `yaml:"max_staleness"`
+	RefreshMode     string         `yaml:"refresh_mode"`
+	RefreshStrategy string         `yaml:"refresh_strategy"`
+	// RefreshSchedule is the default refresh_schedule of the tables, see ParseRefreshSchedule.
+	RefreshSchedule string `yaml:"refresh_schedule"`
 
 	OriginConfig OriginConfig `yaml:"-"`
 }
@@ -83,6 +137,26 @@ func (cfg *CommonOriginConfig) Ristrict() error {
 	if cfg.Type != cfg.OriginConfig.Type() {
 		return errors.New("origin type missmatch")
 	}
+	if cfg.MaxStaleness != nil && *cfg.MaxStaleness < 0 {
+		return errors.New("max_staleness must not be negative")
+	}
+	if cfg.RefreshMode == "" {
+		cfg.RefreshMode = RefreshModeSync
+	}
+	if cfg.RefreshMode != RefreshModeSync && cfg.RefreshMode != RefreshModeStaleWhileRevalidate {
+		return fmt.Errorf("refresh_mode `%s` is invalid, must be %s or %s", cfg.RefreshMode, RefreshModeSync, RefreshModeStaleWhileRevalidate)
+	}
+	if cfg.RefreshStrategy == "" {
+		cfg.RefreshStrategy = RefreshStrategyInPlace
+	}
+	if cfg.RefreshStrategy != RefreshStrategyInPlace && cfg.RefreshStrategy != RefreshStrategySwap {
+		return fmt.Errorf("refresh_strategy `%s` is invalid, must be %s or %s", cfg.RefreshStrategy, RefreshStrategyInPlace, RefreshStrategySwap)
+	}
+	if cfg.RefreshSchedule != "" {
+		if _, err := ParseRefreshSchedule(cfg.RefreshSchedule); err != nil {
+			return err
+		}
+	}
 	return cfg.OriginConfig.Restrict()
 }
 
@@ -15,6 +15,7 @@ type ColumnConfig struct {
 	DataLength  *int   `yaml:"length,omitempty"`
 	Contraint   string `yaml:"contraint,omitempty"`
 	ColumnIndex *int   `yaml:"column_index,omitempty"`
+	Path        string `yaml:"path,omitempty"`
 }
 
 type ColumnConfigs []*ColumnConfig
@@ -50,25 +51,29 @@ func (cfgs ColumnConfigs) ToRows(records [][]string, ignoreLines int) [][]interf
 		records = records[ignoreLines:]
 	}
 	return lo.Map(records, func(record []string, _ int) []interface{} {
+		return cfgs.ToRow(record)
+	})
+}
 
-		row := make([]interface{}, 0, len(cfgs))
-		for i, c := range cfgs {
-			if c.ColumnIndex != nil {
-				if *c.ColumnIndex < len(record) {
-					row = append(row, toDBValue(c.DataType, c.DataLength, c.Contraint, record[*c.ColumnIndex]))
-				} else {
-					row = append(row, nil)
-				}
-				continue
-			}
-			if i < len(record) {
-				row = append(row, toDBValue(c.DataType, c.DataLength, c.Contraint, record[i]))
+// ToRow converts the record to the row of the columns.
+func (cfgs ColumnConfigs) ToRow(record []string) []interface{} {
+	row := make([]interface{}, 0, len(cfgs))
+	for i, c := range cfgs {
+		if c.ColumnIndex != nil {
+			if *c.ColumnIndex < len(record) {
+				row = append(row, toDBValue(c.DataType, c.DataLength, c.Contraint, record[*c.ColumnIndex]))
 			} else {
 				row = append(row, nil)
 			}
+			continue
 		}
-		return row
-	})
+		if i < len(record) {
+			row = append(row, toDBValue(c.DataType, c.DataLength, c.Contraint, record[i]))
+		} else {
+			row = append(row, nil)
+		}
+	}
+	return row
 }
 
 func toDBValue(dataType string, dataLength *int, constraint string, value string) interface{} {
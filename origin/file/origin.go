@@ -0,0 +1,362 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Songmu/flextime"
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/mashiike/psql-front/origin"
+	"github.com/samber/lo"
+)
+
+const (
+	OriginType       = "File"
+	SourceFileColumn = "_source_file"
+)
+
+// ErrNoFiles is returned when path matches no files, so that the cached rows are not replaced with nothing.
+var ErrNoFiles = errors.New("no files matched")
+
+func init() {
+	psqlfront.RegisterOriginType(OriginType, func() psqlfront.OriginConfig {
+		return &OriginConfig{}
+	})
+	log.Printf("[info] load origin type: %s", OriginType)
+}
+
+type Origin struct {
+	id     string
+	schema string
+	tables []*TableConfig
+}
+
+func (o *Origin) ID() string {
+	return o.id
+}
+
+func (o *Origin) GetTables(_ context.Context) ([]*psqlfront.Table, error) {
+	return lo.Map(o.tables, func(cfg *TableConfig, _ int) *psqlfront.Table {
+		return cfg.ToTable()
+	}), nil
+}
+
+func (o *Origin) RefreshCache(ctx context.Context, w psqlfront.CacheWriter) error {
+	table := w.TargetTable()
+	if o.schema != table.SchemaName {
+		return psqlfront.WrapOriginNotFoundError(errors.New("origin schema is missmatch"))
+	}
+	for _, t := range o.tables {
+		if t.Name != table.RelName {
+			continue
+		}
+		return o.refreshCache(ctx, w, t)
+	}
+	return psqlfront.WrapOriginNotFoundError(errors.New("origin table not found"))
+}
+
+func (o *Origin) refreshCache(ctx context.Context, w psqlfront.CacheWriter, cfg *TableConfig) error {
+	if cfg.SchemaDetection {
+		// the files are read once, so that the schema is detected from the same records as loaded.
+		files, fileRecords, err := cfg.readFiles(ctx)
+		if err != nil {
+			return fmt.Errorf("try get %s origin: %w", w.TargetTable().String(), err)
+		}
+		if err := cfg.detectSchema(ctx, func(_ context.Context) ([][]string, error) {
+			return cfg.concatRecords(fileRecords), nil
+		}); err != nil {
+			return err
+		}
+		if err := w.ReplaceCacheTable(ctx, cfg.ToTable()); err != nil {
+			return err
+		}
+		return w.AppendRows(ctx, cfg.toRows(files, fileRecords))
+	}
+	if err := w.DeleteRows(ctx); err != nil {
+		return err
+	}
+	if err := cfg.StreamRows(ctx, w); err != nil {
+		return fmt.Errorf("try get %s origin: %w", w.TargetTable().String(), err)
+	}
+	return nil
+}
+
+type OriginConfig struct {
+	Schema string         `yaml:"schema"`
+	Tables []*TableConfig `yaml:"tables"`
+}
+
+type TableConfig struct {
+	origin.BaseTableConfig     `yaml:",inline"`
+	origin.NoIncrementalConfig `yaml:",inline"`
+	origin.FormatConfig        `yaml:",inline"`
+
+	Path                     string        `yaml:"path"`
+	IgnoreLines              int           `yaml:"ignore_lines"`
+	SchemaDetection          bool          `yaml:"schema_detection"`
+	DetectedSchemaExpiration time.Duration `yaml:"detected_schema_expiration"`
+	AllowUnicodeColumnName   bool          `yaml:"allow_unicode_column_name"`
+	AddSourceFileColumn      bool          `yaml:"add_source_file_column"`
+	LastSchemaDetection      time.Time     `yaml:"-"`
+}
+
+func (cfg *OriginConfig) Type() string {
+	return OriginType
+}
+
+func (cfg *OriginConfig) Restrict() error {
+	if cfg.Schema == "" {
+		cfg.Schema = "public"
+	}
+	for i, table := range cfg.Tables {
+		if err := table.Restrict(cfg.Schema); err != nil {
+			return fmt.Errorf("table[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (cfg *OriginConfig) NewOrigin(id string) (psqlfront.Origin, error) {
+	return &Origin{
+		id:     id,
+		schema: cfg.Schema,
+		tables: cfg.Tables,
+	}, nil
+}
+
+func (cfg *TableConfig) Restrict(schema string) error {
+	if err := cfg.RestrictIncremental(); err != nil {
+		return err
+	}
+	if cfg.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+	if _, err := filepath.Match(cfg.Path, ""); err != nil {
+		return fmt.Errorf("path is invalid: %v", err)
+	}
+	if err := cfg.FormatConfig.Restrict(); err != nil {
+		return err
+	}
+	cfg.IgnoreLines = cfg.DefaultIgnoreLines(cfg.IgnoreLines)
+	if !cfg.SchemaDetection {
+		if len(cfg.Columns) == 0 {
+			return fmt.Errorf("columns: empty")
+		}
+		if _, err := cfg.Files(); err != nil {
+			log.Printf("[warn] %s.%s %v", schema, cfg.Name, err)
+		}
+	} else {
+		if err := cfg.DetectSchema(context.Background()); err != nil {
+			log.Printf("[warn] %s.%s initial schema detection failed: %v", schema, cfg.Name, err)
+			cfg.Columns = origin.ColumnConfigs{
+				{
+					Name:     "dummy",
+					DataType: "VARCHAR",
+				},
+			}
+		}
+	}
+	if err := cfg.BaseTableConfig.Restrict(schema); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cfg *TableConfig) ToTable() *psqlfront.Table {
+	table := cfg.BaseTableConfig.ToTable()
+	if cfg.AddSourceFileColumn {
+		table.Columns = append(table.Columns, &psqlfront.Column{
+			Name:     SourceFileColumn,
+			DataType: "TEXT",
+		})
+	}
+	return table
+}
+
+// Files returns the matched file paths in lexical order, if no files are matched returns ErrNoFiles.
+func (cfg *TableConfig) Files() ([]string, error) {
+	matches, err := filepath.Glob(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(matches))
+	for _, m := range matches {
+		info, err := os.Stat(m)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		files = append(files, m)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("path `%s`: %w", cfg.Path, ErrNoFiles)
+	}
+	return files, nil
+}
+
+func (cfg *TableConfig) readFile(ctx context.Context, path string) ([][]string, error) {
+	remoteAddr := psqlfront.GetRemoteAddr(ctx)
+	log.Printf("[debug][%s] read file: %s", remoteAddr, path)
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return cfg.readRecords(fp)
+}
+
+// Fetcher concatenates records of all matched files.
+func (cfg *TableConfig) Fetcher(ctx context.Context) ([][]string, error) {
+	_, fileRecords, err := cfg.readFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.concatRecords(fileRecords), nil
+}
+
+func (cfg *TableConfig) FetchRows(ctx context.Context) ([][]interface{}, error) {
+	files, fileRecords, err := cfg.readFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.toRows(files, fileRecords), nil
+}
+
+// readFiles reads the records of every matched file, the records are returned in the order of the files.
+func (cfg *TableConfig) readFiles(ctx context.Context) ([]string, [][][]string, error) {
+	files, err := cfg.Files()
+	if err != nil {
+		return nil, nil, err
+	}
+	fileRecords := make([][][]string, 0, len(files))
+	for _, path := range files {
+		r, err := cfg.readFile(ctx, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		fileRecords = append(fileRecords, r)
+	}
+	return files, fileRecords, nil
+}
+
+// concatRecords concatenates records of the files.
+// ignore_lines is applied to every file, but the first file's lines are removed at ToRows.
+func (cfg *TableConfig) concatRecords(fileRecords [][][]string) [][]string {
+	records := make([][]string, 0)
+	for i, r := range fileRecords {
+		if i > 0 && cfg.IgnoreLines > 0 {
+			if cfg.IgnoreLines >= len(r) {
+				continue
+			}
+			r = r[cfg.IgnoreLines:]
+		}
+		records = append(records, r...)
+	}
+	return records
+}
+
+// toRows converts the records of the files to rows, the path is appended to every row for _source_file column.
+func (cfg *TableConfig) toRows(files []string, fileRecords [][][]string) [][]interface{} {
+	if !cfg.AddSourceFileColumn {
+		return cfg.Columns.ToRows(cfg.concatRecords(fileRecords), cfg.IgnoreLines)
+	}
+	rows := make([][]interface{}, 0)
+	for i, path := range files {
+		for _, row := range cfg.Columns.ToRows(fileRecords[i], cfg.IgnoreLines) {
+			rows = append(rows, append(row, path))
+		}
+	}
+	return rows
+}
+
+// StreamRows appends the records of all matched files to w, the files are read one by one.
+func (cfg *TableConfig) StreamRows(ctx context.Context, w psqlfront.CacheWriter) error {
+	files, err := cfg.Files()
+	if err != nil {
+		return err
+	}
+	if !cfg.AddSourceFileColumn {
+		return cfg.BaseTableConfig.StreamRows(ctx, w, func(ctx context.Context, fn func(origin.RecordReader) error) error {
+			r := origin.ConcatRecordReaders(len(files), cfg.IgnoreLines, func(i int) (origin.RecordReadCloser, error) {
+				return cfg.openFile(ctx, files[i])
+			})
+			defer r.Close()
+			return fn(r)
+		}, cfg.IgnoreLines)
+	}
+	for _, path := range files {
+		r, err := cfg.openFile(ctx, path)
+		if err != nil {
+			return err
+		}
+		err = w.AppendRowIterator(ctx, &sourceFileRowIterator{
+			RowIterator: cfg.Columns.NewRowIterator(r, cfg.IgnoreLines),
+			path:        path,
+		})
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cfg *TableConfig) openFile(ctx context.Context, path string) (origin.RecordReadCloser, error) {
+	remoteAddr := psqlfront.GetRemoteAddr(ctx)
+	log.Printf("[debug][%s] read file: %s", remoteAddr, path)
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := cfg.NewRecordReader(fp, cfg.Columns)
+	if err != nil {
+		fp.Close()
+		return nil, err
+	}
+	return origin.WithCloser(r, fp), nil
+}
+
+// sourceFileRowIterator appends the path to every row for _source_file column.
+type sourceFileRowIterator struct {
+	psqlfront.RowIterator
+	path string
+}
+
+func (it *sourceFileRowIterator) Values() ([]interface{}, error) {
+	values, err := it.RowIterator.Values()
+	if err != nil {
+		return nil, err
+	}
+	return append(values, it.path), nil
+}
+
+func (cfg *TableConfig) DetectSchema(ctx context.Context) error {
+	return cfg.detectSchema(ctx, cfg.Fetcher)
+}
+
+func (cfg *TableConfig) detectSchema(ctx context.Context, fetcher origin.Fetcher) error {
+	now := flextime.Now()
+	if cfg.DetectedSchemaExpiration != 0 && now.Sub(cfg.LastSchemaDetection) < cfg.DetectedSchemaExpiration {
+		return nil
+	}
+	if err := cfg.BaseTableConfig.DetectSchema(ctx, fetcher, cfg.IgnoreLines, cfg.AllowUnicodeColumnName); err != nil {
+		return err
+	}
+	cfg.LastSchemaDetection = now
+	return nil
+}
+
+func (cfg *TableConfig) readRecords(r io.Reader) ([][]string, error) {
+	if cfg.SchemaDetection {
+		return cfg.ReadRecords(r, nil)
+	}
+	return cfg.ReadRecords(r, cfg.Columns)
+}
@@ -0,0 +1,195 @@
+package file_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/mashiike/psql-front/origin"
+	fileorigin "github.com/mashiike/psql-front/origin/file"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableConfigFetchRows(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2022-08.csv"), []byte("id,name\n1,hoge\n2,fuga\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2022-09.csv"), []byte("id,name\n3,piyo\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("not target"), 0644))
+	columns := origin.ColumnConfigs{
+		{
+			Name:      "id",
+			DataType:  "BIGINT",
+			Contraint: "NOT NULL",
+		},
+		{
+			Name:     "name",
+			DataType: "TEXT",
+		},
+	}
+	cases := []struct {
+		name                string
+		addSourceFileColumn bool
+		expectedColumns     []string
+		expected            [][]interface{}
+	}{
+		{
+			name:            "glob",
+			expectedColumns: []string{"id", "name"},
+			expected: [][]interface{}{
+				{int64(1), "hoge"},
+				{int64(2), "fuga"},
+				{int64(3), "piyo"},
+			},
+		},
+		{
+			name:                "with source file column",
+			addSourceFileColumn: true,
+			expectedColumns:     []string{"id", "name", "_source_file"},
+			expected: [][]interface{}{
+				{int64(1), "hoge", filepath.Join(dir, "2022-08.csv")},
+				{int64(2), "fuga", filepath.Join(dir, "2022-08.csv")},
+				{int64(3), "piyo", filepath.Join(dir, "2022-09.csv")},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := &fileorigin.TableConfig{
+				BaseTableConfig: origin.BaseTableConfig{
+					Name:    "table",
+					Columns: columns,
+				},
+				IgnoreLines:         1,
+				Path:                filepath.Join(dir, "*.csv"),
+				AddSourceFileColumn: c.addSourceFileColumn,
+			}
+			err := cfg.Restrict("test")
+			require.NoError(t, err)
+			columnNames := make([]string, 0)
+			for _, column := range cfg.ToTable().Columns {
+				columnNames = append(columnNames, column.Name)
+			}
+			require.EqualValues(t, c.expectedColumns, columnNames)
+			rows, err := cfg.FetchRows(context.Background())
+			require.NoError(t, err)
+			require.EqualValues(t, c.expected, rows)
+
+			w := &recordCacheWriter{}
+			err = cfg.StreamRows(context.Background(), w)
+			require.NoError(t, err)
+			require.EqualValues(t, c.expected, w.rows, "streamed rows are the same as fetched rows")
+		})
+	}
+}
+
+type recordCacheWriter struct {
+	table *psqlfront.Table
+	rows  [][]interface{}
+}
+
+func (w *recordCacheWriter) DeleteRows(_ context.Context) error {
+	w.rows = nil
+	return nil
+}
+
+func (w *recordCacheWriter) ReplaceCacheTable(_ context.Context, t *psqlfront.Table) error {
+	w.table = t
+	w.rows = nil
+	return nil
+}
+
+func (w *recordCacheWriter) AppendRows(_ context.Context, rows [][]interface{}) error {
+	w.rows = append(w.rows, rows...)
+	return nil
+}
+
+func (w *recordCacheWriter) AppendRowIterator(_ context.Context, iter psqlfront.RowIterator) error {
+	for iter.Next() {
+		values, err := iter.Values()
+		if err != nil {
+			return err
+		}
+		w.rows = append(w.rows, values)
+	}
+	return iter.Err()
+}
+
+func (w *recordCacheWriter) UpsertRows(_ context.Context, rows [][]interface{}) error {
+	w.rows = append(w.rows, rows...)
+	return nil
+}
+
+func (w *recordCacheWriter) TargetTable() *psqlfront.Table {
+	return w.table
+}
+
+func (w *recordCacheWriter) CacheValidators(_ context.Context) (*psqlfront.CacheValidators, error) {
+	return &psqlfront.CacheValidators{}, nil
+}
+
+func (w *recordCacheWriter) SetCacheValidators(_ context.Context, _ *psqlfront.CacheValidators) error {
+	return nil
+}
+
+func (w *recordCacheWriter) Watermark(_ context.Context) (string, error) {
+	return "", nil
+}
+
+func TestTableConfigNoFiles(t *testing.T) {
+	cfg := &fileorigin.TableConfig{
+		BaseTableConfig: origin.BaseTableConfig{
+			Name: "table",
+			Columns: origin.ColumnConfigs{
+				{Name: "id", DataType: "BIGINT"},
+			},
+		},
+		IgnoreLines: 1,
+		Path:        filepath.Join(t.TempDir(), "*.csv"),
+	}
+	require.NoError(t, cfg.Restrict("test"), "files may be placed after startup")
+	_, err := cfg.FetchRows(context.Background())
+	require.ErrorIs(t, err, fileorigin.ErrNoFiles)
+	w := &recordCacheWriter{rows: [][]interface{}{{int64(1)}}}
+	err = cfg.StreamRows(context.Background(), w)
+	require.ErrorIs(t, err, fileorigin.ErrNoFiles)
+	require.Len(t, w.rows, 1, "cached rows are kept")
+}
+
+func TestOriginRefreshCacheSchemaDetection(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2022-08.csv"), []byte("id,name\n1,hoge\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2022-09.csv"), []byte("id,name\n2,fuga\n"), 0644))
+	cfg := &fileorigin.OriginConfig{
+		Schema: "example",
+		Tables: []*fileorigin.TableConfig{
+			{
+				BaseTableConfig: origin.BaseTableConfig{
+					Name: "exports",
+				},
+				IgnoreLines:         1,
+				Path:                filepath.Join(dir, "*.csv"),
+				SchemaDetection:     true,
+				AddSourceFileColumn: true,
+			},
+		},
+	}
+	require.NoError(t, cfg.Restrict())
+	o, err := cfg.NewOrigin("file")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	w := &recordCacheWriter{table: &psqlfront.Table{SchemaName: "example", RelName: "exports"}}
+	require.NoError(t, o.RefreshCache(context.Background(), w))
+	require.Equal(t, [][]interface{}{
+		{int64(1), "hoge", filepath.Join(dir, "2022-08.csv")},
+		{int64(2), "fuga", filepath.Join(dir, "2022-09.csv")},
+	}, w.rows)
+	require.Equal(t, 2, strings.Count(buf.String(), "read file: "), "each file is read once")
+}
@@ -0,0 +1,227 @@
+package origin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	ltsv "github.com/Songmu/go-ltsv"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatTSV   = "tsv"
+	FormatLTSV  = "ltsv"
+	FormatJSON  = "json"
+	FormatJSONL = "jsonl"
+	FormatXLSX  = "xlsx"
+)
+
+var supportedFormats = []string{FormatCSV, FormatTSV, FormatLTSV, FormatJSON, FormatJSONL, FormatXLSX}
+
+type FormatConfig struct {
+	Format       string  `yaml:"format"`
+	TextEncoding *string `yaml:"text_encoding"`
+	JSONPath     string  `yaml:"json_path"`
+	Delimiter    string  `yaml:"delimiter"`
+	Quote        string  `yaml:"quote"`
+	Comment      string  `yaml:"comment"`
+	LazyQuotes   bool    `yaml:"lazy_quotes"`
+	Sheet        string  `yaml:"sheet"`
+	SheetIndex   *int    `yaml:"sheet_index"`
+	Range        string  `yaml:"range"`
+
+	delimiter rune `yaml:"-"`
+	quote     byte `yaml:"-"`
+	comment   rune `yaml:"-"`
+}
+
+func (cfg *FormatConfig) Restrict() error {
+	if cfg.Format == "" {
+		cfg.Format = FormatCSV
+	}
+	cfg.Format = strings.ToLower(cfg.Format)
+	switch cfg.Format {
+	case FormatCSV, FormatTSV:
+		var err error
+		cfg.delimiter = ','
+		if cfg.Format == FormatTSV {
+			cfg.delimiter = '\t'
+		}
+		if cfg.Delimiter != "" {
+			if cfg.delimiter, err = parseSingleRune(cfg.Delimiter); err != nil {
+				return fmt.Errorf("delimiter: %w", err)
+			}
+		}
+		cfg.quote = '"'
+		if cfg.Quote != "" {
+			if len(cfg.Quote) != 1 || cfg.Quote[0] >= utf8.RuneSelf {
+				return errors.New("quote: must be a single ASCII character")
+			}
+			cfg.quote = cfg.Quote[0]
+		}
+		if cfg.Comment != "" {
+			if cfg.comment, err = parseSingleRune(cfg.Comment); err != nil {
+				return fmt.Errorf("comment: %w", err)
+			}
+		}
+		if cfg.delimiter == rune(cfg.quote) || cfg.delimiter == cfg.comment || rune(cfg.quote) == cfg.comment {
+			return errors.New("delimiter, quote and comment must be different characters")
+		}
+	case FormatLTSV:
+	case FormatXLSX:
+		if _, err := ParseXLSXRange(cfg.Range); err != nil {
+			return fmt.Errorf("range: %w", err)
+		}
+	case FormatJSON, FormatJSONL:
+		if _, err := ParseJSONPath(cfg.JSONPath); err != nil {
+			return fmt.Errorf("json_path: %w", err)
+		}
+	default:
+		return fmt.Errorf("format `%s` is not supported, supported formats: %s", cfg.Format, strings.Join(supportedFormats, "/"))
+	}
+	return nil
+}
+
+func parseSingleRune(s string) (rune, error) {
+	if s == `\t` {
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError || size != len(s) {
+		return 0, fmt.Errorf("`%s` is not a single character", s)
+	}
+	return r, nil
+}
+
+// HasFieldNames reports whether the format has field names in each row.
+// These formats always produce a header record as the first record, so ignore_lines should be 1 or more.
+func (cfg *FormatConfig) HasFieldNames() bool {
+	switch cfg.Format {
+	case FormatLTSV, FormatJSON, FormatJSONL:
+		return true
+	}
+	return false
+}
+
+// DefaultIgnoreLines returns ignore_lines with the default of the format.
+// The header record made from the field names is skipped by default, so 0 becomes 1 for these formats.
+func (cfg *FormatConfig) DefaultIgnoreLines(ignoreLines int) int {
+	if cfg.HasFieldNames() && ignoreLines == 0 {
+		return 1
+	}
+	return ignoreLines
+}
+
+// ReadRecords reads all records from r.
+// columns are used by formats with field names to pick up each field, if columns is empty, all fields are read.
+func (cfg *FormatConfig) ReadRecords(r io.Reader, columns ColumnConfigs) ([][]string, error) {
+	if cfg.Format == FormatXLSX {
+		return ReadXLSXRecords(r, cfg.Sheet, cfg.SheetIndex, cfg.Range)
+	}
+	tr := ConvertTextEncoding(r, cfg.TextEncoding)
+	switch cfg.Format {
+	case FormatCSV, FormatTSV:
+		return cfg.readDelimitedRecords(tr)
+	case FormatLTSV:
+		return readLTSVRecords(tr, columns)
+	case FormatJSON:
+		return readJSONRecords(tr, cfg.JSONPath, columns)
+	case FormatJSONL:
+		return readJSONLinesRecords(tr, columns)
+	}
+	return nil, fmt.Errorf("unexpected format `%s`", cfg.Format)
+}
+
+func (cfg *FormatConfig) readDelimitedRecords(r io.Reader) ([][]string, error) {
+	quote := cfg.quote
+	if quote == 0 {
+		quote = '"'
+	}
+	if quote != '"' {
+		// encoding/csv only supports '"' as quote, so swap the custom quote and '"' before and after reading.
+		r = &swapByteReader{r: r, a: quote, b: '"'}
+	}
+	reader := csv.NewReader(r)
+	if cfg.delimiter != 0 {
+		reader.Comma = cfg.delimiter
+	}
+	reader.Comment = cfg.comment
+	reader.LazyQuotes = cfg.LazyQuotes
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if quote != '"' {
+		for _, record := range records {
+			for i, field := range record {
+				record[i] = string(swapBytes([]byte(field), quote, '"'))
+			}
+		}
+	}
+	return records, nil
+}
+
+type swapByteReader struct {
+	r    io.Reader
+	a, b byte
+}
+
+func (s *swapByteReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	swapBytes(p[:n], s.a, s.b)
+	return n, err
+}
+
+func swapBytes(p []byte, a, b byte) []byte {
+	for i, c := range p {
+		switch c {
+		case a:
+			p[i] = b
+		case b:
+			p[i] = a
+		}
+	}
+	return p
+}
+
+func readLTSVRecords(r io.Reader, columns ColumnConfigs) ([][]string, error) {
+	objects := make([]interface{}, 0)
+	reader := bufio.NewReader(r)
+	lineNumber := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		lineNumber++
+		if trimmed := bytes.TrimRight(line, "\r\n"); len(bytes.TrimSpace(trimmed)) > 0 {
+			obj, decodeErr := decodeLTSVLine(trimmed)
+			if decodeErr != nil {
+				return nil, fmt.Errorf("decode ltsv line %d: %w", lineNumber, decodeErr)
+			}
+			objects = append(objects, obj)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+	return objectsToRecords(objects, columns, true)
+}
+
+func decodeLTSVLine(line []byte) (interface{}, error) {
+	m := make(map[string]string)
+	if err := ltsv.Unmarshal(line, &m); err != nil {
+		return nil, err
+	}
+	obj := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		obj[k] = v
+	}
+	return obj, nil
+}
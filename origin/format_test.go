@@ -0,0 +1,250 @@
+package origin_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mashiike/psql-front/origin"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestFormatConfigReadRecords(t *testing.T) {
+	cases := []struct {
+		name     string
+		cfg      origin.FormatConfig
+		input    string
+		columns  origin.ColumnConfigs
+		expected [][]string
+	}{
+		{
+			name:  "csv",
+			cfg:   origin.FormatConfig{Format: "csv"},
+			input: "id,name\n1,hoge\n",
+			expected: [][]string{
+				{"id", "name"},
+				{"1", "hoge"},
+			},
+		},
+		{
+			name:  "tsv",
+			cfg:   origin.FormatConfig{Format: "tsv"},
+			input: "id\tname\n1\thoge, fuga\n",
+			expected: [][]string{
+				{"id", "name"},
+				{"1", "hoge, fuga"},
+			},
+		},
+		{
+			name:  "custom delimiter, quote and comment",
+			cfg:   origin.FormatConfig{Format: "csv", Delimiter: "|", Quote: "'", Comment: "#"},
+			input: "# exported at 2022-08-01\nid|name\n1|'hoge|\"fuga\"'\n2|'it''s'\n",
+			expected: [][]string{
+				{"id", "name"},
+				{"1", `hoge|"fuga"`},
+				{"2", "it's"},
+			},
+		},
+		{
+			name:  "lazy quotes",
+			cfg:   origin.FormatConfig{Format: "csv", LazyQuotes: true},
+			input: "id,name\n1,ho\"ge\n",
+			expected: [][]string{
+				{"id", "name"},
+				{"1", `ho"ge`},
+			},
+		},
+		{
+			name:  "ltsv",
+			cfg:   origin.FormatConfig{Format: "ltsv"},
+			input: "time:2022-08-01T00:00:00\tstatus:200\tpath:/\ntime:2022-08-01T00:00:01\tstatus:404\n",
+			expected: [][]string{
+				{"path", "status", "time"},
+				{"/", "200", "2022-08-01T00:00:00"},
+				{"", "404", "2022-08-01T00:00:01"},
+			},
+		},
+		{
+			name:  "ltsv with columns",
+			cfg:   origin.FormatConfig{Format: "ltsv"},
+			input: "time:2022-08-01T00:00:00\tstatus:200\tpath:/\n",
+			columns: origin.ColumnConfigs{
+				{Name: "status"},
+				{Name: "request_path", Path: "path"},
+			},
+			expected: [][]string{
+				{"status", "request_path"},
+				{"200", "/"},
+			},
+		},
+		{
+			name:  "ltsv with dotted labels",
+			cfg:   origin.FormatConfig{Format: "ltsv"},
+			input: "req.time:0.012\tres.status:200\n",
+			columns: origin.ColumnConfigs{
+				{Name: "req_time", Path: "req.time"},
+				{Name: "res.status"},
+			},
+			expected: [][]string{
+				{"req_time", "res.status"},
+				{"0.012", "200"},
+			},
+		},
+		{
+			name:  "json with path",
+			cfg:   origin.FormatConfig{Format: "json", JSONPath: "$.data.items"},
+			input: `{"data":{"items":[{"id":1,"user":{"name":"hoge"},"tags":["a","b"]},{"id":2,"user":{"name":"fuga"},"tags":null}]}}`,
+			columns: origin.ColumnConfigs{
+				{Name: "id"},
+				{Name: "name", Path: "user.name"},
+				{Name: "first_tag", Path: "tags[0]"},
+				{Name: "tags"},
+			},
+			expected: [][]string{
+				{"id", "name", "first_tag", "tags"},
+				{"1", "hoge", "a", `["a","b"]`},
+				{"2", "fuga", "", ""},
+			},
+		},
+		{
+			name:  "json dotted key",
+			cfg:   origin.FormatConfig{Format: "json"},
+			input: `[{"user.id":1,"user":{"id":2}}]`,
+			columns: origin.ColumnConfigs{
+				{Name: "user.id"},
+				{Name: "nested_user_id", Path: "user.id"},
+			},
+			expected: [][]string{
+				{"user.id", "nested_user_id"},
+				{"1", "2"},
+			},
+		},
+		{
+			name:  "json discover keys",
+			cfg:   origin.FormatConfig{Format: "json"},
+			input: `[{"name":"hoge","id":1},{"id":2,"extra":true}]`,
+			expected: [][]string{
+				{"extra", "id", "name"},
+				{"", "1", "hoge"},
+				{"true", "2", ""},
+			},
+		},
+		{
+			name:  "jsonl",
+			cfg:   origin.FormatConfig{Format: "jsonl"},
+			input: "{\"id\":1,\"attrs\":{\"a\":1}}\n\n{\"id\":2,\"attrs\":{\"b\":2.5}}",
+			columns: origin.ColumnConfigs{
+				{Name: "id"},
+				{Name: "attrs", DataType: "JSONB"},
+			},
+			expected: [][]string{
+				{"id", "attrs"},
+				{"1", `{"a":1}`},
+				{"2", `{"b":2.5}`},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.NoError(t, c.cfg.Restrict())
+			actual, err := c.cfg.ReadRecords(strings.NewReader(c.input), c.columns)
+			require.NoError(t, err)
+			require.EqualValues(t, c.expected, actual)
+		})
+	}
+}
+
+func TestFormatConfigRestrictInvalid(t *testing.T) {
+	cases := []origin.FormatConfig{
+		{Format: "xml"},
+		{Format: "csv", Delimiter: "||"},
+		{Format: "csv", Quote: "“"},
+		{Format: "csv", Delimiter: "'", Quote: "'"},
+		{Format: "csv", Quote: ","},
+		{Format: "tsv", Quote: "\t"},
+		{Format: "csv", Quote: "#", Comment: "#"},
+		{Format: "json", JSONPath: "items["},
+	}
+	for _, c := range cases {
+		require.Error(t, c.Restrict(), "%#v", c)
+	}
+}
+
+func TestFormatConfigDefaultIgnoreLines(t *testing.T) {
+	csv := origin.FormatConfig{Format: "csv"}
+	require.Equal(t, 0, csv.DefaultIgnoreLines(0))
+	ltsv := origin.FormatConfig{Format: "ltsv"}
+	require.Equal(t, 1, ltsv.DefaultIgnoreLines(0), "the header record is skipped by default")
+	require.Equal(t, 2, ltsv.DefaultIgnoreLines(2))
+}
+
+func TestParseJSONPathInvalid(t *testing.T) {
+	for _, path := range []string{"items[", "items[a]", "a..b"} {
+		_, err := origin.ParseJSONPath(path)
+		require.Error(t, err, path)
+	}
+}
+
+func TestFormatConfigReadRecordsXLSX(t *testing.T) {
+	f := excelize.NewFile()
+	_, err := f.NewSheet("users")
+	require.NoError(t, err)
+	require.NoError(t, f.SetSheetRow("Sheet1", "A1", &[]interface{}{"ignored"}))
+	require.NoError(t, f.SetSheetRow("users", "A1", &[]interface{}{"title", "", ""}))
+	require.NoError(t, f.SetSheetRow("users", "B2", &[]interface{}{"id", "name", "memo"}))
+	require.NoError(t, f.SetSheetRow("users", "B3", &[]interface{}{1, "hoge", "x"}))
+	require.NoError(t, f.SetSheetRow("users", "B4", &[]interface{}{2, "fuga", "y"}))
+	var buf bytes.Buffer
+	_, err = f.WriteTo(&buf)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name     string
+		cfg      origin.FormatConfig
+		expected [][]string
+	}{
+		{
+			name: "sheet name and range",
+			cfg:  origin.FormatConfig{Format: "xlsx", Sheet: "users", Range: "B2:C4"},
+			expected: [][]string{
+				{"id", "name"},
+				{"1", "hoge"},
+				{"2", "fuga"},
+			},
+		},
+		{
+			name: "sheet index and column range",
+			cfg:  origin.FormatConfig{Format: "xlsx", SheetIndex: pointer(1), Range: "B:B"},
+			expected: [][]string{
+				{},
+				{"id"},
+				{"1"},
+				{"2"},
+			},
+		},
+		{
+			name: "sheet name in range",
+			cfg:  origin.FormatConfig{Format: "xlsx", Range: "users!C3:D"},
+			expected: [][]string{
+				{"hoge", "x"},
+				{"fuga", "y"},
+			},
+		},
+		{
+			name: "first sheet",
+			cfg:  origin.FormatConfig{Format: "xlsx"},
+			expected: [][]string{
+				{"ignored"},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.NoError(t, c.cfg.Restrict())
+			actual, err := c.cfg.ReadRecords(bytes.NewReader(buf.Bytes()), nil)
+			require.NoError(t, err)
+			require.EqualValues(t, c.expected, actual)
+		})
+	}
+}
@@ -25,6 +25,9 @@ const (
 	OriginType           = "GoogleDrive"
 	FileTypeSpreadsheets = "spreadsheets"
 	FileTypeCSV          = "csv"
+	FileTypeXLSX         = "xlsx"
+
+	xlsxMimeType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
 )
 
 func init() {
@@ -88,15 +91,20 @@ func (o *Origin) refreshCache(ctx context.Context, w psqlfront.CacheWriter, cfg
 }
 
 type OriginConfig struct {
+	origin.RetryPolicyConfig `yaml:",inline"`
+
 	Schema string         `yaml:"schema"`
 	Tables []*TableConfig `yaml:"tables"`
 }
 
 type TableConfig struct {
-	origin.BaseTableConfig `yaml:",inline"`
-	FileType               string `yaml:"file_type"`
-	FileID                 string `yaml:"-"`
-	Range                  string `yaml:"range,omitempty"`
+	origin.BaseTableConfig     `yaml:",inline"`
+	origin.NoIncrementalConfig `yaml:",inline"`
+	FileType                   string `yaml:"file_type"`
+	FileID                     string `yaml:"-"`
+	Range                      string `yaml:"range,omitempty"`
+	Sheet                      string `yaml:"sheet,omitempty"`
+	SheetIndex                 *int   `yaml:"sheet_index,omitempty"`
 
 	URLString                string        `yaml:"url"`
 	IgnoreLines              int           `yaml:"ignore_lines"`
@@ -108,6 +116,7 @@ type TableConfig struct {
 
 	driveSvc  *drive.Service  `yaml:"-"`
 	sheetsSvc *sheets.Service `yaml:"-"`
+	retrier   *origin.Retrier `yaml:"-"`
 }
 
 type ColumnConfig struct {
@@ -126,6 +135,10 @@ func (cfg *OriginConfig) Restrict() error {
 	if cfg.Schema == "" {
 		cfg.Schema = "public"
 	}
+	if err := cfg.RetryPolicyConfig.Restrict(); err != nil {
+		return err
+	}
+	retrier := cfg.NewRetrier()
 	ctx := context.Background()
 	gcpOpts := []option.ClientOption{
 		option.WithScopes(
@@ -144,6 +157,7 @@ func (cfg *OriginConfig) Restrict() error {
 		return fmt.Errorf("create Google Sheets Service: %w", err)
 	}
 	for i, table := range cfg.Tables {
+		table.retrier = retrier
 		if err := table.Restrict(cfg.Schema, driveSvc, sheetsSvc); err != nil {
 			return fmt.Errorf("table[%d]: %w", i, err)
 		}
@@ -163,6 +177,9 @@ func (cfg *TableConfig) Restrict(schema string, driveSvc *drive.Service, sheetsS
 	var err error
 	cfg.driveSvc = driveSvc
 	cfg.sheetsSvc = sheetsSvc
+	if err := cfg.RestrictIncremental(); err != nil {
+		return err
+	}
 	if cfg.URL, err = url.Parse(cfg.URLString); err != nil {
 		return fmt.Errorf("url is invalid: %v", err)
 	}
@@ -180,7 +197,9 @@ func (cfg *TableConfig) Restrict(schema string, driveSvc *drive.Service, sheetsS
 			return errors.New("invalid url, FileID not found")
 		}
 		cfg.FileID = strings.Split(strings.TrimPrefix(cfg.URL.Path, "/spreadsheets/d/"), "/")[0]
-		cfg.FileType = FileTypeSpreadsheets
+		if !strings.EqualFold(cfg.FileType, FileTypeXLSX) {
+			cfg.FileType = FileTypeSpreadsheets
+		}
 	default:
 		return errors.New("invalid url, not drive.google.com or docs.google.com")
 	}
@@ -188,6 +207,11 @@ func (cfg *TableConfig) Restrict(schema string, driveSvc *drive.Service, sheetsS
 		cfg.FileType = FileTypeSpreadsheets
 	}
 	cfg.FileType = strings.ToLower(cfg.FileType)
+	if cfg.FileType == FileTypeXLSX {
+		if _, err := origin.ParseXLSXRange(cfg.Range); err != nil {
+			return fmt.Errorf("range: %w", err)
+		}
+	}
 	if !cfg.SchemaDetection {
 		if len(cfg.Columns) == 0 {
 			return fmt.Errorf("columns: empty")
@@ -209,7 +233,18 @@ func (cfg *TableConfig) Restrict(schema string, driveSvc *drive.Service, sheetsS
 	return nil
 }
 
+// Fetcher gets the records of the file, and retries transient failures.
 func (cfg *TableConfig) Fetcher(ctx context.Context) ([][]string, error) {
+	var records [][]string
+	err := cfg.retrier.Do(ctx, func(ctx context.Context) error {
+		var err error
+		records, err = cfg.fetch(ctx)
+		return err
+	})
+	return records, err
+}
+
+func (cfg *TableConfig) fetch(ctx context.Context) ([][]string, error) {
 	switch cfg.FileType {
 	case FileTypeSpreadsheets:
 		r := cfg.Range
@@ -236,12 +271,41 @@ func (cfg *TableConfig) Fetcher(ctx context.Context) ([][]string, error) {
 			return nil, fmt.Errorf("can not get %s: %w", cfg.URLString, err)
 		}
 		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("can not get %s: http status: %s", cfg.URLString, resp.Status)
+			resp.Body.Close()
+			return nil, fmt.Errorf("can not get %s: %w", cfg.URLString, &origin.HTTPStatusError{
+				Method:     http.MethodGet,
+				URL:        cfg.URLString,
+				StatusCode: resp.StatusCode,
+				Status:     resp.Status,
+			})
 		}
 		defer resp.Body.Close()
 		tr := origin.ConvertTextEncoding(resp.Body, nil)
 		reader := csv.NewReader(tr)
 		return reader.ReadAll()
+	case FileTypeXLSX:
+		var resp *http.Response
+		var err error
+		if cfg.URL.Host == "docs.google.com" {
+			// native spreadsheets can not be downloaded as is, export as xlsx.
+			resp, err = cfg.driveSvc.Files.Export(cfg.FileID, xlsxMimeType).Context(ctx).Download()
+		} else {
+			resp, err = cfg.driveSvc.Files.Get(cfg.FileID).Context(ctx).Download()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can not get %s: %w", cfg.URLString, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("can not get %s: %w", cfg.URLString, &origin.HTTPStatusError{
+				Method:     http.MethodGet,
+				URL:        cfg.URLString,
+				StatusCode: resp.StatusCode,
+				Status:     resp.Status,
+			})
+		}
+		defer resp.Body.Close()
+		return origin.ReadXLSXRecords(resp.Body, cfg.Sheet, cfg.SheetIndex, cfg.Range)
 	default:
 		return nil, errors.New("unexpected file type")
 	}
@@ -2,9 +2,9 @@ package http
 
 import (
 	"context"
-	"encoding/csv"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
@@ -57,42 +57,69 @@ func (o *Origin) RefreshCache(ctx context.Context, w psqlfront.CacheWriter) erro
 }
 
 func (o *Origin) refreshCache(ctx context.Context, w psqlfront.CacheWriter, cfg *TableConfig) error {
-	if cfg.SchemaDetection {
-		if err := cfg.DetectSchema(ctx); err != nil {
-			return err
-		}
-		if err := w.ReplaceCacheTable(ctx, cfg.ToTable()); err != nil {
-			return err
-		}
-	} else {
-		if err := w.DeleteRows(ctx); err != nil {
-			return err
+	validators, err := w.CacheValidators(ctx)
+	if err != nil {
+		return err
+	}
+	if !cfg.SchemaDetection {
+		validators, err = cfg.stream(ctx, validators, func(r origin.RecordReader) error {
+			if err := w.DeleteRows(ctx); err != nil {
+				return err
+			}
+			return w.AppendRowIterator(ctx, cfg.Columns.NewRowIterator(r, cfg.IgnoreLines))
+		})
+		if err != nil {
+			if errors.Is(err, psqlfront.ErrNotModified) {
+				return err
+			}
+			return fmt.Errorf("try get %s origin: %w", w.TargetTable().String(), err)
 		}
+		return w.SetCacheValidators(ctx, validators)
 	}
-	rows, err := cfg.FetchRows(ctx)
+	records, validators, err := cfg.fetch(ctx, validators)
 	if err != nil {
+		if errors.Is(err, psqlfront.ErrNotModified) {
+			return err
+		}
 		return fmt.Errorf("try get %s origin: %w", w.TargetTable().String(), err)
 	}
-	return w.AppendRows(ctx, rows)
+	if err := cfg.detectSchema(ctx, func(_ context.Context) ([][]string, error) {
+		return records, nil
+	}); err != nil {
+		return err
+	}
+	if err := w.ReplaceCacheTable(ctx, cfg.ToTable()); err != nil {
+		return err
+	}
+	if err := w.AppendRowIterator(ctx, cfg.Columns.NewRowIterator(origin.NewSliceRecordReader(records), cfg.IgnoreLines)); err != nil {
+		return err
+	}
+	return w.SetCacheValidators(ctx, validators)
 }
 
 type OriginConfig struct {
+	origin.HTTPClientConfig  `yaml:",inline"`
+	origin.RetryPolicyConfig `yaml:",inline"`
+
 	Schema string         `yaml:"schema"`
 	Tables []*TableConfig `yaml:"tables"`
 }
 
 type TableConfig struct {
-	origin.BaseTableConfig `yaml:",inline"`
+	origin.BaseTableConfig     `yaml:",inline"`
+	origin.NoIncrementalConfig `yaml:",inline"`
+	origin.HTTPClientConfig    `yaml:",inline"`
+	origin.FormatConfig        `yaml:",inline"`
 
 	URLString                string        `yaml:"url"`
-	Format                   string        `yaml:"format"`
 	IgnoreLines              int           `yaml:"ignore_lines"`
-	TextEncoding             *string       `yaml:"text_encoding"`
 	SchemaDetection          bool          `yaml:"schema_detection"`
 	DetectedSchemaExpiration time.Duration `yaml:"detected_schema_expiration"`
 	AllowUnicodeColumnName   bool          `yaml:"allow_unicode_column_name"`
 	URL                      *url.URL      `yaml:"-"`
 	LastSchemaDetection      time.Time     `yaml:"-"`
+
+	retrier *origin.Retrier `yaml:"-"`
 }
 
 func (cfg *OriginConfig) Type() string {
@@ -103,7 +130,13 @@ func (cfg *OriginConfig) Restrict() error {
 	if cfg.Schema == "" {
 		cfg.Schema = "public"
 	}
+	if err := cfg.RetryPolicyConfig.Restrict(); err != nil {
+		return err
+	}
+	retrier := cfg.NewRetrier()
 	for i, table := range cfg.Tables {
+		table.HTTPClientConfig.Inherit(&cfg.HTTPClientConfig)
+		table.retrier = retrier
 		if err := table.Restrict(cfg.Schema); err != nil {
 			return fmt.Errorf("table[%d]: %w", i, err)
 		}
@@ -114,12 +147,16 @@ func (cfg *OriginConfig) Restrict() error {
 var allowedSchemas = []string{"http", "https"}
 
 func (cfg *TableConfig) Restrict(schema string) error {
+	if err := cfg.RestrictIncremental(); err != nil {
+		return err
+	}
 	if cfg.URLString == "" {
 		return fmt.Errorf("url is required")
 	}
-	if cfg.Format == "" {
-		cfg.Format = "csv"
+	if err := cfg.FormatConfig.Restrict(); err != nil {
+		return err
 	}
+	cfg.IgnoreLines = cfg.DefaultIgnoreLines(cfg.IgnoreLines)
 	var err error
 	if cfg.URL, err = url.Parse(cfg.URLString); err != nil {
 		return fmt.Errorf("url is invalid: %v", err)
@@ -127,6 +164,9 @@ func (cfg *TableConfig) Restrict(schema string) error {
 	if !lo.Contains(allowedSchemas, cfg.URL.Scheme) {
 		return fmt.Errorf("url.schema must %s", strings.Join(allowedSchemas, "/"))
 	}
+	if err := cfg.HTTPClientConfig.Restrict(cfg.URL); err != nil {
+		return err
+	}
 	if !cfg.SchemaDetection {
 		if len(cfg.Columns) == 0 {
 			return fmt.Errorf("columns: empty")
@@ -149,23 +189,101 @@ func (cfg *TableConfig) Restrict(schema string) error {
 }
 
 func (cfg *TableConfig) Fetcher(ctx context.Context) ([][]string, error) {
+	records, _, err := cfg.fetch(ctx, nil)
+	return records, err
+}
+
+// fetch requests the url conditionally with the validators of the previous response, and retries transient failures.
+// If the origin responds 304 Not Modified, returns psqlfront.ErrNotModified.
+func (cfg *TableConfig) fetch(ctx context.Context, validators *psqlfront.CacheValidators) ([][]string, *psqlfront.CacheValidators, error) {
+	var records [][]string
+	var newValidators *psqlfront.CacheValidators
+	err := cfg.retrier.Do(ctx, func(ctx context.Context) error {
+		var err error
+		records, newValidators, err = cfg.fetchOnce(ctx, validators)
+		return err
+	})
+	return records, newValidators, err
+}
+
+func (cfg *TableConfig) fetchOnce(ctx context.Context, validators *psqlfront.CacheValidators) ([][]string, *psqlfront.CacheValidators, error) {
+	resp, err := cfg.openOnce(ctx, validators)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	records, err := cfg.readRecords(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return records, responseValidators(resp), nil
+}
+
+// stream requests the url conditionally same as fetch, and passes the records to fn one by one.
+// Only the request is retried, because the records may be consumed partially by fn.
+func (cfg *TableConfig) stream(ctx context.Context, validators *psqlfront.CacheValidators, fn func(origin.RecordReader) error) (*psqlfront.CacheValidators, error) {
+	var resp *http.Response
+	err := cfg.retrier.Do(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = cfg.openOnce(ctx, validators)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	r, err := cfg.NewRecordReader(resp.Body, cfg.Columns)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(r); err != nil {
+		return nil, err
+	}
+	return responseValidators(resp), nil
+}
+
+// openOnce requests the url, and returns the response of 2xx status. The caller must close the response body.
+func (cfg *TableConfig) openOnce(ctx context.Context, validators *psqlfront.CacheValidators) (*http.Response, error) {
 	remoteAddr := psqlfront.GetRemoteAddr(ctx)
 	log.Printf("[debug][%s] http request: GET %s", remoteAddr, cfg.URL)
-	resp, err := http.Get(cfg.URL.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.URL.String(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("GET %s failed: %v", cfg.URL, err)
+		return nil, err
 	}
-	if resp.StatusCode < http.StatusOK && resp.StatusCode >= http.StatusBadRequest {
-		return nil, fmt.Errorf("GET %s failed: %d %s", cfg.URL, resp.StatusCode, resp.Status)
+	if !validators.IsEmpty() {
+		if validators.ETag != "" {
+			req.Header.Set("If-None-Match", validators.ETag)
+		}
+		if validators.LastModified != "" {
+			req.Header.Set("If-Modified-Since", validators.LastModified)
+		}
 	}
-	defer resp.Body.Close()
-	tr := origin.ConvertTextEncoding(resp.Body, cfg.TextEncoding)
-	switch cfg.Format {
-	case "csv", "CSV":
-		reader := csv.NewReader(tr)
-		return reader.ReadAll()
+	resp, err := cfg.HTTPClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GET %s failed: %w", cfg.URL, err)
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		log.Printf("[debug][%s] GET %s: %s", remoteAddr, cfg.URL, resp.Status)
+		return nil, psqlfront.ErrNotModified
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		resp.Body.Close()
+		return nil, &origin.HTTPStatusError{
+			Method:     http.MethodGet,
+			URL:        cfg.URL.String(),
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+	}
+	return resp, nil
+}
+
+func responseValidators(resp *http.Response) *psqlfront.CacheValidators {
+	return &psqlfront.CacheValidators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
 	}
-	return nil, errors.New("unexpected format")
 }
 
 func (cfg *TableConfig) FetchRows(ctx context.Context) ([][]interface{}, error) {
@@ -173,11 +291,15 @@ func (cfg *TableConfig) FetchRows(ctx context.Context) ([][]interface{}, error)
 }
 
 func (cfg *TableConfig) DetectSchema(ctx context.Context) error {
+	return cfg.detectSchema(ctx, cfg.Fetcher)
+}
+
+func (cfg *TableConfig) detectSchema(ctx context.Context, fetcher origin.Fetcher) error {
 	now := flextime.Now()
 	if cfg.DetectedSchemaExpiration != 0 && now.Sub(cfg.LastSchemaDetection) < cfg.DetectedSchemaExpiration {
 		return nil
 	}
-	if err := cfg.BaseTableConfig.DetectSchema(ctx, cfg.Fetcher, cfg.IgnoreLines, cfg.AllowUnicodeColumnName); err != nil {
+	if err := cfg.BaseTableConfig.DetectSchema(ctx, fetcher, cfg.IgnoreLines, cfg.AllowUnicodeColumnName); err != nil {
 		return err
 	}
 	cfg.LastSchemaDetection = now
@@ -191,3 +313,10 @@ func (cfg *OriginConfig) NewOrigin(id string) (psqlfront.Origin, error) {
 		tables: cfg.Tables,
 	}, nil
 }
+
+func (cfg *TableConfig) readRecords(r io.Reader) ([][]string, error) {
+	if cfg.SchemaDetection {
+		return cfg.ReadRecords(r, nil)
+	}
+	return cfg.ReadRecords(r, cfg.Columns)
+}
@@ -7,7 +7,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	psqlfront "github.com/mashiike/psql-front"
 	"github.com/mashiike/psql-front/origin"
 	httporigin "github.com/mashiike/psql-front/origin/http"
 	"github.com/stretchr/testify/require"
@@ -35,6 +37,10 @@ func TestTableConfigFetchRows(t *testing.T) {
 			tw := transform.NewWriter(w, japanese.EUCJP.NewEncoder().Transformer)
 			tw.Write(buf.Bytes())
 			return
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"items":[{"id":1,"profile":{"name":"平塚 えみ"},"role":"manager"},{"id":2,"profile":{"name":"大塚 曽根吾郎"},"role":"takumi"}]}`))
+			return
 		}
 		http.NotFound(w, r)
 	}))
@@ -93,6 +99,66 @@ func TestTableConfigFetchRows(t *testing.T) {
 				{int64(4), "令和 みすず", "enginner"},
 			},
 		},
+		{
+			name: "json",
+			cfg: &httporigin.TableConfig{
+				BaseTableConfig: origin.BaseTableConfig{
+					Name: "table",
+					Columns: origin.ColumnConfigs{
+						{
+							Name:      "id",
+							DataType:  "BIGINT",
+							Contraint: "NOT NULL",
+						},
+						{
+							Name:     "name",
+							DataType: "TEXT",
+							Path:     "profile.name",
+						},
+						{
+							Name:     "role",
+							DataType: "TEXT",
+						},
+					},
+				},
+				FormatConfig: origin.FormatConfig{
+					Format:   "json",
+					JSONPath: "$.items",
+				},
+				URLString: s.URL + "/json",
+			},
+			expected: [][]interface{}{
+				{int64(1), "平塚 えみ", "manager"},
+				{int64(2), "大塚 曽根吾郎", "takumi"},
+			},
+		},
+		{
+			name: "json with ignore_lines",
+			cfg: &httporigin.TableConfig{
+				BaseTableConfig: origin.BaseTableConfig{
+					Name: "table",
+					Columns: origin.ColumnConfigs{
+						{
+							Name:     "id",
+							DataType: "BIGINT",
+						},
+						{
+							Name:     "role",
+							DataType: "TEXT",
+						},
+					},
+				},
+				FormatConfig: origin.FormatConfig{
+					Format:   "json",
+					JSONPath: "$.items",
+				},
+				IgnoreLines: 2,
+				URLString:   s.URL + "/json",
+			},
+			expected: [][]interface{}{
+				{int64(2), "takumi"},
+			},
+		},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
@@ -104,3 +170,155 @@ func TestTableConfigFetchRows(t *testing.T) {
 		})
 	}
 }
+
+type recordCacheWriter struct {
+	table      *psqlfront.Table
+	validators *psqlfront.CacheValidators
+	rows       [][]interface{}
+}
+
+func (w *recordCacheWriter) DeleteRows(_ context.Context) error {
+	w.rows = nil
+	return nil
+}
+
+func (w *recordCacheWriter) ReplaceCacheTable(_ context.Context, t *psqlfront.Table) error {
+	w.rows = nil
+	return nil
+}
+
+func (w *recordCacheWriter) AppendRows(_ context.Context, rows [][]interface{}) error {
+	w.rows = append(w.rows, rows...)
+	return nil
+}
+
+func (w *recordCacheWriter) AppendRowIterator(_ context.Context, iter psqlfront.RowIterator) error {
+	for iter.Next() {
+		values, err := iter.Values()
+		if err != nil {
+			return err
+		}
+		w.rows = append(w.rows, values)
+	}
+	return iter.Err()
+}
+
+func (w *recordCacheWriter) UpsertRows(_ context.Context, rows [][]interface{}) error {
+	w.rows = append(w.rows, rows...)
+	return nil
+}
+
+func (w *recordCacheWriter) TargetTable() *psqlfront.Table {
+	return w.table
+}
+
+func (w *recordCacheWriter) CacheValidators(_ context.Context) (*psqlfront.CacheValidators, error) {
+	if w.validators == nil {
+		return &psqlfront.CacheValidators{}, nil
+	}
+	return w.validators, nil
+}
+
+func (w *recordCacheWriter) SetCacheValidators(_ context.Context, v *psqlfront.CacheValidators) error {
+	w.validators = v
+	return nil
+}
+
+func (w *recordCacheWriter) Watermark(_ context.Context) (string, error) {
+	return "", nil
+}
+
+func TestOriginRefreshCacheConditional(t *testing.T) {
+	var requests []http.Header
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Clone())
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 01 Aug 2022 00:00:00 GMT")
+		w.Write([]byte("id,name\n1,hoge\n"))
+	}))
+	defer s.Close()
+	cfg := &httporigin.OriginConfig{
+		Schema: "public",
+		Tables: []*httporigin.TableConfig{
+			{
+				BaseTableConfig: origin.BaseTableConfig{
+					Name: "users",
+				},
+				URLString:       s.URL,
+				IgnoreLines:     1,
+				SchemaDetection: true,
+			},
+		},
+	}
+	require.NoError(t, cfg.Restrict())
+	o, err := cfg.NewOrigin("http")
+	require.NoError(t, err)
+	w := &recordCacheWriter{
+		table: &psqlfront.Table{SchemaName: "public", RelName: "users"},
+	}
+	requests = nil
+
+	require.NoError(t, o.RefreshCache(context.Background(), w))
+	require.EqualValues(t, [][]interface{}{{int64(1), "hoge"}}, w.rows)
+	require.EqualValues(t, &psqlfront.CacheValidators{
+		ETag:         `"v1"`,
+		LastModified: "Mon, 01 Aug 2022 00:00:00 GMT",
+	}, w.validators)
+	require.Len(t, requests, 1, "schema detection and fetch rows share one request")
+	require.Empty(t, requests[0].Get("If-None-Match"))
+
+	err = o.RefreshCache(context.Background(), w)
+	require.ErrorIs(t, err, psqlfront.ErrNotModified)
+	require.Len(t, requests, 2)
+	require.Equal(t, `"v1"`, requests[1].Get("If-None-Match"))
+	require.Equal(t, "Mon, 01 Aug 2022 00:00:00 GMT", requests[1].Get("If-Modified-Since"))
+	require.EqualValues(t, [][]interface{}{{int64(1), "hoge"}}, w.rows, "rows are kept")
+}
+
+func TestOriginRefreshCacheRetry(t *testing.T) {
+	var requests int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("id,name\n1,hoge\n"))
+	}))
+	defer s.Close()
+	cfg := &httporigin.OriginConfig{
+		RetryPolicyConfig: origin.RetryPolicyConfig{
+			Retry: &origin.RetryConfig{
+				MinInterval: time.Millisecond,
+				MaxInterval: time.Millisecond,
+			},
+		},
+		Schema: "public",
+		Tables: []*httporigin.TableConfig{
+			{
+				BaseTableConfig: origin.BaseTableConfig{
+					Name: "users",
+					Columns: origin.ColumnConfigs{
+						{Name: "id", DataType: "BIGINT"},
+						{Name: "name", DataType: "TEXT"},
+					},
+				},
+				URLString:   s.URL,
+				IgnoreLines: 1,
+			},
+		},
+	}
+	require.NoError(t, cfg.Restrict())
+	o, err := cfg.NewOrigin("http")
+	require.NoError(t, err)
+	w := &recordCacheWriter{
+		table: &psqlfront.Table{SchemaName: "public", RelName: "users"},
+	}
+	require.NoError(t, o.RefreshCache(context.Background(), w))
+	require.Equal(t, 2, requests, "retried after 502")
+	require.EqualValues(t, [][]interface{}{{int64(1), "hoge"}}, w.rows)
+}
@@ -0,0 +1,183 @@
+package origin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// HTTPClientConfig is the settings of requests to HTTP based origins.
+// Secrets can be taken from the environment by the config template, such as `{{ must_env "API_TOKEN" }}`.
+type HTTPClientConfig struct {
+	Headers     map[string]string `yaml:"headers,omitempty"`
+	BasicAuth   *BasicAuthConfig  `yaml:"basic_auth,omitempty"`
+	BearerToken string            `yaml:"bearer_token,omitempty"`
+	OAuth2      *OAuth2Config     `yaml:"oauth2,omitempty"`
+
+	client *http.Client `yaml:"-"`
+}
+
+type BasicAuthConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// OAuth2Config is the settings of the OAuth2 client credentials flow.
+type OAuth2Config struct {
+	TokenURL       string            `yaml:"token_url"`
+	ClientID       string            `yaml:"client_id"`
+	ClientSecret   string            `yaml:"client_secret"`
+	Scopes         []string          `yaml:"scopes,omitempty"`
+	EndpointParams map[string]string `yaml:"endpoint_params,omitempty"`
+}
+
+func (cfg *HTTPClientConfig) hasAuth() bool {
+	return cfg.BasicAuth != nil || cfg.BearerToken != "" || cfg.OAuth2 != nil
+}
+
+// Inherit fills the settings from the parent, such as the origin level settings.
+// Headers are merged, and the authentication is inherited only if no authentication is set.
+func (cfg *HTTPClientConfig) Inherit(parent *HTTPClientConfig) {
+	if parent == nil {
+		return
+	}
+	if len(parent.Headers) > 0 {
+		headers := make(map[string]string, len(parent.Headers)+len(cfg.Headers))
+		for k, v := range parent.Headers {
+			headers[k] = v
+		}
+		for k, v := range cfg.Headers {
+			headers[k] = v
+		}
+		cfg.Headers = headers
+	}
+	if !cfg.hasAuth() {
+		cfg.BasicAuth = parent.BasicAuth
+		cfg.BearerToken = parent.BearerToken
+		cfg.OAuth2 = parent.OAuth2
+	}
+}
+
+// Restrict validates the settings, and prepares the client for the origin of u.
+// The headers and the authentication are sent only to the host of u, not to the other hosts of the redirects and the next pages.
+func (cfg *HTTPClientConfig) Restrict(u *url.URL) error {
+	numAuth := 0
+	if cfg.BasicAuth != nil {
+		numAuth++
+		if cfg.BasicAuth.Username == "" {
+			return errors.New("basic_auth: username is required")
+		}
+	}
+	if cfg.BearerToken != "" {
+		numAuth++
+	}
+	var auth http.RoundTripper
+	if cfg.OAuth2 != nil {
+		numAuth++
+		if err := cfg.OAuth2.Restrict(); err != nil {
+			return err
+		}
+		auth = cfg.OAuth2.Client().Transport
+	}
+	if numAuth > 1 {
+		return errors.New("only one of basic_auth, bearer_token and oauth2 can be set")
+	}
+	cfg.client = &http.Client{
+		Transport: &headerTransport{
+			cfg:    cfg,
+			target: u,
+			auth:   auth,
+		},
+	}
+	return nil
+}
+
+func (cfg *OAuth2Config) Restrict() error {
+	if cfg.TokenURL == "" {
+		return errors.New("oauth2: token_url is required")
+	}
+	if _, err := url.Parse(cfg.TokenURL); err != nil {
+		return errors.New("oauth2: token_url is invalid")
+	}
+	if cfg.ClientID == "" {
+		return errors.New("oauth2: client_id is required")
+	}
+	return nil
+}
+
+// Client returns the client that fetches and refreshes the access token automatically.
+func (cfg *OAuth2Config) Client() *http.Client {
+	c := &clientcredentials.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		TokenURL:     cfg.TokenURL,
+		Scopes:       cfg.Scopes,
+	}
+	if len(cfg.EndpointParams) > 0 {
+		c.EndpointParams = make(url.Values, len(cfg.EndpointParams))
+		for k, v := range cfg.EndpointParams {
+			c.EndpointParams.Set(k, v)
+		}
+	}
+	return c.Client(context.Background())
+}
+
+// HTTPClient returns the client that sets the headers and the authentication to each request.
+func (cfg *HTTPClientConfig) HTTPClient() *http.Client {
+	if cfg.client == nil {
+		return http.DefaultClient
+	}
+	return cfg.client
+}
+
+type headerTransport struct {
+	cfg    *HTTPClientConfig
+	target *url.URL
+	// auth sends the requests to the target with the access token of OAuth2, if set.
+	auth http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isSameOrigin(t.target, req.URL) {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	for k, v := range t.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if t.cfg.BasicAuth != nil {
+		req.SetBasicAuth(t.cfg.BasicAuth.Username, t.cfg.BasicAuth.Password)
+	}
+	if t.cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+t.cfg.BearerToken)
+	}
+	if t.auth != nil {
+		return t.auth.RoundTrip(req)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// isSameOrigin returns true if u is the host and the port of target, or the upgrade of target from http to https on the same host.
+func isSameOrigin(target *url.URL, u *url.URL) bool {
+	if target == nil || !strings.EqualFold(target.Hostname(), u.Hostname()) {
+		return false
+	}
+	if target.Scheme == "http" && u.Scheme == "https" {
+		return true
+	}
+	return target.Scheme == u.Scheme && portOrDefault(target) == portOrDefault(u)
+}
+
+func portOrDefault(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if u.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
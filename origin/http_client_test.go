@@ -0,0 +1,161 @@
+package origin_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/mashiike/psql-front/origin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPClientConfig(t *testing.T) {
+	var tokenRequests int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			tokenRequests++
+			id, secret, _ := r.BasicAuth()
+			if id != "client" || secret != "secret" || r.FormValue("audience") != "api" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"access_token":"issued-token","token_type":"bearer","expires_in":3600}`)
+		default:
+			fmt.Fprintf(w, "%s|%s", r.Header.Get("Authorization"), r.Header.Get("X-Api-Key"))
+		}
+	}))
+	defer s.Close()
+
+	cases := []struct {
+		name     string
+		parent   *origin.HTTPClientConfig
+		cfg      *origin.HTTPClientConfig
+		expected string
+	}{
+		{
+			name:     "no auth",
+			cfg:      &origin.HTTPClientConfig{},
+			expected: "|",
+		},
+		{
+			name: "headers and basic auth",
+			cfg: &origin.HTTPClientConfig{
+				Headers:   map[string]string{"X-Api-Key": "key"},
+				BasicAuth: &origin.BasicAuthConfig{Username: "user", Password: "pass"},
+			},
+			expected: "Basic dXNlcjpwYXNz|key",
+		},
+		{
+			name: "inherit bearer token",
+			parent: &origin.HTTPClientConfig{
+				Headers:     map[string]string{"X-Api-Key": "origin"},
+				BearerToken: "origin-token",
+			},
+			cfg: &origin.HTTPClientConfig{
+				Headers: map[string]string{"X-Api-Key": "table"},
+			},
+			expected: "Bearer origin-token|table",
+		},
+		{
+			name: "oauth2 client credentials",
+			parent: &origin.HTTPClientConfig{
+				BearerToken: "origin-token",
+			},
+			cfg: &origin.HTTPClientConfig{
+				OAuth2: &origin.OAuth2Config{
+					TokenURL:       s.URL + "/token",
+					ClientID:       "client",
+					ClientSecret:   "secret",
+					EndpointParams: map[string]string{"audience": "api"},
+				},
+			},
+			expected: "Bearer issued-token|",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.cfg.Inherit(c.parent)
+			u, err := url.Parse(s.URL + "/data")
+			require.NoError(t, err)
+			require.NoError(t, c.cfg.Restrict(u))
+			for i := 0; i < 2; i++ {
+				resp, err := c.cfg.HTTPClient().Get(s.URL + "/data")
+				require.NoError(t, err)
+				body, err := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				require.NoError(t, err)
+				require.Equal(t, c.expected, string(body))
+			}
+		})
+	}
+	require.Equal(t, 1, tokenRequests, "access token is reused")
+}
+
+func TestHTTPClientConfigRestrictInvalid(t *testing.T) {
+	cases := []origin.HTTPClientConfig{
+		{BasicAuth: &origin.BasicAuthConfig{}},
+		{BasicAuth: &origin.BasicAuthConfig{Username: "user"}, BearerToken: "token"},
+		{OAuth2: &origin.OAuth2Config{ClientID: "client"}},
+		{OAuth2: &origin.OAuth2Config{TokenURL: "https://example.com/token"}},
+	}
+	u, err := url.Parse("https://example.com/data")
+	require.NoError(t, err)
+	for _, c := range cases {
+		require.Error(t, c.Restrict(u), "%#v", c)
+	}
+}
+
+func TestHTTPClientConfigOtherHost(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s", r.Header.Get("Authorization"), r.Header.Get("X-Api-Key"))
+	}))
+	defer other.Close()
+	var tokenRequests int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			tokenRequests++
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"access_token":"issued-token","token_type":"bearer","expires_in":3600}`)
+		default:
+			http.Redirect(w, r, other.URL+"/data", http.StatusFound)
+		}
+	}))
+	defer s.Close()
+
+	cases := []*origin.HTTPClientConfig{
+		{
+			Headers:     map[string]string{"X-Api-Key": "key"},
+			BearerToken: "token",
+		},
+		{
+			Headers:   map[string]string{"X-Api-Key": "key"},
+			BasicAuth: &origin.BasicAuthConfig{Username: "user", Password: "pass"},
+		},
+		{
+			OAuth2: &origin.OAuth2Config{
+				TokenURL: s.URL + "/token",
+				ClientID: "client",
+			},
+		},
+	}
+	for _, cfg := range cases {
+		u, err := url.Parse(s.URL + "/data")
+		require.NoError(t, err)
+		require.NoError(t, cfg.Restrict(u))
+		for _, target := range []string{s.URL + "/data", other.URL + "/data"} {
+			resp, err := cfg.HTTPClient().Get(target)
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			require.NoError(t, err)
+			require.Equal(t, "|", string(body), "the credentials are not sent to %s", other.URL)
+		}
+	}
+	require.Equal(t, 1, tokenRequests, "access token is requested only for the origin")
+}
@@ -0,0 +1,62 @@
+package origin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/samber/lo"
+)
+
+// IncrementalConfig is the config of the incremental refresh.
+// The origin fetches only the rows newer than the watermark, and the rows are upserted by the key columns instead of reloading all rows.
+type IncrementalConfig struct {
+	KeyColumns      []string `yaml:"key_columns"`
+	WatermarkColumn string   `yaml:"watermark_column"`
+}
+
+func (cfg *IncrementalConfig) Restrict(columns ColumnConfigs) error {
+	if len(cfg.KeyColumns) == 0 {
+		return errors.New("key_columns is required")
+	}
+	if cfg.WatermarkColumn == "" {
+		return errors.New("watermark_column is required")
+	}
+	names := lo.Map(columns, func(c *ColumnConfig, _ int) string {
+		return strings.ToLower(c.Name)
+	})
+	for _, name := range append([]string{cfg.WatermarkColumn}, cfg.KeyColumns...) {
+		if !lo.Contains(names, strings.ToLower(name)) {
+			return fmt.Errorf("column `%s` not found in columns", name)
+		}
+	}
+	return nil
+}
+
+// Apply sets the key columns and the watermark column to the table.
+func (cfg *IncrementalConfig) Apply(t *psqlfront.Table) *psqlfront.Table {
+	if cfg == nil {
+		return t
+	}
+	t.KeyColumns = cfg.KeyColumns
+	t.WatermarkColumn = cfg.WatermarkColumn
+	return t
+}
+
+// ErrIncrementalNotSupported is returned when `incremental` is set to the table of the origin which can not refresh incrementally.
+var ErrIncrementalNotSupported = errors.New("incremental is not supported by this origin type, only PostgreSQL origin supports it")
+
+// NoIncrementalConfig is embedded in the table config of the origin which can not refresh incrementally,
+// so that `incremental` is rejected instead of being ignored silently.
+type NoIncrementalConfig struct {
+	Incremental *IncrementalConfig `yaml:"incremental,omitempty"`
+}
+
+// RestrictIncremental returns ErrIncrementalNotSupported if `incremental` is set.
+func (cfg *NoIncrementalConfig) RestrictIncremental() error {
+	if cfg.Incremental != nil {
+		return ErrIncrementalNotSupported
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package origin_test
+
+import (
+	"testing"
+
+	"github.com/mashiike/psql-front/origin"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestIncrementalConfigRestrict(t *testing.T) {
+	columns := origin.ColumnConfigs{
+		{Name: "id", DataType: "BIGINT"},
+		{Name: "updated_at", DataType: "TIMESTAMP"},
+	}
+	cases := []struct {
+		name        string
+		cfg         origin.IncrementalConfig
+		expectedErr string
+	}{
+		{
+			name: "valid",
+			cfg:  origin.IncrementalConfig{KeyColumns: []string{"ID"}, WatermarkColumn: "updated_at"},
+		},
+		{
+			name:        "no key columns",
+			cfg:         origin.IncrementalConfig{WatermarkColumn: "updated_at"},
+			expectedErr: "key_columns is required",
+		},
+		{
+			name:        "no watermark column",
+			cfg:         origin.IncrementalConfig{KeyColumns: []string{"id"}},
+			expectedErr: "watermark_column is required",
+		},
+		{
+			name:        "unknown column",
+			cfg:         origin.IncrementalConfig{KeyColumns: []string{"id"}, WatermarkColumn: "created_at"},
+			expectedErr: "column `created_at` not found in columns",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.cfg.Restrict(columns)
+			if c.expectedErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, c.expectedErr)
+		})
+	}
+}
+
+func TestNoIncrementalConfig(t *testing.T) {
+	var cfg struct {
+		origin.BaseTableConfig     `yaml:",inline"`
+		origin.NoIncrementalConfig `yaml:",inline"`
+	}
+	require.NoError(t, yaml.Unmarshal([]byte("name: hoge\n"), &cfg))
+	require.NoError(t, cfg.RestrictIncremental())
+	require.NoError(t, yaml.Unmarshal([]byte("name: hoge\nincremental:\n  key_columns: [id]\n  watermark_column: updated_at\n"), &cfg))
+	require.ErrorIs(t, cfg.RestrictIncremental(), origin.ErrIncrementalNotSupported)
+}
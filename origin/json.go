@@ -0,0 +1,275 @@
+package origin
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	json "github.com/goccy/go-json"
+)
+
+// JSONPathSegment is a part of a JSON path, a key of an object or an index of an array.
+type JSONPathSegment struct {
+	Key   string
+	Index *int
+}
+
+// ParseJSONPath parses a simple dot notation path such as `$.data.items` or `items[0].name`.
+// An empty path or `$` means the root value.
+func ParseJSONPath(path string) ([]JSONPathSegment, error) {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+	path = strings.TrimPrefix(path, ".")
+	if path == "" {
+		return nil, nil
+	}
+	segments := make([]JSONPathSegment, 0)
+	for _, part := range strings.Split(path, ".") {
+		key := part
+		var indexes []int
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			key = part[:i]
+			rest := part[i:]
+			for rest != "" {
+				if rest[0] != '[' {
+					return nil, fmt.Errorf("invalid path `%s`", path)
+				}
+				end := strings.IndexByte(rest, ']')
+				if end < 0 {
+					return nil, fmt.Errorf("invalid path `%s`: missing ]", path)
+				}
+				index, err := strconv.Atoi(rest[1:end])
+				if err != nil {
+					return nil, fmt.Errorf("invalid path `%s`: %w", path, err)
+				}
+				indexes = append(indexes, index)
+				rest = rest[end+1:]
+			}
+		}
+		if key == "" && len(indexes) == 0 {
+			return nil, fmt.Errorf("invalid path `%s`: empty key", path)
+		}
+		if key != "" {
+			segments = append(segments, JSONPathSegment{Key: key})
+		}
+		for _, index := range indexes {
+			index := index
+			segments = append(segments, JSONPathSegment{Index: &index})
+		}
+	}
+	return segments, nil
+}
+
+// LookupJSONPath returns the value at path, if not found returns false.
+func LookupJSONPath(v interface{}, segments []JSONPathSegment) (interface{}, bool) {
+	for _, s := range segments {
+		if s.Index != nil {
+			a, ok := v.([]interface{})
+			if !ok || *s.Index < 0 || *s.Index >= len(a) {
+				return nil, false
+			}
+			v = a[*s.Index]
+			continue
+		}
+		o, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		v, ok = o[s.Key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// DecodeJSON decodes data with numbers kept as json.Number.
+func DecodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func readJSONRecords(r io.Reader, path string, columns ColumnConfigs) ([][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	v, err := DecodeJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode json: %w", err)
+	}
+	return JSONValueToRecords(v, path, columns)
+}
+
+// JSONValueToRecords converts the objects at path in the decoded JSON value to records, the first record is the header.
+func JSONValueToRecords(v interface{}, path string, columns ColumnConfigs) ([][]string, error) {
+	segments, err := ParseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := LookupJSONPath(v, segments)
+	if !ok {
+		return nil, fmt.Errorf("json_path `%s` not found", path)
+	}
+	var objects []interface{}
+	switch v := v.(type) {
+	case []interface{}:
+		objects = v
+	case nil:
+	default:
+		objects = []interface{}{v}
+	}
+	return objectsToRecords(objects, columns, false)
+}
+
+func readJSONLinesRecords(r io.Reader, columns ColumnConfigs) ([][]string, error) {
+	objects := make([]interface{}, 0)
+	reader := bufio.NewReader(r)
+	lineNumber := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		lineNumber++
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			v, decodeErr := DecodeJSON(trimmed)
+			if decodeErr != nil {
+				return nil, fmt.Errorf("decode json line %d: %w", lineNumber, decodeErr)
+			}
+			objects = append(objects, v)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+	return objectsToRecords(objects, columns, false)
+}
+
+// objectsToRecords converts JSON objects to records, the first record is the header.
+// If literal is true, the path of the column is the key as is, not a JSON path.
+func objectsToRecords(objects []interface{}, columns ColumnConfigs, literal bool) ([][]string, error) {
+	var p *objectProjection
+	if len(columns) == 0 {
+		keys := make(map[string]struct{})
+		for _, obj := range objects {
+			if o, ok := obj.(map[string]interface{}); ok {
+				for key := range o {
+					keys[key] = struct{}{}
+				}
+			}
+		}
+		p = &objectProjection{}
+		for key := range keys {
+			p.header = append(p.header, key)
+		}
+		sort.Strings(p.header)
+		for _, key := range p.header {
+			p.paths = append(p.paths, []JSONPathSegment{{Key: key}})
+		}
+	} else {
+		var err error
+		if p, err = newObjectProjection(columns, literal); err != nil {
+			return nil, err
+		}
+	}
+	records := make([][]string, 0, len(objects)+1)
+	records = append(records, p.header)
+	for _, obj := range objects {
+		record, err := p.record(obj)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// objectProjection picks up the fields of the objects as the records of the columns.
+type objectProjection struct {
+	header []string
+	paths  [][]JSONPathSegment
+}
+
+// newObjectProjection returns the projection of the columns, if literal is true, the path of the column is the key as is, such as the label of LTSV.
+func newObjectProjection(columns ColumnConfigs, literal bool) (*objectProjection, error) {
+	width := len(columns)
+	for _, c := range columns {
+		if c.ColumnIndex != nil && *c.ColumnIndex >= width {
+			width = *c.ColumnIndex + 1
+		}
+	}
+	p := &objectProjection{
+		header: make([]string, width),
+		paths:  make([][]JSONPathSegment, width),
+	}
+	for i, c := range columns {
+		index := i
+		if c.ColumnIndex != nil {
+			index = *c.ColumnIndex
+		}
+		p.header[index] = c.Name
+		if c.Path == "" {
+			// the column name is the key as is, such as `user.id`.
+			p.paths[index] = []JSONPathSegment{{Key: c.Name}}
+			continue
+		}
+		if literal {
+			p.paths[index] = []JSONPathSegment{{Key: c.Path}}
+			continue
+		}
+		segments, err := ParseJSONPath(c.Path)
+		if err != nil {
+			return nil, fmt.Errorf("column %s path: %w", c.Name, err)
+		}
+		p.paths[index] = segments
+	}
+	return p, nil
+}
+
+func (p *objectProjection) record(obj interface{}) ([]string, error) {
+	record := make([]string, len(p.paths))
+	for i, segments := range p.paths {
+		if segments == nil {
+			continue
+		}
+		v, ok := LookupJSONPath(obj, segments)
+		if !ok {
+			continue
+		}
+		s, err := jsonValueToString(v)
+		if err != nil {
+			return nil, err
+		}
+		record[i] = s
+	}
+	return record, nil
+}
+
+func jsonValueToString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		bs, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(bs), nil
+	}
+}
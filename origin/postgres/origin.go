@@ -0,0 +1,294 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/mashiike/psql-front/origin"
+	"github.com/samber/lo"
+)
+
+const OriginType = "PostgreSQL"
+
+func init() {
+	psqlfront.RegisterOriginType(OriginType, func() psqlfront.OriginConfig {
+		return &OriginConfig{}
+	})
+	log.Printf("[info] load origin type: %s", OriginType)
+}
+
+type Origin struct {
+	id     string
+	schema string
+	tables []*TableConfig
+}
+
+func (o *Origin) ID() string {
+	return o.id
+}
+
+func (o *Origin) GetTables(_ context.Context) ([]*psqlfront.Table, error) {
+	return lo.Map(o.tables, func(cfg *TableConfig, _ int) *psqlfront.Table {
+		return cfg.ToTable()
+	}), nil
+}
+
+func (o *Origin) RefreshCache(ctx context.Context, w psqlfront.CacheWriter) error {
+	table := w.TargetTable()
+	if o.schema != table.SchemaName {
+		return psqlfront.WrapOriginNotFoundError(errors.New("origin schema is missmatch"))
+	}
+	for _, t := range o.tables {
+		if t.Name != table.RelName {
+			continue
+		}
+		return o.refreshCache(ctx, w, t)
+	}
+	return psqlfront.WrapOriginNotFoundError(errors.New("origin table not found"))
+}
+
+func (o *Origin) refreshCache(ctx context.Context, w psqlfront.CacheWriter, cfg *TableConfig) error {
+	remoteAddr := psqlfront.GetRemoteAddr(ctx)
+	if cfg.schemaDetectionFailed {
+		if err := cfg.detectSchemaLazily(ctx); err != nil {
+			return fmt.Errorf("try get %s origin: %w", w.TargetTable().String(), err)
+		}
+		if err := w.ReplaceCacheTable(ctx, cfg.ToTable()); err != nil {
+			return err
+		}
+	}
+	var watermark interface{}
+	if cfg.Incremental != nil {
+		v, err := w.Watermark(ctx)
+		if err != nil {
+			return err
+		}
+		if v != "" {
+			watermark = v
+		}
+	}
+	if watermark == nil {
+		if err := w.DeleteRows(ctx); err != nil {
+			return err
+		}
+	}
+	log.Printf("[debug][%s] execute origin query: %s; %v", remoteAddr, cfg.Query, watermark)
+	rows, err := cfg.query(ctx, watermark)
+	if err != nil {
+		return fmt.Errorf("try get %s origin: %w", w.TargetTable().String(), err)
+	}
+	defer rows.Close()
+	iter := &rowIterator{Rows: rows, cfg: cfg}
+	if watermark == nil {
+		if err := w.AppendRowIterator(ctx, iter); err != nil {
+			return fmt.Errorf("try get %s origin: %w", w.TargetTable().String(), err)
+		}
+		return nil
+	}
+	log.Printf("[info][%s] %s incremental refresh from watermark %v", remoteAddr, w.TargetTable(), watermark)
+	buf := make([][]interface{}, 0, upsertBatchSize)
+	for iter.Next() {
+		values, err := iter.Values()
+		if err != nil {
+			return fmt.Errorf("try get %s origin: %w", w.TargetTable().String(), err)
+		}
+		buf = append(buf, values)
+		if len(buf) >= upsertBatchSize {
+			if err := w.UpsertRows(ctx, buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("try get %s origin: %w", w.TargetTable().String(), err)
+	}
+	return w.UpsertRows(ctx, buf)
+}
+
+// upsertBatchSize is the number of rows buffered before passing to CacheWriter.UpsertRows.
+const upsertBatchSize = 10000
+
+// query executes the query of the table. For the incremental refresh, the watermark is passed as $1, and it is NULL at the first refresh.
+func (cfg *TableConfig) query(ctx context.Context, watermark interface{}) (pgx.Rows, error) {
+	if cfg.Incremental == nil {
+		return cfg.pool.Query(ctx, cfg.Query)
+	}
+	// the watermark is a text, so it is embedded as a literal to be coerced to the type of the watermark column.
+	return cfg.pool.Query(ctx, cfg.Query, pgx.QuerySimpleProtocol(true), watermark)
+}
+
+// rowIterator converts the values of the origin query result by the table columns.
+type rowIterator struct {
+	pgx.Rows
+	cfg *TableConfig
+}
+
+func (it *rowIterator) Values() ([]interface{}, error) {
+	values, err := it.Rows.Values()
+	if err != nil {
+		return nil, err
+	}
+	return it.cfg.toRow(values), nil
+}
+
+type OriginConfig struct {
+	Schema string         `yaml:"schema"`
+	DSN    string         `yaml:"dsn"`
+	Tables []*TableConfig `yaml:"tables"`
+
+	pool *pgxpool.Pool `yaml:"-"`
+}
+
+type TableConfig struct {
+	origin.BaseTableConfig `yaml:",inline"`
+
+	Query       string                    `yaml:"query"`
+	Incremental *origin.IncrementalConfig `yaml:"incremental"`
+
+	pool                  *pgxpool.Pool `yaml:"-"`
+	schemaDetectionFailed bool          `yaml:"-"`
+}
+
+func (cfg *OriginConfig) Type() string {
+	return OriginType
+}
+
+func (cfg *OriginConfig) Restrict() error {
+	if cfg.Schema == "" {
+		cfg.Schema = "public"
+	}
+	if cfg.DSN == "" {
+		return errors.New("dsn is required")
+	}
+	poolConfig, err := pgxpool.ParseConfig(cfg.DSN)
+	if err != nil {
+		return fmt.Errorf("dsn is invalid: %w", err)
+	}
+	poolConfig.LazyConnect = true
+	cfg.pool, err = pgxpool.ConnectConfig(context.Background(), poolConfig)
+	if err != nil {
+		return fmt.Errorf("unable to create connection pool: %w", err)
+	}
+	for i, table := range cfg.Tables {
+		if err := table.Restrict(cfg.Schema, cfg.pool); err != nil {
+			return fmt.Errorf("table[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (cfg *OriginConfig) NewOrigin(id string) (psqlfront.Origin, error) {
+	return &Origin{
+		id:     id,
+		schema: cfg.Schema,
+		tables: cfg.Tables,
+	}, nil
+}
+
+func (cfg *TableConfig) Restrict(schema string, pool *pgxpool.Pool) error {
+	cfg.pool = pool
+	if cfg.Query == "" {
+		return errors.New("query is required")
+	}
+	if len(cfg.Columns) == 0 {
+		if err := cfg.DetectSchema(context.Background()); err != nil {
+			// the origin database may be down at startup, so the schema is detected again at the first refresh.
+			log.Printf("[warn] %s.%s initial schema detection failed: %v", schema, cfg.Name, err)
+			cfg.schemaDetectionFailed = true
+			cfg.Columns = origin.ColumnConfigs{
+				{
+					Name:     "dummy",
+					DataType: "VARCHAR",
+				},
+			}
+		}
+	}
+	if err := cfg.BaseTableConfig.Restrict(schema); err != nil {
+		return err
+	}
+	if cfg.Incremental != nil && !cfg.schemaDetectionFailed {
+		if err := cfg.Incremental.Restrict(cfg.Columns); err != nil {
+			return fmt.Errorf("incremental: %w", err)
+		}
+	}
+	return nil
+}
+
+// detectSchemaLazily detects the schema which failed to be detected at startup.
+func (cfg *TableConfig) detectSchemaLazily(ctx context.Context) error {
+	if err := cfg.DetectSchema(ctx); err != nil {
+		return fmt.Errorf("schema detection: %w", err)
+	}
+	if cfg.Incremental != nil {
+		if err := cfg.Incremental.Restrict(cfg.Columns); err != nil {
+			return fmt.Errorf("incremental: %w", err)
+		}
+	}
+	cfg.schemaDetectionFailed = false
+	return nil
+}
+
+func (cfg *TableConfig) ToTable() *psqlfront.Table {
+	if cfg.schemaDetectionFailed {
+		// the dummy table has no key columns and watermark column.
+		return cfg.BaseTableConfig.ToTable()
+	}
+	return cfg.Incremental.Apply(cfg.BaseTableConfig.ToTable())
+}
+
+// DetectSchema sets columns from the field descriptions of the query result.
+func (cfg *TableConfig) DetectSchema(ctx context.Context) error {
+	conn, err := cfg.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	sd, err := conn.Conn().Prepare(ctx, "", cfg.Query)
+	if err != nil {
+		return err
+	}
+	connInfo := conn.Conn().ConnInfo()
+	columns := make(origin.ColumnConfigs, 0, len(sd.Fields))
+	for i, field := range sd.Fields {
+		index := i
+		dataType := "TEXT"
+		if dt, ok := connInfo.DataTypeForOID(field.DataTypeOID); ok {
+			dataType = strings.ToUpper(dt.Name)
+		}
+		columns = append(columns, &origin.ColumnConfig{
+			Name:        string(field.Name),
+			DataType:    dataType,
+			ColumnIndex: &index,
+		})
+	}
+	cfg.Columns = columns
+	return nil
+}
+
+func (cfg *TableConfig) toRow(values []interface{}) []interface{} {
+	row := make([]interface{}, 0, len(cfg.Columns))
+	for i, c := range cfg.Columns {
+		index := i
+		if c.ColumnIndex != nil {
+			index = *c.ColumnIndex
+		}
+		if index >= len(values) {
+			row = append(row, nil)
+			continue
+		}
+		// unknown types are returned as raw bytes, store them as text.
+		if b, ok := values[index].([]byte); ok && !strings.EqualFold(c.DataType, "BYTEA") {
+			row = append(row, string(b))
+			continue
+		}
+		row = append(row, values[index])
+	}
+	return row
+}
@@ -0,0 +1,37 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mashiike/psql-front/origin"
+	"github.com/mashiike/psql-front/origin/postgres"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOriginConfigRestrictSchemaDetectionFailed(t *testing.T) {
+	cfg := &postgres.OriginConfig{
+		Schema: "example",
+		DSN:    "postgres://postgres@127.0.0.1:1/postgres?connect_timeout=1",
+		Tables: []*postgres.TableConfig{
+			{
+				BaseTableConfig: origin.BaseTableConfig{
+					Name: "hoge",
+				},
+				Query: "SELECT id, updated_at FROM hoge",
+				Incremental: &origin.IncrementalConfig{
+					KeyColumns:      []string{"id"},
+					WatermarkColumn: "updated_at",
+				},
+			},
+		},
+	}
+	require.NoError(t, cfg.Restrict(), "the origin database is down at startup")
+	o, err := cfg.NewOrigin("origin")
+	require.NoError(t, err)
+	tables, err := o.GetTables(context.Background())
+	require.NoError(t, err)
+	require.Len(t, tables, 1)
+	require.Equal(t, "dummy", tables[0].Columns[0].Name)
+	require.False(t, tables[0].IsIncremental())
+}
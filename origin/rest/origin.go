@@ -0,0 +1,477 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Songmu/flextime"
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/mashiike/psql-front/origin"
+	"github.com/samber/lo"
+)
+
+const OriginType = "REST"
+
+const (
+	PaginationNone   = "none"
+	PaginationLink   = "link"
+	PaginationCursor = "cursor"
+	PaginationOffset = "offset"
+)
+
+var supportedPaginations = []string{PaginationNone, PaginationLink, PaginationCursor, PaginationOffset}
+
+// DefaultMaxPages is max_pages if it is not set, so that a broken pagination does not request forever.
+const DefaultMaxPages = 1000
+
+func init() {
+	psqlfront.RegisterOriginType(OriginType, func() psqlfront.OriginConfig {
+		return &OriginConfig{}
+	})
+	log.Printf("[info] load origin type: %s", OriginType)
+}
+
+type Origin struct {
+	id     string
+	schema string
+	tables []*TableConfig
+}
+
+func (o *Origin) ID() string {
+	return o.id
+}
+
+func (o *Origin) GetTables(_ context.Context) ([]*psqlfront.Table, error) {
+	return lo.Map(o.tables, func(cfg *TableConfig, _ int) *psqlfront.Table {
+		return cfg.ToTable()
+	}), nil
+}
+
+func (o *Origin) RefreshCache(ctx context.Context, w psqlfront.CacheWriter) error {
+	table := w.TargetTable()
+	if o.schema != table.SchemaName {
+		return psqlfront.WrapOriginNotFoundError(errors.New("origin schema is missmatch"))
+	}
+	for _, t := range o.tables {
+		if t.Name != table.RelName {
+			continue
+		}
+		return o.refreshCache(ctx, w, t)
+	}
+	return psqlfront.WrapOriginNotFoundError(errors.New("origin table not found"))
+}
+
+func (o *Origin) refreshCache(ctx context.Context, w psqlfront.CacheWriter, cfg *TableConfig) error {
+	if cfg.SchemaDetection {
+		if err := cfg.DetectSchema(ctx); err != nil {
+			return err
+		}
+		if err := w.ReplaceCacheTable(ctx, cfg.ToTable()); err != nil {
+			return err
+		}
+	} else {
+		if err := w.DeleteRows(ctx); err != nil {
+			return err
+		}
+	}
+	err := cfg.EachPage(ctx, func(records [][]string) error {
+		return w.AppendRows(ctx, cfg.Columns.ToRows(records, 1))
+	})
+	if err != nil {
+		return fmt.Errorf("try get %s origin: %w", w.TargetTable().String(), err)
+	}
+	return nil
+}
+
+type OriginConfig struct {
+	origin.HTTPClientConfig  `yaml:",inline"`
+	origin.RetryPolicyConfig `yaml:",inline"`
+
+	Schema string         `yaml:"schema"`
+	Tables []*TableConfig `yaml:"tables"`
+}
+
+type TableConfig struct {
+	origin.BaseTableConfig     `yaml:",inline"`
+	origin.NoIncrementalConfig `yaml:",inline"`
+	origin.HTTPClientConfig    `yaml:",inline"`
+
+	URLString                string            `yaml:"url"`
+	JSONPath                 string            `yaml:"json_path"`
+	Pagination               *PaginationConfig `yaml:"pagination"`
+	SchemaDetection          bool              `yaml:"schema_detection"`
+	DetectedSchemaExpiration time.Duration     `yaml:"detected_schema_expiration"`
+	AllowUnicodeColumnName   bool              `yaml:"allow_unicode_column_name"`
+	URL                      *url.URL          `yaml:"-"`
+	LastSchemaDetection      time.Time         `yaml:"-"`
+
+	retrier *origin.Retrier `yaml:"-"`
+}
+
+// PaginationConfig is how to follow the pages of the API.
+//
+//   - link: follows the `rel="next"` url in the Link header.
+//   - cursor: reads the next cursor at cursor_path in the response body. If the cursor is an url, it is requested as is,
+//     otherwise it is set to cursor_param of the url.
+//   - offset: sets offset_param and limit_param of the url, until a page has less than limit rows.
+type PaginationConfig struct {
+	Type        string        `yaml:"type"`
+	CursorPath  string        `yaml:"cursor_path"`
+	CursorParam string        `yaml:"cursor_param"`
+	OffsetParam string        `yaml:"offset_param"`
+	LimitParam  string        `yaml:"limit_param"`
+	Limit       int           `yaml:"limit"`
+	MaxPages    int           `yaml:"max_pages"`
+	Interval    time.Duration `yaml:"interval"`
+}
+
+func (cfg *OriginConfig) Type() string {
+	return OriginType
+}
+
+func (cfg *OriginConfig) Restrict() error {
+	if cfg.Schema == "" {
+		cfg.Schema = "public"
+	}
+	if err := cfg.RetryPolicyConfig.Restrict(); err != nil {
+		return err
+	}
+	retrier := cfg.NewRetrier()
+	for i, table := range cfg.Tables {
+		table.HTTPClientConfig.Inherit(&cfg.HTTPClientConfig)
+		table.retrier = retrier
+		if err := table.Restrict(cfg.Schema); err != nil {
+			return fmt.Errorf("table[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (cfg *OriginConfig) NewOrigin(id string) (psqlfront.Origin, error) {
+	return &Origin{
+		id:     id,
+		schema: cfg.Schema,
+		tables: cfg.Tables,
+	}, nil
+}
+
+var allowedSchemas = []string{"http", "https"}
+
+func (cfg *TableConfig) Restrict(schema string) error {
+	if err := cfg.RestrictIncremental(); err != nil {
+		return err
+	}
+	if cfg.URLString == "" {
+		return fmt.Errorf("url is required")
+	}
+	var err error
+	if cfg.URL, err = url.Parse(cfg.URLString); err != nil {
+		return fmt.Errorf("url is invalid: %v", err)
+	}
+	if !lo.Contains(allowedSchemas, cfg.URL.Scheme) {
+		return fmt.Errorf("url.schema must %s", strings.Join(allowedSchemas, "/"))
+	}
+	if err := cfg.HTTPClientConfig.Restrict(cfg.URL); err != nil {
+		return err
+	}
+	if _, err := origin.ParseJSONPath(cfg.JSONPath); err != nil {
+		return fmt.Errorf("json_path: %w", err)
+	}
+	if cfg.Pagination == nil {
+		cfg.Pagination = &PaginationConfig{}
+	}
+	if err := cfg.Pagination.Restrict(); err != nil {
+		return fmt.Errorf("pagination: %w", err)
+	}
+	if !cfg.SchemaDetection {
+		if len(cfg.Columns) == 0 {
+			return fmt.Errorf("columns: empty")
+		}
+	} else {
+		if err := cfg.DetectSchema(context.Background()); err != nil {
+			log.Printf("[warn] %s.%s initial schema detection failed: %v", schema, cfg.Name, err)
+			cfg.Columns = origin.ColumnConfigs{
+				{
+					Name:     "dummy",
+					DataType: "VARCHAR",
+				},
+			}
+		}
+	}
+	if err := cfg.BaseTableConfig.Restrict(schema); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cfg *PaginationConfig) Restrict() error {
+	if cfg.Type == "" {
+		cfg.Type = PaginationNone
+	}
+	cfg.Type = strings.ToLower(cfg.Type)
+	switch cfg.Type {
+	case PaginationNone, PaginationLink:
+	case PaginationCursor:
+		if cfg.CursorPath == "" {
+			return errors.New("cursor_path is required")
+		}
+		if _, err := origin.ParseJSONPath(cfg.CursorPath); err != nil {
+			return fmt.Errorf("cursor_path: %w", err)
+		}
+		if cfg.CursorParam == "" {
+			cfg.CursorParam = "cursor"
+		}
+	case PaginationOffset:
+		if cfg.OffsetParam == "" {
+			cfg.OffsetParam = "offset"
+		}
+		if cfg.LimitParam == "" {
+			cfg.LimitParam = "limit"
+		}
+		if cfg.Limit <= 0 {
+			cfg.Limit = 100
+		}
+	default:
+		return fmt.Errorf("type `%s` is not supported, supported types: %s", cfg.Type, strings.Join(supportedPaginations, "/"))
+	}
+	if cfg.MaxPages < 0 {
+		return errors.New("max_pages must be positive")
+	}
+	if cfg.MaxPages == 0 {
+		cfg.MaxPages = DefaultMaxPages
+	}
+	if cfg.Interval < 0 {
+		return errors.New("interval must be positive")
+	}
+	return nil
+}
+
+func (cfg *TableConfig) firstPageURL() *url.URL {
+	u := *cfg.URL
+	if cfg.Pagination.Type == PaginationOffset {
+		q := u.Query()
+		if q.Get(cfg.Pagination.OffsetParam) == "" {
+			q.Set(cfg.Pagination.OffsetParam, "0")
+		}
+		q.Set(cfg.Pagination.LimitParam, strconv.Itoa(cfg.Pagination.Limit))
+		u.RawQuery = q.Encode()
+	}
+	return &u
+}
+
+// EachPage requests pages until the pagination is exhausted or max_pages is reached, and calls fn with the records of each page.
+// The first record of each page is the header.
+// If the next page is the page already requested, such as the same next url or cursor is returned again, an error is returned.
+func (cfg *TableConfig) EachPage(ctx context.Context, fn func(records [][]string) error) error {
+	u := cfg.firstPageURL()
+	requested := map[string]bool{u.String(): true}
+	for page := 1; ; page++ {
+		records, next, err := cfg.fetchPage(ctx, u, cfg.Columns)
+		if err != nil {
+			return err
+		}
+		if err := fn(records); err != nil {
+			return err
+		}
+		if next == nil {
+			return nil
+		}
+		if requested[next.String()] {
+			return fmt.Errorf("pagination loop: next page %s is already requested", next)
+		}
+		requested[next.String()] = true
+		if cfg.Pagination.MaxPages > 0 && page >= cfg.Pagination.MaxPages {
+			remoteAddr := psqlfront.GetRemoteAddr(ctx)
+			log.Printf("[warn][%s] %s reached max_pages %d, remaining pages are ignored", remoteAddr, cfg.Name, cfg.Pagination.MaxPages)
+			return nil
+		}
+		if cfg.Pagination.Interval > 0 {
+			timer := time.NewTimer(cfg.Pagination.Interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		u = next
+	}
+}
+
+// fetchPage requests the page, and retries transient failures.
+func (cfg *TableConfig) fetchPage(ctx context.Context, u *url.URL, columns origin.ColumnConfigs) ([][]string, *url.URL, error) {
+	var records [][]string
+	var next *url.URL
+	err := cfg.retrier.Do(ctx, func(ctx context.Context) error {
+		var err error
+		records, next, err = cfg.fetchPageOnce(ctx, u, columns)
+		return err
+	})
+	return records, next, err
+}
+
+func (cfg *TableConfig) fetchPageOnce(ctx context.Context, u *url.URL, columns origin.ColumnConfigs) ([][]string, *url.URL, error) {
+	remoteAddr := psqlfront.GetRemoteAddr(ctx)
+	log.Printf("[debug][%s] http request: GET %s", remoteAddr, u)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := cfg.HTTPClient().Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GET %s failed: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, nil, &origin.HTTPStatusError{
+			Method:     http.MethodGet,
+			URL:        u.String(),
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GET %s failed: %w", u, err)
+	}
+	body, err := origin.DecodeJSON(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GET %s: decode json: %w", u, err)
+	}
+	records, err := origin.JSONValueToRecords(body, cfg.JSONPath, columns)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GET %s: %w", u, err)
+	}
+	next, err := cfg.nextPageURL(u, resp.Header, body, len(records)-1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GET %s: next page: %w", u, err)
+	}
+	return records, next, nil
+}
+
+func (cfg *TableConfig) nextPageURL(u *url.URL, header http.Header, body interface{}, numRows int) (*url.URL, error) {
+	switch cfg.Pagination.Type {
+	case PaginationLink:
+		link := nextLink(header)
+		if link == "" {
+			return nil, nil
+		}
+		return u.Parse(link)
+	case PaginationCursor:
+		segments, err := origin.ParseJSONPath(cfg.Pagination.CursorPath)
+		if err != nil {
+			return nil, err
+		}
+		v, ok := origin.LookupJSONPath(body, segments)
+		if !ok || v == nil {
+			return nil, nil
+		}
+		cursor := fmt.Sprint(v)
+		if cursor == "" || cursor == "false" {
+			return nil, nil
+		}
+		if strings.HasPrefix(cursor, "http://") || strings.HasPrefix(cursor, "https://") || strings.HasPrefix(cursor, "/") {
+			return u.Parse(cursor)
+		}
+		next := *u
+		q := next.Query()
+		q.Set(cfg.Pagination.CursorParam, cursor)
+		next.RawQuery = q.Encode()
+		return &next, nil
+	case PaginationOffset:
+		if numRows < cfg.Pagination.Limit {
+			return nil, nil
+		}
+		q := u.Query()
+		offset := 0
+		if s := q.Get(cfg.Pagination.OffsetParam); s != "" {
+			var err error
+			if offset, err = strconv.Atoi(s); err != nil {
+				return nil, fmt.Errorf("%s is not a number: %w", cfg.Pagination.OffsetParam, err)
+			}
+		}
+		next := *u
+		q.Set(cfg.Pagination.OffsetParam, strconv.Itoa(offset+numRows))
+		next.RawQuery = q.Encode()
+		return &next, nil
+	}
+	return nil, nil
+}
+
+// nextLink returns the url of rel="next" in the Link header (RFC 8288).
+func nextLink(header http.Header) string {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(key), "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(value), `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func (cfg *TableConfig) FetchRows(ctx context.Context) ([][]interface{}, error) {
+	rows := make([][]interface{}, 0)
+	err := cfg.EachPage(ctx, func(records [][]string) error {
+		rows = append(rows, cfg.Columns.ToRows(records, 1)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// DetectSchema detects the schema from the first page.
+func (cfg *TableConfig) DetectSchema(ctx context.Context) error {
+	now := flextime.Now()
+	if cfg.DetectedSchemaExpiration != 0 && now.Sub(cfg.LastSchemaDetection) < cfg.DetectedSchemaExpiration {
+		return nil
+	}
+	records, _, err := cfg.fetchPage(ctx, cfg.firstPageURL(), nil)
+	if err != nil {
+		return err
+	}
+	err = cfg.BaseTableConfig.DetectSchema(ctx, func(_ context.Context) ([][]string, error) {
+		return records, nil
+	}, 1, cfg.AllowUnicodeColumnName)
+	if err != nil {
+		return err
+	}
+	// column names may be normalized, so keep the original field names to pick up fields of every page.
+	for _, c := range cfg.Columns {
+		if c.ColumnIndex == nil || *c.ColumnIndex >= len(records[0]) {
+			continue
+		}
+		key := records[0][*c.ColumnIndex]
+		if segments, err := origin.ParseJSONPath(key); err != nil || len(segments) != 1 || segments[0].Key != key {
+			continue
+		}
+		c.Path = key
+		c.ColumnIndex = nil
+	}
+	cfg.LastSchemaDetection = now
+	return nil
+}
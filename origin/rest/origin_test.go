@@ -0,0 +1,217 @@
+package rest_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/mashiike/psql-front/origin"
+	"github.com/mashiike/psql-front/origin/rest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableConfigFetchRows(t *testing.T) {
+	items := []string{"hoge", "fuga", "piyo", "tora", "kuma"}
+	page := func(offset, limit int) string {
+		body := ""
+		for i := offset; i < offset+limit && i < len(items); i++ {
+			if body != "" {
+				body += ","
+			}
+			body += fmt.Sprintf(`{"id":%d,"profile":{"name":%q}}`, i+1, items[i])
+		}
+		return "[" + body + "]"
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/link":
+			p, _ := strconv.Atoi(q.Get("page"))
+			if (p+1)*2 < len(items) {
+				w.Header().Set("Link", fmt.Sprintf(`</link?page=%d>; rel="next", </link?page=0>; rel="first"`, p+1))
+			}
+			fmt.Fprint(w, page(p*2, 2))
+		case "/cursor":
+			offset, _ := strconv.Atoi(q.Get("cursor"))
+			next := "null"
+			if offset+2 < len(items) {
+				next = strconv.Quote(strconv.Itoa(offset + 2))
+			}
+			fmt.Fprintf(w, `{"data":%s,"meta":{"next_cursor":%s}}`, page(offset, 2), next)
+		case "/offset":
+			offset, _ := strconv.Atoi(q.Get("offset"))
+			limit, _ := strconv.Atoi(q.Get("limit"))
+			fmt.Fprint(w, page(offset, limit))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+	columns := origin.ColumnConfigs{
+		{
+			Name:     "id",
+			DataType: "BIGINT",
+		},
+		{
+			Name:     "name",
+			DataType: "TEXT",
+			Path:     "profile.name",
+		},
+	}
+	all := [][]interface{}{
+		{int64(1), "hoge"},
+		{int64(2), "fuga"},
+		{int64(3), "piyo"},
+		{int64(4), "tora"},
+		{int64(5), "kuma"},
+	}
+	cases := []struct {
+		name     string
+		cfg      *rest.TableConfig
+		expected [][]interface{}
+	}{
+		{
+			name: "link",
+			cfg: &rest.TableConfig{
+				URLString:  s.URL + "/link",
+				Pagination: &rest.PaginationConfig{Type: "link"},
+			},
+			expected: all,
+		},
+		{
+			name: "cursor",
+			cfg: &rest.TableConfig{
+				URLString: s.URL + "/cursor",
+				JSONPath:  "$.data",
+				Pagination: &rest.PaginationConfig{
+					Type:       "cursor",
+					CursorPath: "$.meta.next_cursor",
+				},
+			},
+			expected: all,
+		},
+		{
+			name: "offset",
+			cfg: &rest.TableConfig{
+				URLString: s.URL + "/offset",
+				Pagination: &rest.PaginationConfig{
+					Type:  "offset",
+					Limit: 2,
+				},
+			},
+			expected: all,
+		},
+		{
+			name: "max_pages",
+			cfg: &rest.TableConfig{
+				URLString: s.URL + "/offset",
+				Pagination: &rest.PaginationConfig{
+					Type:     "offset",
+					Limit:    2,
+					MaxPages: 2,
+				},
+			},
+			expected: all[:4],
+		},
+		{
+			name: "no pagination",
+			cfg: &rest.TableConfig{
+				URLString: s.URL + "/link",
+			},
+			expected: all[:2],
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.cfg.Name = "table"
+			c.cfg.Columns = columns
+			err := c.cfg.Restrict("public")
+			require.NoError(t, err)
+			actual, err := c.cfg.FetchRows(context.Background())
+			require.NoError(t, err)
+			require.EqualValues(t, c.expected, actual)
+		})
+	}
+}
+
+func TestTableConfigFetchRowsPaginationLoop(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/link":
+			w.Header().Set("Link", `</link?page=1>; rel="next"`)
+			fmt.Fprint(w, `[{"id":1}]`)
+		case "/cursor":
+			fmt.Fprint(w, `{"data":[{"id":1}],"next_cursor":"abc"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+	cases := []struct {
+		name string
+		cfg  *rest.TableConfig
+	}{
+		{
+			name: "same link",
+			cfg: &rest.TableConfig{
+				URLString:  s.URL + "/link",
+				Pagination: &rest.PaginationConfig{Type: "link"},
+			},
+		},
+		{
+			name: "same cursor",
+			cfg: &rest.TableConfig{
+				URLString: s.URL + "/cursor",
+				JSONPath:  "$.data",
+				Pagination: &rest.PaginationConfig{
+					Type:       "cursor",
+					CursorPath: "$.next_cursor",
+				},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.cfg.Name = "table"
+			c.cfg.Columns = origin.ColumnConfigs{{Name: "id", DataType: "BIGINT"}}
+			require.NoError(t, c.cfg.Restrict("public"))
+			require.Equal(t, rest.DefaultMaxPages, c.cfg.Pagination.MaxPages)
+			_, err := c.cfg.FetchRows(context.Background())
+			require.ErrorContains(t, err, "pagination loop")
+		})
+	}
+}
+
+func TestTableConfigDetectSchema(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("page") == "" {
+			w.Header().Set("Link", `</?page=2>; rel="next"`)
+			fmt.Fprint(w, `[{"userId":1,"Full Name":"hoge"}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"Full Name":"fuga","userId":2}]`)
+	}))
+	defer s.Close()
+	cfg := &rest.TableConfig{
+		BaseTableConfig: origin.BaseTableConfig{
+			Name: "table",
+		},
+		URLString:       s.URL,
+		SchemaDetection: true,
+		Pagination:      &rest.PaginationConfig{Type: "link"},
+	}
+	require.NoError(t, cfg.Restrict("public"))
+	require.Len(t, cfg.Columns, 2)
+	actual, err := cfg.FetchRows(context.Background())
+	require.NoError(t, err)
+	require.EqualValues(t, [][]interface{}{
+		{"hoge", int64(1)},
+		{"fuga", int64(2)},
+	}, actual)
+}
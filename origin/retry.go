@@ -0,0 +1,244 @@
+package origin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Songmu/flextime"
+	"github.com/lestrrat-go/backoff/v2"
+	psqlfront "github.com/mashiike/psql-front"
+	"google.golang.org/api/googleapi"
+)
+
+// ErrCircuitOpen is returned while the circuit breaker stops requests to the failing origin.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// HTTPStatusError is returned when the origin responds an unexpected status code.
+type HTTPStatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%s %s failed: %s", e.Method, e.URL, e.Status)
+}
+
+// IsRetryable reports whether the fetch may succeed by retrying: 5xx, 429 Too Many Requests and timeouts.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, psqlfront.ErrNotModified) {
+		return false
+	}
+	var hse *HTTPStatusError
+	if errors.As(err, &hse) {
+		return isRetryableStatus(hse.StatusCode)
+	}
+	var gae *googleapi.Error
+	if errors.As(err, &gae) {
+		return isRetryableStatus(gae.Code)
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return ne.Timeout()
+	}
+	return false
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+type RetryConfig struct {
+	MaxRetries  *int          `yaml:"max_retries,omitempty"`
+	MinInterval time.Duration `yaml:"min_interval,omitempty"`
+	MaxInterval time.Duration `yaml:"max_interval,omitempty"`
+}
+
+func (cfg *RetryConfig) Restrict() error {
+	if cfg.MaxRetries == nil {
+		cfg.MaxRetries = psqlfront.PtrValue(3)
+	}
+	if *cfg.MaxRetries < 0 {
+		return errors.New("max_retries must be positive")
+	}
+	if cfg.MinInterval == 0 {
+		cfg.MinInterval = 500 * time.Millisecond
+	}
+	if cfg.MaxInterval == 0 {
+		cfg.MaxInterval = 10 * time.Second
+	}
+	if cfg.MinInterval < 0 || cfg.MaxInterval < cfg.MinInterval {
+		return errors.New("intervals are invalid, must be 0 < min_interval <= max_interval")
+	}
+	return nil
+}
+
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `yaml:"failure_threshold,omitempty"`
+	OpenTimeout      time.Duration `yaml:"open_timeout,omitempty"`
+}
+
+func (cfg *CircuitBreakerConfig) Restrict() error {
+	if cfg.FailureThreshold == 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.FailureThreshold < 0 {
+		return errors.New("failure_threshold must be positive")
+	}
+	if cfg.OpenTimeout == 0 {
+		cfg.OpenTimeout = time.Minute
+	}
+	if cfg.OpenTimeout < 0 {
+		return errors.New("open_timeout must be positive")
+	}
+	return nil
+}
+
+// CircuitBreaker stops requests to the origin after consecutive failures for open_timeout.
+// After open_timeout, only one trial request is allowed, and the circuit is closed if it succeeds.
+type CircuitBreaker struct {
+	cfg *CircuitBreakerConfig
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trying   bool
+}
+
+func NewCircuitBreaker(cfg *CircuitBreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{
+		cfg: cfg,
+	}
+}
+
+// Allow returns ErrCircuitOpen if the request should not be sent.
+func (cb *CircuitBreaker) Allow() error {
+	if cb == nil {
+		return nil
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.failures < cb.cfg.FailureThreshold {
+		return nil
+	}
+	if cb.trying || flextime.Since(cb.openedAt) < cb.cfg.OpenTimeout {
+		return ErrCircuitOpen
+	}
+	cb.trying = true
+	return nil
+}
+
+// Record records the result of the request allowed by Allow.
+// Only the retryable errors count as the failures of the origin, the other errors such as the cancellation of the client do not change the state.
+func (cb *CircuitBreaker) Record(err error) {
+	if cb == nil {
+		return
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.trying = false
+	if err == nil || errors.Is(err, psqlfront.ErrNotModified) {
+		cb.failures = 0
+		return
+	}
+	if !IsRetryable(err) {
+		return
+	}
+	cb.failures++
+	if cb.failures >= cb.cfg.FailureThreshold {
+		cb.openedAt = flextime.Now()
+	}
+}
+
+// Retrier retries origin fetches with exponential backoff, and shares the circuit breaker of the origin.
+type Retrier struct {
+	cfg     *RetryConfig
+	breaker *CircuitBreaker
+}
+
+// NewRetrier creates the retrier of the origin. if cfg is nil, does not retry. if breakerCfg is nil, the circuit breaker is disabled.
+func NewRetrier(cfg *RetryConfig, breakerCfg *CircuitBreakerConfig) *Retrier {
+	r := &Retrier{
+		cfg: cfg,
+	}
+	if breakerCfg != nil {
+		r.breaker = NewCircuitBreaker(breakerCfg)
+	}
+	return r
+}
+
+// Do calls fn until it succeeds, returns a not retryable error or max_retries is reached.
+// A nil Retrier calls fn only once.
+func (r *Retrier) Do(ctx context.Context, fn func(context.Context) error) error {
+	if r == nil {
+		return fn(ctx)
+	}
+	if err := r.breaker.Allow(); err != nil {
+		return err
+	}
+	err := r.do(ctx, fn)
+	r.breaker.Record(err)
+	return err
+}
+
+func (r *Retrier) do(ctx context.Context, fn func(context.Context) error) error {
+	if r.cfg == nil || *r.cfg.MaxRetries == 0 {
+		return fn(ctx)
+	}
+	remoteAddr := psqlfront.GetRemoteAddr(ctx)
+	p := backoff.Exponential(
+		backoff.WithMinInterval(r.cfg.MinInterval),
+		backoff.WithMaxInterval(r.cfg.MaxInterval),
+		backoff.WithJitterFactor(0.05),
+		backoff.WithMaxRetries(*r.cfg.MaxRetries),
+	)
+	b := p.Start(ctx)
+	var err error
+	for attempt := 0; backoff.Continue(b); attempt++ {
+		if attempt > 0 {
+			log.Printf("[warn][%s] retry %d/%d: %v", remoteAddr, attempt, *r.cfg.MaxRetries, err)
+		}
+		if err = fn(ctx); err == nil || !IsRetryable(err) {
+			return err
+		}
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// RetryPolicyConfig is the retry and the circuit breaker settings of an origin.
+type RetryPolicyConfig struct {
+	Retry          *RetryConfig          `yaml:"retry,omitempty"`
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker,omitempty"`
+}
+
+func (cfg *RetryPolicyConfig) Restrict() error {
+	if cfg.Retry == nil {
+		cfg.Retry = &RetryConfig{}
+	}
+	if err := cfg.Retry.Restrict(); err != nil {
+		return fmt.Errorf("retry: %w", err)
+	}
+	if cfg.CircuitBreaker == nil {
+		// the circuit breaker is disabled unless it is configured.
+		return nil
+	}
+	if err := cfg.CircuitBreaker.Restrict(); err != nil {
+		return fmt.Errorf("circuit_breaker: %w", err)
+	}
+	return nil
+}
+
+// NewRetrier creates the retrier shared by the tables of the origin.
+func (cfg *RetryPolicyConfig) NewRetrier() *Retrier {
+	return NewRetrier(cfg.Retry, cfg.CircuitBreaker)
+}
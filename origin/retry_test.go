@@ -0,0 +1,126 @@
+package origin_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Songmu/flextime"
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/mashiike/psql-front/origin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected bool
+	}{
+		{err: nil, expected: false},
+		{err: errors.New("unexpected"), expected: false},
+		{err: psqlfront.ErrNotModified, expected: false},
+		{err: context.Canceled, expected: false},
+		{err: &origin.HTTPStatusError{StatusCode: http.StatusBadGateway}, expected: true},
+		{err: &origin.HTTPStatusError{StatusCode: http.StatusTooManyRequests}, expected: true},
+		{err: &origin.HTTPStatusError{StatusCode: http.StatusNotFound}, expected: false},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.expected, origin.IsRetryable(c.err), "%v", c.err)
+	}
+}
+
+func TestRetrier(t *testing.T) {
+	cfg := &origin.RetryPolicyConfig{
+		Retry: &origin.RetryConfig{
+			MaxRetries:  psqlfront.PtrValue(2),
+			MinInterval: time.Millisecond,
+			MaxInterval: time.Millisecond,
+		},
+		CircuitBreaker: &origin.CircuitBreakerConfig{
+			FailureThreshold: 2,
+			OpenTimeout:      time.Minute,
+		},
+	}
+	require.NoError(t, cfg.Restrict())
+	r := cfg.NewRetrier()
+	ctx := context.Background()
+
+	var calls int
+	err := r.Do(ctx, func(_ context.Context) error {
+		calls++
+		if calls < 3 {
+			return &origin.HTTPStatusError{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway"}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, calls, "succeeded after 2 retries")
+
+	calls = 0
+	err = r.Do(ctx, func(_ context.Context) error {
+		calls++
+		return &origin.HTTPStatusError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, calls, "not retryable")
+
+	for i := 0; i < 2; i++ {
+		err = r.Do(ctx, func(_ context.Context) error {
+			return &origin.HTTPStatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+		})
+		require.Error(t, err)
+	}
+
+	calls = 0
+	err = r.Do(ctx, func(_ context.Context) error {
+		calls++
+		return nil
+	})
+	require.ErrorIs(t, err, origin.ErrCircuitOpen)
+	require.Equal(t, 0, calls, "circuit is open after 2 failures, not retryable errors are not counted")
+
+	restore := flextime.Fix(flextime.Now().Add(2 * time.Minute))
+	defer restore()
+	err = r.Do(ctx, func(_ context.Context) error {
+		return context.Canceled
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	err = r.Do(ctx, func(_ context.Context) error {
+		return &origin.HTTPStatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+	})
+	require.Error(t, err)
+	err = r.Do(ctx, func(_ context.Context) error {
+		calls++
+		return nil
+	})
+	require.ErrorIs(t, err, origin.ErrCircuitOpen, "canceled trial does not close the circuit, and the failed trial opens it again")
+	require.Equal(t, 0, calls)
+
+	restore = flextime.Fix(flextime.Now().Add(2 * time.Minute))
+	defer restore()
+	err = r.Do(ctx, func(_ context.Context) error {
+		calls++
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, calls, "trial request after open_timeout")
+}
+
+func TestRetryPolicyConfigCircuitBreakerDisabled(t *testing.T) {
+	cfg := &origin.RetryPolicyConfig{
+		Retry: &origin.RetryConfig{
+			MaxRetries: psqlfront.PtrValue(0),
+		},
+	}
+	require.NoError(t, cfg.Restrict())
+	require.Nil(t, cfg.CircuitBreaker)
+	r := cfg.NewRetrier()
+	for i := 0; i < 10; i++ {
+		err := r.Do(context.Background(), func(_ context.Context) error {
+			return &origin.HTTPStatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+		})
+		require.NotErrorIs(t, err, origin.ErrCircuitOpen)
+	}
+}
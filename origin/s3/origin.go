@@ -0,0 +1,331 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Songmu/flextime"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/mashiike/psql-front/origin"
+	"github.com/samber/lo"
+)
+
+const OriginType = "S3"
+
+// ErrNoObjects is returned when the prefix has no objects, so that the cached rows are not replaced with nothing.
+var ErrNoObjects = errors.New("no objects found")
+
+func init() {
+	psqlfront.RegisterOriginType(OriginType, func() psqlfront.OriginConfig {
+		return &OriginConfig{}
+	})
+	log.Printf("[info] load origin type: %s", OriginType)
+}
+
+type Origin struct {
+	id     string
+	schema string
+	tables []*TableConfig
+}
+
+func (o *Origin) ID() string {
+	return o.id
+}
+
+func (o *Origin) GetTables(_ context.Context) ([]*psqlfront.Table, error) {
+	return lo.Map(o.tables, func(cfg *TableConfig, _ int) *psqlfront.Table {
+		return cfg.ToTable()
+	}), nil
+}
+
+func (o *Origin) RefreshCache(ctx context.Context, w psqlfront.CacheWriter) error {
+	table := w.TargetTable()
+	if o.schema != table.SchemaName {
+		return psqlfront.WrapOriginNotFoundError(errors.New("origin schema is missmatch"))
+	}
+	for _, t := range o.tables {
+		if t.Name != table.RelName {
+			continue
+		}
+		return o.refreshCache(ctx, w, t)
+	}
+	return psqlfront.WrapOriginNotFoundError(errors.New("origin table not found"))
+}
+
+func (o *Origin) refreshCache(ctx context.Context, w psqlfront.CacheWriter, cfg *TableConfig) error {
+	if cfg.SchemaDetection {
+		// the objects are read once, so that the schema is detected from the same records as loaded.
+		records, err := cfg.Fetcher(ctx)
+		if err != nil {
+			return fmt.Errorf("try get %s origin: %w", w.TargetTable().String(), err)
+		}
+		if err := cfg.detectSchema(ctx, func(_ context.Context) ([][]string, error) {
+			return records, nil
+		}); err != nil {
+			return err
+		}
+		if err := w.ReplaceCacheTable(ctx, cfg.ToTable()); err != nil {
+			return err
+		}
+		return w.AppendRows(ctx, cfg.Columns.ToRows(records, cfg.IgnoreLines))
+	}
+	if err := w.DeleteRows(ctx); err != nil {
+		return err
+	}
+	if err := cfg.StreamRows(ctx, w, cfg.StreamFetcher, cfg.IgnoreLines); err != nil {
+		return fmt.Errorf("try get %s origin: %w", w.TargetTable().String(), err)
+	}
+	return nil
+}
+
+type OriginConfig struct {
+	Schema       string         `yaml:"schema"`
+	Region       string         `yaml:"region"`
+	Endpoint     string         `yaml:"endpoint"`
+	UsePathStyle bool           `yaml:"use_path_style"`
+	Tables       []*TableConfig `yaml:"tables"`
+}
+
+type TableConfig struct {
+	origin.BaseTableConfig     `yaml:",inline"`
+	origin.NoIncrementalConfig `yaml:",inline"`
+	origin.FormatConfig        `yaml:",inline"`
+
+	URLString                string        `yaml:"url"`
+	IgnoreLines              int           `yaml:"ignore_lines"`
+	SchemaDetection          bool          `yaml:"schema_detection"`
+	DetectedSchemaExpiration time.Duration `yaml:"detected_schema_expiration"`
+	AllowUnicodeColumnName   bool          `yaml:"allow_unicode_column_name"`
+	URL                      *url.URL      `yaml:"-"`
+	Bucket                   string        `yaml:"-"`
+	Key                      string        `yaml:"-"`
+	LastSchemaDetection      time.Time     `yaml:"-"`
+
+	client *s3.Client `yaml:"-"`
+}
+
+func (cfg *OriginConfig) Type() string {
+	return OriginType
+}
+
+func (cfg *OriginConfig) Restrict() error {
+	if cfg.Schema == "" {
+		cfg.Schema = "public"
+	}
+	ctx := context.Background()
+	opts := make([]func(*config.LoadOptions) error, 0)
+	if cfg.Region != "" {
+		opts = append(opts, config.WithRegion(cfg.Region))
+	}
+	awsCfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to load default aws config, %w", err)
+	}
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.EndpointResolver = s3.EndpointResolverFromURL(cfg.Endpoint)
+		}
+		o.UsePathStyle = cfg.UsePathStyle
+	})
+	for i, table := range cfg.Tables {
+		if err := table.Restrict(cfg.Schema, client); err != nil {
+			return fmt.Errorf("table[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (cfg *OriginConfig) NewOrigin(id string) (psqlfront.Origin, error) {
+	return &Origin{
+		id:     id,
+		schema: cfg.Schema,
+		tables: cfg.Tables,
+	}, nil
+}
+
+func (cfg *TableConfig) Restrict(schema string, client *s3.Client) error {
+	cfg.client = client
+	if err := cfg.RestrictIncremental(); err != nil {
+		return err
+	}
+	if cfg.URLString == "" {
+		return fmt.Errorf("url is required")
+	}
+	if err := cfg.FormatConfig.Restrict(); err != nil {
+		return err
+	}
+	cfg.IgnoreLines = cfg.DefaultIgnoreLines(cfg.IgnoreLines)
+	var err error
+	if cfg.URL, err = url.Parse(cfg.URLString); err != nil {
+		return fmt.Errorf("url is invalid: %v", err)
+	}
+	if cfg.URL.Scheme != "s3" {
+		return fmt.Errorf("url.schema must s3")
+	}
+	cfg.Bucket = cfg.URL.Host
+	if cfg.Bucket == "" {
+		return fmt.Errorf("url is invalid: bucket is empty")
+	}
+	cfg.Key = strings.TrimLeft(cfg.URL.Path, "/")
+	if !cfg.SchemaDetection {
+		if len(cfg.Columns) == 0 {
+			return fmt.Errorf("columns: empty")
+		}
+	} else {
+		if err := cfg.DetectSchema(context.Background()); err != nil {
+			log.Printf("[warn] %s.%s initial schema detection failed: %v", schema, cfg.Name, err)
+			cfg.Columns = origin.ColumnConfigs{
+				{
+					Name:     "dummy",
+					DataType: "VARCHAR",
+				},
+			}
+		}
+	}
+	if err := cfg.BaseTableConfig.Restrict(schema); err != nil {
+		return err
+	}
+	return nil
+}
+
+// IsPrefix reports whether the url points to a prefix (directory like) instead of a single object.
+func (cfg *TableConfig) IsPrefix() bool {
+	return cfg.Key == "" || strings.HasSuffix(cfg.Key, "/")
+}
+
+func (cfg *TableConfig) Fetcher(ctx context.Context) ([][]string, error) {
+	if !cfg.IsPrefix() {
+		return cfg.fetchObject(ctx, cfg.Key)
+	}
+	keys, err := cfg.listObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	records := make([][]string, 0)
+	for i, key := range keys {
+		r, err := cfg.fetchObject(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		// ignore_lines is applied to every object, but the first object's lines are removed at ToRows.
+		if i > 0 && cfg.IgnoreLines > 0 {
+			if cfg.IgnoreLines >= len(r) {
+				continue
+			}
+			r = r[cfg.IgnoreLines:]
+		}
+		records = append(records, r...)
+	}
+	return records, nil
+}
+
+// StreamFetcher reads the records of the objects one by one, the objects are opened in order.
+func (cfg *TableConfig) StreamFetcher(ctx context.Context, fn func(origin.RecordReader) error) error {
+	keys := []string{cfg.Key}
+	if cfg.IsPrefix() {
+		var err error
+		if keys, err = cfg.listObjects(ctx); err != nil {
+			return err
+		}
+	}
+	r := origin.ConcatRecordReaders(len(keys), cfg.IgnoreLines, func(i int) (origin.RecordReadCloser, error) {
+		return cfg.openObject(ctx, keys[i])
+	})
+	defer r.Close()
+	return fn(r)
+}
+
+func (cfg *TableConfig) listObjects(ctx context.Context) ([]string, error) {
+	remoteAddr := psqlfront.GetRemoteAddr(ctx)
+	log.Printf("[debug][%s] s3 list objects: s3://%s/%s", remoteAddr, cfg.Bucket, cfg.Key)
+	keys := make([]string, 0)
+	p := s3.NewListObjectsV2Paginator(cfg.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(cfg.Bucket),
+		Prefix: aws.String(cfg.Key),
+	})
+	for p.HasMorePages() {
+		output, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list objects s3://%s/%s failed: %w", cfg.Bucket, cfg.Key, err)
+		}
+		for _, obj := range output.Contents {
+			key := aws.ToString(obj.Key)
+			if strings.HasSuffix(key, "/") {
+				continue
+			}
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("list objects s3://%s/%s: %w", cfg.Bucket, cfg.Key, ErrNoObjects)
+	}
+	return keys, nil
+}
+
+func (cfg *TableConfig) fetchObject(ctx context.Context, key string) ([][]string, error) {
+	remoteAddr := psqlfront.GetRemoteAddr(ctx)
+	log.Printf("[debug][%s] s3 get object: s3://%s/%s", remoteAddr, cfg.Bucket, key)
+	output, err := cfg.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(cfg.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get object s3://%s/%s failed: %w", cfg.Bucket, key, err)
+	}
+	defer output.Body.Close()
+	return cfg.readRecords(output.Body)
+}
+
+func (cfg *TableConfig) openObject(ctx context.Context, key string) (origin.RecordReadCloser, error) {
+	remoteAddr := psqlfront.GetRemoteAddr(ctx)
+	log.Printf("[debug][%s] s3 get object: s3://%s/%s", remoteAddr, cfg.Bucket, key)
+	output, err := cfg.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(cfg.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get object s3://%s/%s failed: %w", cfg.Bucket, key, err)
+	}
+	r, err := cfg.NewRecordReader(output.Body, cfg.Columns)
+	if err != nil {
+		output.Body.Close()
+		return nil, err
+	}
+	return origin.WithCloser(r, output.Body), nil
+}
+
+func (cfg *TableConfig) FetchRows(ctx context.Context) ([][]interface{}, error) {
+	return cfg.BaseTableConfig.FetchRows(ctx, cfg.Fetcher, cfg.IgnoreLines)
+}
+
+func (cfg *TableConfig) DetectSchema(ctx context.Context) error {
+	return cfg.detectSchema(ctx, cfg.Fetcher)
+}
+
+func (cfg *TableConfig) detectSchema(ctx context.Context, fetcher origin.Fetcher) error {
+	now := flextime.Now()
+	if cfg.DetectedSchemaExpiration != 0 && now.Sub(cfg.LastSchemaDetection) < cfg.DetectedSchemaExpiration {
+		return nil
+	}
+	if err := cfg.BaseTableConfig.DetectSchema(ctx, fetcher, cfg.IgnoreLines, cfg.AllowUnicodeColumnName); err != nil {
+		return err
+	}
+	cfg.LastSchemaDetection = now
+	return nil
+}
+
+func (cfg *TableConfig) readRecords(r io.Reader) ([][]string, error) {
+	if cfg.SchemaDetection {
+		return cfg.ReadRecords(r, nil)
+	}
+	return cfg.ReadRecords(r, cfg.Columns)
+}
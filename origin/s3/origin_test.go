@@ -0,0 +1,256 @@
+package s3_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/mashiike/psql-front/origin"
+	s3origin "github.com/mashiike/psql-front/origin/s3"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeS3Server(t *testing.T, objects map[string]string) *httptest.Server {
+	t.Helper()
+	return newFakeS3ServerWithGets(t, objects, nil)
+}
+
+// newFakeS3ServerWithGets is newFakeS3Server which counts GET object requests of each key in gets.
+func newFakeS3ServerWithGets(t *testing.T, objects map[string]string, gets map[string]int) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/")
+		bucket, key, _ := strings.Cut(path, "/")
+		if r.URL.Query().Get("list-type") == "2" {
+			prefix := r.URL.Query().Get("prefix")
+			var contents strings.Builder
+			for k := range objects {
+				b, objKey, _ := strings.Cut(k, "/")
+				if b != bucket || !strings.HasPrefix(objKey, prefix) {
+					continue
+				}
+				fmt.Fprintf(&contents, "<Contents><Key>%s</Key></Contents>", objKey)
+			}
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult><Name>%s</Name><Prefix>%s</Prefix><IsTruncated>false</IsTruncated>%s</ListBucketResult>`, bucket, prefix, contents.String())
+			return
+		}
+		if gets != nil {
+			mu.Lock()
+			gets[bucket+"/"+key]++
+			mu.Unlock()
+		}
+		body, ok := objects[bucket+"/"+key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		fmt.Fprint(w, body)
+	}))
+}
+
+func TestTableConfigFetchRows(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+	s := newFakeS3Server(t, map[string]string{
+		"example/users.csv":            "id,name\n1,hoge\n2,fuga\n",
+		"example/exports/2022-08.csv":  "id,name\n3,piyo\n",
+		"example/exports/2022-09.csv":  "id,name\n4,tora\n",
+		"other/exports/not_target.csv": "id,name\n5,none\n",
+	})
+	defer s.Close()
+	columns := origin.ColumnConfigs{
+		{
+			Name:      "id",
+			DataType:  "BIGINT",
+			Contraint: "NOT NULL",
+		},
+		{
+			Name:     "name",
+			DataType: "TEXT",
+		},
+	}
+	cases := []struct {
+		name     string
+		url      string
+		expected [][]interface{}
+	}{
+		{
+			name: "object",
+			url:  "s3://example/users.csv",
+			expected: [][]interface{}{
+				{int64(1), "hoge"},
+				{int64(2), "fuga"},
+			},
+		},
+		{
+			name: "prefix",
+			url:  "s3://example/exports/",
+			expected: [][]interface{}{
+				{int64(3), "piyo"},
+				{int64(4), "tora"},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			table := &s3origin.TableConfig{
+				BaseTableConfig: origin.BaseTableConfig{
+					Name:    "table",
+					Columns: columns,
+				},
+				IgnoreLines: 1,
+				URLString:   c.url,
+			}
+			cfg := &s3origin.OriginConfig{
+				Region:       "ap-northeast-1",
+				Endpoint:     s.URL,
+				UsePathStyle: true,
+				Tables:       []*s3origin.TableConfig{table},
+			}
+			err := cfg.Restrict()
+			require.NoError(t, err)
+			rows, err := table.FetchRows(context.Background())
+			require.NoError(t, err)
+			require.ElementsMatch(t, c.expected, rows)
+		})
+	}
+}
+
+func TestOriginRefreshCacheSchemaDetection(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+	gets := make(map[string]int)
+	s := newFakeS3ServerWithGets(t, map[string]string{
+		"example/exports/2022-08.csv": "id,name\n3,piyo\n",
+		"example/exports/2022-09.csv": "id,name\n4,tora\n",
+	}, gets)
+	defer s.Close()
+	cfg := &s3origin.OriginConfig{
+		Schema:       "example",
+		Region:       "ap-northeast-1",
+		Endpoint:     s.URL,
+		UsePathStyle: true,
+		Tables: []*s3origin.TableConfig{
+			{
+				BaseTableConfig: origin.BaseTableConfig{
+					Name: "exports",
+				},
+				IgnoreLines:     1,
+				URLString:       "s3://example/exports/",
+				SchemaDetection: true,
+			},
+		},
+	}
+	require.NoError(t, cfg.Restrict())
+	o, err := cfg.NewOrigin("s3")
+	require.NoError(t, err)
+	for key := range gets {
+		delete(gets, key)
+	}
+	w := &recordCacheWriter{table: &psqlfront.Table{SchemaName: "example", RelName: "exports"}}
+	require.NoError(t, o.RefreshCache(context.Background(), w))
+	require.ElementsMatch(t, [][]interface{}{
+		{int64(3), "piyo"},
+		{int64(4), "tora"},
+	}, w.rows)
+	require.Equal(t, map[string]int{
+		"example/exports/2022-08.csv": 1,
+		"example/exports/2022-09.csv": 1,
+	}, gets, "each object is downloaded once")
+}
+
+type recordCacheWriter struct {
+	table *psqlfront.Table
+	rows  [][]interface{}
+}
+
+func (w *recordCacheWriter) DeleteRows(_ context.Context) error {
+	w.rows = nil
+	return nil
+}
+
+func (w *recordCacheWriter) ReplaceCacheTable(_ context.Context, _ *psqlfront.Table) error {
+	w.rows = nil
+	return nil
+}
+
+func (w *recordCacheWriter) AppendRows(_ context.Context, rows [][]interface{}) error {
+	w.rows = append(w.rows, rows...)
+	return nil
+}
+
+func (w *recordCacheWriter) AppendRowIterator(_ context.Context, iter psqlfront.RowIterator) error {
+	for iter.Next() {
+		values, err := iter.Values()
+		if err != nil {
+			return err
+		}
+		w.rows = append(w.rows, values)
+	}
+	return iter.Err()
+}
+
+func (w *recordCacheWriter) UpsertRows(_ context.Context, rows [][]interface{}) error {
+	w.rows = append(w.rows, rows...)
+	return nil
+}
+
+func (w *recordCacheWriter) TargetTable() *psqlfront.Table {
+	return w.table
+}
+
+func (w *recordCacheWriter) CacheValidators(_ context.Context) (*psqlfront.CacheValidators, error) {
+	return &psqlfront.CacheValidators{}, nil
+}
+
+func (w *recordCacheWriter) SetCacheValidators(_ context.Context, _ *psqlfront.CacheValidators) error {
+	return nil
+}
+
+func (w *recordCacheWriter) Watermark(_ context.Context) (string, error) {
+	return "", nil
+}
+
+func TestTableConfigNoObjects(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+	s := newFakeS3Server(t, map[string]string{
+		"example/users.csv": "id,name\n1,hoge\n",
+	})
+	defer s.Close()
+	table := &s3origin.TableConfig{
+		BaseTableConfig: origin.BaseTableConfig{
+			Name: "exports",
+			Columns: origin.ColumnConfigs{
+				{Name: "id", DataType: "BIGINT"},
+				{Name: "name", DataType: "TEXT"},
+			},
+		},
+		IgnoreLines: 1,
+		URLString:   "s3://example/exports/",
+	}
+	cfg := &s3origin.OriginConfig{
+		Schema:       "example",
+		Region:       "ap-northeast-1",
+		Endpoint:     s.URL,
+		UsePathStyle: true,
+		Tables:       []*s3origin.TableConfig{table},
+	}
+	require.NoError(t, cfg.Restrict(), "objects may be placed after startup")
+	_, err := table.FetchRows(context.Background())
+	require.ErrorIs(t, err, s3origin.ErrNoObjects)
+	w := &recordCacheWriter{rows: [][]interface{}{{int64(1), "hoge"}}}
+	err = table.StreamRows(context.Background(), w, table.StreamFetcher, table.IgnoreLines)
+	require.ErrorIs(t, err, s3origin.ErrNoObjects)
+	require.Len(t, w.rows, 1, "cached rows are kept")
+}
@@ -0,0 +1,267 @@
+package origin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+
+	psqlfront "github.com/mashiike/psql-front"
+)
+
+// RecordReader reads the records one by one, Read returns io.EOF after the last record.
+type RecordReader interface {
+	Read() ([]string, error)
+}
+
+type RecordReadCloser interface {
+	RecordReader
+	io.Closer
+}
+
+// StreamFetcher opens the records of the origin and passes the reader to fn.
+// The reader is closed after fn returns, so the records must be consumed in fn.
+type StreamFetcher func(ctx context.Context, fn func(RecordReader) error) error
+
+// NewRecordReader returns the RecordReader of r.
+// CSV and TSV, and LTSV and JSON Lines with columns are read one by one, the others are read all at once.
+func (cfg *FormatConfig) NewRecordReader(r io.Reader, columns ColumnConfigs) (RecordReader, error) {
+	switch cfg.Format {
+	case FormatCSV, FormatTSV:
+		return cfg.newDelimitedRecordReader(ConvertTextEncoding(r, cfg.TextEncoding)), nil
+	case FormatLTSV, FormatJSONL:
+		if len(columns) == 0 {
+			break
+		}
+		p, err := newObjectProjection(columns, cfg.Format == FormatLTSV)
+		if err != nil {
+			return nil, err
+		}
+		lr := &lineObjectReader{
+			format:     cfg.Format,
+			reader:     bufio.NewReader(ConvertTextEncoding(r, cfg.TextEncoding)),
+			decode:     DecodeJSON,
+			projection: p,
+		}
+		if cfg.Format == FormatLTSV {
+			lr.decode = decodeLTSVLine
+		}
+		return lr, nil
+	}
+	records, err := cfg.ReadRecords(r, columns)
+	if err != nil {
+		return nil, err
+	}
+	return NewSliceRecordReader(records), nil
+}
+
+type delimitedRecordReader struct {
+	reader *csv.Reader
+	quote  byte
+}
+
+func (cfg *FormatConfig) newDelimitedRecordReader(r io.Reader) *delimitedRecordReader {
+	quote := cfg.quote
+	if quote == 0 {
+		quote = '"'
+	}
+	if quote != '"' {
+		r = &swapByteReader{r: r, a: quote, b: '"'}
+	}
+	reader := csv.NewReader(r)
+	if cfg.delimiter != 0 {
+		reader.Comma = cfg.delimiter
+	}
+	reader.Comment = cfg.comment
+	reader.LazyQuotes = cfg.LazyQuotes
+	return &delimitedRecordReader{reader: reader, quote: quote}
+}
+
+func (r *delimitedRecordReader) Read() ([]string, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if r.quote != '"' {
+		for i, field := range record {
+			record[i] = string(swapBytes([]byte(field), r.quote, '"'))
+		}
+	}
+	return record, nil
+}
+
+// lineObjectReader reads an object per line, and returns the header of the columns as the first record.
+type lineObjectReader struct {
+	format     string
+	reader     *bufio.Reader
+	decode     func([]byte) (interface{}, error)
+	projection *objectProjection
+	headerRead bool
+	lineNumber int
+}
+
+func (r *lineObjectReader) Read() ([]string, error) {
+	if !r.headerRead {
+		r.headerRead = true
+		return r.projection.header, nil
+	}
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		r.lineNumber++
+		trimmed := bytes.TrimSpace(line)
+		if r.format == FormatLTSV {
+			trimmed = bytes.TrimRight(line, "\r\n")
+		}
+		if len(bytes.TrimSpace(trimmed)) > 0 {
+			obj, decodeErr := r.decode(trimmed)
+			if decodeErr != nil {
+				return nil, fmt.Errorf("decode %s line %d: %w", r.format, r.lineNumber, decodeErr)
+			}
+			return r.projection.record(obj)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+	}
+}
+
+type sliceRecordReader struct {
+	records [][]string
+}
+
+// NewSliceRecordReader returns the RecordReader of the records already read.
+func NewSliceRecordReader(records [][]string) RecordReader {
+	return &sliceRecordReader{records: records}
+}
+
+func (r *sliceRecordReader) Read() ([]string, error) {
+	if len(r.records) == 0 {
+		return nil, io.EOF
+	}
+	record := r.records[0]
+	r.records[0] = nil
+	r.records = r.records[1:]
+	return record, nil
+}
+
+type concatRecordReader struct {
+	n, next     int
+	ignoreLines int
+	open        func(i int) (RecordReadCloser, error)
+	current     RecordReadCloser
+	skip        int
+}
+
+// ConcatRecordReaders returns the RecordReader reading the records of n sources in order.
+// open is called lazily for each source, and ignore_lines is applied to every source except the first, same as the Fetcher of multiple files.
+func ConcatRecordReaders(n int, ignoreLines int, open func(i int) (RecordReadCloser, error)) RecordReadCloser {
+	return &concatRecordReader{
+		n:           n,
+		ignoreLines: ignoreLines,
+		open:        open,
+	}
+}
+
+func (r *concatRecordReader) Read() ([]string, error) {
+	for {
+		if r.current == nil {
+			if r.next >= r.n {
+				return nil, io.EOF
+			}
+			current, err := r.open(r.next)
+			if err != nil {
+				return nil, err
+			}
+			r.current = current
+			if r.next > 0 {
+				r.skip = r.ignoreLines
+			}
+			r.next++
+		}
+		record, err := r.current.Read()
+		if errors.Is(err, io.EOF) {
+			if err := r.Close(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r.skip > 0 {
+			r.skip--
+			continue
+		}
+		return record, nil
+	}
+}
+
+func (r *concatRecordReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
+
+// WithCloser returns the RecordReadCloser closing c.
+func WithCloser(r RecordReader, c io.Closer) RecordReadCloser {
+	return &recordReadCloser{RecordReader: r, Closer: c}
+}
+
+type recordReadCloser struct {
+	RecordReader
+	io.Closer
+}
+
+type recordRowIterator struct {
+	reader      RecordReader
+	columns     ColumnConfigs
+	ignoreLines int
+	row         []interface{}
+	err         error
+}
+
+// NewRowIterator returns the psqlfront.RowIterator converting the records of r to the rows of the columns.
+// The first ignoreLines records are skipped.
+func (cfgs ColumnConfigs) NewRowIterator(r RecordReader, ignoreLines int) psqlfront.RowIterator {
+	return &recordRowIterator{
+		reader:      r,
+		columns:     cfgs,
+		ignoreLines: ignoreLines,
+	}
+}
+
+func (it *recordRowIterator) Next() bool {
+	for {
+		record, err := it.reader.Read()
+		if errors.Is(err, io.EOF) {
+			return false
+		}
+		if err != nil {
+			it.err = err
+			return false
+		}
+		if it.ignoreLines > 0 {
+			it.ignoreLines--
+			continue
+		}
+		it.row = it.columns.ToRow(record)
+		return true
+	}
+}
+
+func (it *recordRowIterator) Values() ([]interface{}, error) {
+	return it.row, nil
+}
+
+func (it *recordRowIterator) Err() error {
+	return it.err
+}
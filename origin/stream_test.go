@@ -0,0 +1,136 @@
+package origin_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mashiike/psql-front/origin"
+	"github.com/stretchr/testify/require"
+)
+
+func readAllRecords(t *testing.T, r origin.RecordReader) [][]string {
+	t.Helper()
+	records := make([][]string, 0)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return records
+		}
+		require.NoError(t, err)
+		records = append(records, record)
+	}
+}
+
+func TestFormatConfigNewRecordReader(t *testing.T) {
+	columns := origin.ColumnConfigs{
+		{Name: "id", DataType: "BIGINT"},
+		{Name: "name", DataType: "TEXT"},
+	}
+	cases := []struct {
+		name    string
+		cfg     origin.FormatConfig
+		input   string
+		columns origin.ColumnConfigs
+	}{
+		{
+			name:  "csv",
+			cfg:   origin.FormatConfig{Format: "csv"},
+			input: "id,name\n1,hoge\n2,fuga\n",
+		},
+		{
+			name:  "custom delimiter, quote and comment",
+			cfg:   origin.FormatConfig{Format: "csv", Delimiter: "|", Quote: "'", Comment: "#"},
+			input: "# exported at 2022-08-01\nid|name\n1|'hoge|\"fuga\"'\n2|'it''s'\n",
+		},
+		{
+			name:    "ltsv with columns",
+			cfg:     origin.FormatConfig{Format: "ltsv"},
+			input:   "id:1\tname:hoge \n\nid:2\tname:fuga",
+			columns: columns,
+		},
+		{
+			name:  "ltsv with dotted labels",
+			cfg:   origin.FormatConfig{Format: "ltsv"},
+			input: "req.id:1\tname:hoge\nreq.id:2\tname:fuga\n",
+			columns: origin.ColumnConfigs{
+				{Name: "id", Path: "req.id"},
+				{Name: "name"},
+			},
+		},
+		{
+			name:    "jsonl with columns",
+			cfg:     origin.FormatConfig{Format: "jsonl"},
+			input:   "{\"id\":1,\"name\":\"hoge\"}\n\n{\"id\":2,\"name\":\"fuga\"}",
+			columns: columns,
+		},
+		{
+			name:  "jsonl without columns",
+			cfg:   origin.FormatConfig{Format: "jsonl"},
+			input: "{\"id\":1,\"name\":\"hoge\"}\n{\"id\":2,\"extra\":true}\n",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.NoError(t, c.cfg.Restrict())
+			expected, err := c.cfg.ReadRecords(strings.NewReader(c.input), c.columns)
+			require.NoError(t, err)
+			r, err := c.cfg.NewRecordReader(strings.NewReader(c.input), c.columns)
+			require.NoError(t, err)
+			require.EqualValues(t, expected, readAllRecords(t, r))
+		})
+	}
+}
+
+type closeRecorder struct {
+	closed *[]int
+	index  int
+}
+
+func (c closeRecorder) Close() error {
+	*c.closed = append(*c.closed, c.index)
+	return nil
+}
+
+func TestConcatRecordReaders(t *testing.T) {
+	sources := [][][]string{
+		{{"id", "name"}, {"1", "hoge"}},
+		{{"id", "name"}},
+		{{"id", "name"}, {"2", "fuga"}, {"3", "piyo"}},
+	}
+	opened := make([]int, 0)
+	closed := make([]int, 0)
+	r := origin.ConcatRecordReaders(len(sources), 1, func(i int) (origin.RecordReadCloser, error) {
+		opened = append(opened, i)
+		return origin.WithCloser(origin.NewSliceRecordReader(sources[i]), closeRecorder{closed: &closed, index: i}), nil
+	})
+	record, err := r.Read()
+	require.NoError(t, err)
+	require.EqualValues(t, []string{"id", "name"}, record)
+	require.EqualValues(t, []int{0}, opened, "sources are opened lazily")
+
+	require.EqualValues(t, [][]string{{"1", "hoge"}, {"2", "fuga"}, {"3", "piyo"}}, readAllRecords(t, r))
+	require.NoError(t, r.Close())
+	require.EqualValues(t, []int{0, 1, 2}, opened)
+	require.EqualValues(t, []int{0, 1, 2}, closed)
+}
+
+func TestColumnConfigsNewRowIterator(t *testing.T) {
+	columns := origin.ColumnConfigs{
+		{Name: "id", DataType: "BIGINT"},
+		{Name: "name", DataType: "TEXT"},
+	}
+	iter := columns.NewRowIterator(origin.NewSliceRecordReader([][]string{
+		{"id", "name"},
+		{"1", "hoge"},
+		{"2", ""},
+	}), 1)
+	rows := make([][]interface{}, 0)
+	for iter.Next() {
+		values, err := iter.Values()
+		require.NoError(t, err)
+		rows = append(rows, values)
+	}
+	require.NoError(t, iter.Err())
+	require.EqualValues(t, [][]interface{}{{int64(1), "hoge"}, {int64(2), nil}}, rows)
+}
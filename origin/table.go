@@ -2,16 +2,22 @@ package origin
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	psqlfront "github.com/mashiike/psql-front"
 )
 
 type BaseTableConfig struct {
-	schema  string        `yaml:"-"`
-	Name    string        `yaml:"name,omitempty"`
-	Columns ColumnConfigs `yaml:"columns,omitempty"`
+	schema          string         `yaml:"-"`
+	Name            string         `yaml:"name,omitempty"`
+	Columns         ColumnConfigs  `yaml:"columns,omitempty"`
+	RefreshSchedule string         `yaml:"refresh_schedule,omitempty"`
+	TTL             *time.Duration `yaml:"ttl,omitempty"`
+	MaxStaleness    *time.Duration `yaml:"max_staleness,omitempty"`
+	RefreshMode     string         `yaml:"refresh_mode,omitempty"`
 }
 
 func (cfg *BaseTableConfig) Restrict(schema string) error {
@@ -22,6 +28,22 @@ func (cfg *BaseTableConfig) Restrict(schema string) error {
 	if err := cfg.Columns.Restrict(); err != nil {
 		return err
 	}
+	if cfg.RefreshSchedule != "" {
+		if _, err := psqlfront.ParseRefreshSchedule(cfg.RefreshSchedule); err != nil {
+			return err
+		}
+	}
+	if cfg.TTL != nil && *cfg.TTL <= 0 {
+		return errors.New("ttl must be positive")
+	}
+	if cfg.MaxStaleness != nil && *cfg.MaxStaleness < 0 {
+		return errors.New("max_staleness must not be negative")
+	}
+	switch cfg.RefreshMode {
+	case "", psqlfront.RefreshModeSync, psqlfront.RefreshModeStaleWhileRevalidate:
+	default:
+		return fmt.Errorf("refresh_mode `%s` is invalid, must be %s or %s", cfg.RefreshMode, psqlfront.RefreshModeSync, psqlfront.RefreshModeStaleWhileRevalidate)
+	}
 	return nil
 }
 
@@ -35,11 +57,22 @@ func (cfg *BaseTableConfig) FetchRows(ctx context.Context, fetcher Fetcher, igno
 	return cfg.Columns.ToRows(rows, ignoreLines), nil
 }
 
+// StreamRows appends the records of fetcher to w without reading all records at once.
+func (cfg *BaseTableConfig) StreamRows(ctx context.Context, w psqlfront.CacheWriter, fetcher StreamFetcher, ignoreLines int) error {
+	return fetcher(ctx, func(r RecordReader) error {
+		return w.AppendRowIterator(ctx, cfg.Columns.NewRowIterator(r, ignoreLines))
+	})
+}
+
 func (cfg *BaseTableConfig) ToTable() *psqlfront.Table {
 	return &psqlfront.Table{
-		SchemaName: cfg.schema,
-		RelName:    cfg.Name,
-		Columns:    cfg.Columns.ToColumns(),
+		SchemaName:      cfg.schema,
+		RelName:         cfg.Name,
+		Columns:         cfg.Columns.ToColumns(),
+		RefreshSchedule: cfg.RefreshSchedule,
+		TTL:             cfg.TTL,
+		MaxStaleness:    cfg.MaxStaleness,
+		RefreshMode:     cfg.RefreshMode,
 	}
 }
 
@@ -0,0 +1,41 @@
+package origin_test
+
+import (
+	"testing"
+	"time"
+
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/mashiike/psql-front/origin"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestBaseTableConfigCachePolicy(t *testing.T) {
+	var cfg origin.BaseTableConfig
+	err := yaml.Unmarshal([]byte(`
+name: status
+columns:
+  - name: id
+    data_type: BIGINT
+ttl: 1m
+max_staleness: 10m
+refresh_mode: stale_while_revalidate
+`), &cfg)
+	require.NoError(t, err)
+	require.NoError(t, cfg.Restrict("example"))
+	table := cfg.ToTable()
+	require.Equal(t, time.Minute, *table.TTL)
+	require.Equal(t, 10*time.Minute, *table.MaxStaleness)
+	require.Equal(t, psqlfront.RefreshModeStaleWhileRevalidate, table.RefreshMode)
+
+	cfg.RefreshMode = "async"
+	require.EqualError(t, cfg.Restrict("example"), "refresh_mode `async` is invalid, must be sync or stale_while_revalidate")
+	cfg.RefreshMode = ""
+	cfg.TTL = psqlfront.PtrValue(time.Duration(0))
+	require.EqualError(t, cfg.Restrict("example"), "ttl must be positive")
+	cfg.TTL = nil
+	cfg.MaxStaleness = psqlfront.PtrValue(time.Duration(0))
+	require.NoError(t, cfg.Restrict("example"), "max_staleness 0 never serves expired rows")
+	cfg.MaxStaleness = psqlfront.PtrValue(-time.Minute)
+	require.EqualError(t, cfg.Restrict("example"), "max_staleness must not be negative")
+}
@@ -0,0 +1,136 @@
+package origin
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// XLSXRange is the parsed A1 notation range, such as `Sheet1!A1:C10` or `A:C`.
+// Row and column numbers are 1-based, and 0 means unbounded.
+type XLSXRange struct {
+	Sheet                 string
+	StartColumn, StartRow int
+	EndColumn, EndRow     int
+}
+
+var a1CellPattern = regexp.MustCompile(`^([A-Za-z]*)([0-9]*)$`)
+
+func parseA1Cell(cell string) (int, int, error) {
+	m := a1CellPattern.FindStringSubmatch(strings.TrimSpace(strings.ReplaceAll(cell, "$", "")))
+	if m == nil || (m[1] == "" && m[2] == "") {
+		return 0, 0, fmt.Errorf("invalid cell `%s`", cell)
+	}
+	var col, row int
+	var err error
+	if m[1] != "" {
+		if col, err = excelize.ColumnNameToNumber(m[1]); err != nil {
+			return 0, 0, err
+		}
+	}
+	if m[2] != "" {
+		if _, row, err = excelize.CellNameToCoordinates("A" + m[2]); err != nil {
+			return 0, 0, err
+		}
+	}
+	return col, row, nil
+}
+
+// ParseXLSXRange parses A1 notation, the sheet name prefix is optional.
+func ParseXLSXRange(s string) (*XLSXRange, error) {
+	r := &XLSXRange{}
+	if i := strings.LastIndex(s, "!"); i >= 0 {
+		r.Sheet = strings.Trim(s[:i], "'")
+		s = s[i+1:]
+	}
+	if s == "" {
+		return r, nil
+	}
+	start, end, found := strings.Cut(s, ":")
+	var err error
+	if r.StartColumn, r.StartRow, err = parseA1Cell(start); err != nil {
+		return nil, err
+	}
+	if !found {
+		r.EndColumn, r.EndRow = r.StartColumn, r.StartRow
+		return r, nil
+	}
+	if r.EndColumn, r.EndRow, err = parseA1Cell(end); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ReadXLSXRecords reads the records of a sheet in the xlsx workbook.
+// The sheet is selected by name or 0-based index, if both are empty the first sheet is used.
+func ReadXLSXRecords(r io.Reader, sheet string, sheetIndex *int, cellRange string) ([][]string, error) {
+	rng, err := ParseXLSXRange(cellRange)
+	if err != nil {
+		return nil, fmt.Errorf("range: %w", err)
+	}
+	if rng.Sheet != "" {
+		sheet = rng.Sheet
+	}
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("open xlsx: %w", err)
+	}
+	defer f.Close()
+	if sheet == "" {
+		index := 0
+		if sheetIndex != nil {
+			index = *sheetIndex
+		}
+		sheet = f.GetSheetName(index)
+		if sheet == "" {
+			return nil, fmt.Errorf("sheet index %d not found", index)
+		}
+	}
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		return nil, fmt.Errorf("get rows of sheet `%s`: %w", sheet, err)
+	}
+	return rng.Apply(rows), nil
+}
+
+// Apply cuts out the range from rows.
+func (r *XLSXRange) Apply(rows [][]string) [][]string {
+	if r.StartRow > 1 {
+		if r.StartRow > len(rows) {
+			return [][]string{}
+		}
+		rows = rows[r.StartRow-1:]
+	}
+	if r.EndRow > 0 {
+		n := r.EndRow
+		if r.StartRow > 1 {
+			n = r.EndRow - r.StartRow + 1
+		}
+		if n < len(rows) {
+			rows = rows[:n]
+		}
+	}
+	if r.StartColumn <= 1 && r.EndColumn == 0 {
+		return rows
+	}
+	records := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		start := 0
+		if r.StartColumn > 1 {
+			start = r.StartColumn - 1
+		}
+		end := len(row)
+		if r.EndColumn > 0 && r.EndColumn < end {
+			end = r.EndColumn
+		}
+		if start >= end {
+			records = append(records, []string{})
+			continue
+		}
+		records = append(records, row[start:end])
+	}
+	return records
+}
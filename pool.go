@@ -0,0 +1,411 @@
+package psqlfront
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+)
+
+const (
+	// PoolModeSession assigns an upstream connection to the client until it disconnects.
+	PoolModeSession = "session"
+	// PoolModeTransaction assigns an upstream connection to the client only during a transaction.
+	PoolModeTransaction = "transaction"
+)
+
+var (
+	// ErrPoolTimeout is returned when no upstream connection becomes available within queue_timeout.
+	ErrPoolTimeout = errors.New("timeout waiting for an upstream connection")
+	// ErrPoolQueueFull is returned when the number of the waiting clients reaches max_queue.
+	ErrPoolQueueFull = errors.New("too many clients waiting for an upstream connection")
+	// ErrPoolClosed is returned after the pool is closed.
+	ErrPoolClosed = errors.New("upstream pool is closed")
+)
+
+// resetQuery resets the session state of the upstream connection before another client uses it.
+const resetQuery = "DISCARD ALL"
+
+const resetTimeout = 10 * time.Second
+
+// UpstreamPool reuses the upstream connections authenticated by the service credential across the clients.
+// The connections are pooled per database, and the clients wait in a queue when all connections are in use.
+type UpstreamPool struct {
+	dialer       *UpstreamDialer
+	host         string
+	port         uint16
+	credential   *UpstreamCredential
+	mode         string
+	size         int
+	queueTimeout time.Duration
+	maxQueue     int
+
+	mu            sync.Mutex
+	total         int
+	idle          map[string][]*upstreamConn
+	waiters       []*poolWaiter
+	cancelTargets map[cancelKey]*ProxyConn
+	closed        bool
+}
+
+// upstreamConn is a connection of the pool, which has finished the startup.
+type upstreamConn struct {
+	conn              net.Conn
+	frontend          *pgproto3.Frontend
+	database          string
+	pid               uint32
+	secretKey         uint32
+	parameterStatuses map[string]string
+}
+
+type poolWaiter struct {
+	database string
+	// ch receives an idle connection of the database, or nil when the waiter can connect a new one.
+	ch chan *upstreamConn
+}
+
+type cancelKey struct {
+	pid       uint32
+	secretKey uint32
+}
+
+// NewUpstreamPool returns UpstreamPool to connect by the dialer with the credential.
+func NewUpstreamPool(dialer *UpstreamDialer, credential *UpstreamCredential, cfg *PoolConfig) (*UpstreamPool, error) {
+	host, portStr, err := net.SplitHostPort(dialer.Addr())
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	p := &UpstreamPool{
+		dialer:        dialer,
+		host:          host,
+		port:          uint16(port),
+		credential:    credential,
+		mode:          cfg.Mode,
+		size:          cfg.Size,
+		maxQueue:      cfg.MaxQueue,
+		idle:          make(map[string][]*upstreamConn),
+		cancelTargets: make(map[cancelKey]*ProxyConn),
+	}
+	if cfg.QueueTimeout != nil {
+		p.queueTimeout = *cfg.QueueTimeout
+	}
+	return p, nil
+}
+
+// Mode returns the pool mode, session or transaction.
+func (p *UpstreamPool) Mode() string {
+	return p.mode
+}
+
+// Close closes the idle connections, the connections in use are closed when they are released.
+func (p *UpstreamPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	idle := p.idle
+	p.idle = make(map[string][]*upstreamConn)
+	waiters := p.waiters
+	p.waiters = nil
+	p.mu.Unlock()
+	for _, conns := range idle {
+		for _, c := range conns {
+			c.close()
+		}
+	}
+	for _, w := range waiters {
+		close(w.ch)
+	}
+}
+
+// acquire returns an upstream connection of the database, it waits in the queue if all connections are in use.
+func (p *UpstreamPool) acquire(ctx context.Context, database string) (*upstreamConn, error) {
+	if database == "" {
+		database = p.credential.Database
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	if conns := p.idle[database]; len(conns) > 0 {
+		c := conns[len(conns)-1]
+		p.idle[database] = conns[:len(conns)-1]
+		p.mu.Unlock()
+		return c, nil
+	}
+	if p.total < p.size {
+		p.total++
+		p.mu.Unlock()
+		return p.connect(ctx, database)
+	}
+	if evicted := p.evictIdle(); evicted != nil {
+		// the slot of the idle connection of another database is reused.
+		p.mu.Unlock()
+		evicted.close()
+		return p.connect(ctx, database)
+	}
+	if p.maxQueue > 0 && len(p.waiters) >= p.maxQueue {
+		p.mu.Unlock()
+		return nil, ErrPoolQueueFull
+	}
+	w := &poolWaiter{
+		database: database,
+		ch:       make(chan *upstreamConn, 1),
+	}
+	p.waiters = append(p.waiters, w)
+	p.mu.Unlock()
+	log.Printf("[debug][%s] wait for an upstream connection of database `%s`", GetRemoteAddr(ctx), database)
+
+	var timeout <-chan time.Time
+	if p.queueTimeout > 0 {
+		timer := time.NewTimer(p.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var err error
+	select {
+	case c, ok := <-w.ch:
+		if !ok {
+			return nil, ErrPoolClosed
+		}
+		if c != nil {
+			return c, nil
+		}
+		return p.connect(ctx, database)
+	case <-timeout:
+		err = ErrPoolTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	p.mu.Lock()
+	for i, waiter := range p.waiters {
+		if waiter == w {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			p.mu.Unlock()
+			return nil, err
+		}
+	}
+	p.mu.Unlock()
+	// the waiter has been granted while timed out, give it back.
+	if c, ok := <-w.ch; ok {
+		if c != nil {
+			p.release(c, true)
+		} else {
+			p.freeSlot()
+		}
+	}
+	return nil, err
+}
+
+// evictIdle removes an idle connection of any database, it must be called with the lock.
+func (p *UpstreamPool) evictIdle() *upstreamConn {
+	for database, conns := range p.idle {
+		if len(conns) == 0 {
+			continue
+		}
+		c := conns[0]
+		p.idle[database] = conns[1:]
+		return c
+	}
+	return nil
+}
+
+// connect connects a new upstream connection, the caller must have a slot of the pool.
+func (p *UpstreamPool) connect(ctx context.Context, database string) (*upstreamConn, error) {
+	cfg, err := newUpstreamConfig(p.host, p.port, p.credential, database)
+	if err != nil {
+		p.freeSlot()
+		return nil, err
+	}
+	cfg.RuntimeParams["application_name"] = "psql-front"
+	cfg.LookupFunc = func(_ context.Context, host string) ([]string, error) {
+		return []string{host}, nil
+	}
+	cfg.DialFunc = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return p.dialer.DialContext(ctx)
+	}
+	pgConn, err := pgconn.ConnectConfig(ctx, cfg)
+	if err != nil {
+		p.freeSlot()
+		return nil, err
+	}
+	hijacked, err := pgConn.Hijack()
+	if err != nil {
+		p.freeSlot()
+		return nil, err
+	}
+	log.Printf("[debug][%s] new upstream connection of database `%s`: pid=%d", GetRemoteAddr(ctx), database, hijacked.PID)
+	return &upstreamConn{
+		conn:              hijacked.Conn,
+		frontend:          pgproto3.NewFrontend(pgproto3.NewChunkReader(hijacked.Conn), hijacked.Conn),
+		database:          database,
+		pid:               hijacked.PID,
+		secretKey:         hijacked.SecretKey,
+		parameterStatuses: hijacked.ParameterStatuses,
+	}, nil
+}
+
+// freeSlot passes the slot of a closed connection to the first waiter, or returns it to the pool.
+func (p *UpstreamPool) freeSlot() {
+	p.mu.Lock()
+	if len(p.waiters) > 0 && !p.closed {
+		w := p.waiters[0]
+		p.waiters = p.waiters[1:]
+		p.mu.Unlock()
+		w.ch <- nil
+		return
+	}
+	p.total--
+	p.mu.Unlock()
+}
+
+// release returns the connection to the pool after resetting the session state, so that the next client does not see the state of the previous one.
+// If reusable is false or the reset fails, the connection is closed.
+func (p *UpstreamPool) release(c *upstreamConn, reusable bool) {
+	if reusable {
+		if err := c.reset(); err != nil {
+			log.Printf("[warn] upstream pid=%d reset failed: %v", c.pid, err)
+			reusable = false
+		}
+	}
+	p.mu.Lock()
+	if !reusable || p.closed {
+		p.mu.Unlock()
+		c.close()
+		p.freeSlot()
+		return
+	}
+	for i, w := range p.waiters {
+		if w.database == c.database {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			p.mu.Unlock()
+			w.ch <- c
+			return
+		}
+	}
+	if len(p.waiters) > 0 {
+		// the waiters are of other databases.
+		p.mu.Unlock()
+		c.close()
+		p.freeSlot()
+		return
+	}
+	p.idle[c.database] = append(p.idle[c.database], c)
+	p.mu.Unlock()
+}
+
+// reset resets the session state of the connection, so that the next client does not see the state of the previous one.
+func (c *upstreamConn) reset() error {
+	if err := c.conn.SetDeadline(time.Now().Add(resetTimeout)); err != nil {
+		return err
+	}
+	if err := c.frontend.Send(&pgproto3.Query{String: resetQuery}); err != nil {
+		return err
+	}
+	var resetErr error
+	for {
+		msg, err := c.frontend.Receive()
+		if err != nil {
+			return err
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.ErrorResponse:
+			resetErr = fmt.Errorf("%s: %s", resetQuery, msg.Message)
+		case *pgproto3.ReadyForQuery:
+			if resetErr != nil {
+				return resetErr
+			}
+			if msg.TxStatus != 'I' {
+				return fmt.Errorf("transaction status is `%c` after %s", msg.TxStatus, resetQuery)
+			}
+			return c.conn.SetDeadline(time.Time{})
+		}
+	}
+}
+
+func (c *upstreamConn) close() {
+	if err := c.frontend.Send(&pgproto3.Terminate{}); err != nil {
+		log.Printf("[debug] upstream pid=%d send terminate: %v", c.pid, err)
+	}
+	if err := c.conn.Close(); err != nil {
+		log.Printf("[debug] upstream pid=%d close: %v", c.pid, err)
+	}
+}
+
+// registerCancelKey returns the key of BackendKeyData for the client, the cancel request of the key is sent to the upstream connection the client uses.
+func (p *UpstreamPool) registerCancelKey(conn *ProxyConn) (cancelKey, error) {
+	var buf [8]byte
+	for {
+		if _, err := rand.Read(buf[:]); err != nil {
+			return cancelKey{}, err
+		}
+		key := cancelKey{
+			pid:       binary.BigEndian.Uint32(buf[:4]),
+			secretKey: binary.BigEndian.Uint32(buf[4:]),
+		}
+		p.mu.Lock()
+		if _, ok := p.cancelTargets[key]; !ok {
+			p.cancelTargets[key] = conn
+			p.mu.Unlock()
+			return key, nil
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (p *UpstreamPool) unregisterCancelKey(key cancelKey) {
+	p.mu.Lock()
+	delete(p.cancelTargets, key)
+	p.mu.Unlock()
+}
+
+// cancel sends the cancel request to the upstream connection the client of the key uses now.
+func (p *UpstreamPool) cancel(ctx context.Context, key cancelKey) error {
+	p.mu.Lock()
+	target, ok := p.cancelTargets[key]
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	c := target.pooledConn()
+	if c == nil {
+		return nil
+	}
+	conn, err := p.dialer.DialContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write((&pgproto3.CancelRequest{ProcessID: c.pid, SecretKey: c.secretKey}).Encode(nil))
+	return err
+}
+
+// newUpstreamConfig returns the config of pgconn to connect upstream with the credential.
+func newUpstreamConfig(host string, port uint16, credential *UpstreamCredential, database string) (*pgconn.Config, error) {
+	cfg, err := pgconn.ParseConfig("sslmode=disable")
+	if err != nil {
+		return nil, err
+	}
+	cfg.Host = host
+	cfg.Port = port
+	cfg.User = credential.User
+	cfg.Password = credential.Password
+	cfg.Database = credential.Database
+	if database != "" {
+		cfg.Database = database
+	}
+	cfg.RuntimeParams = make(map[string]string)
+	return cfg, nil
+}
@@ -0,0 +1,279 @@
+package psqlfront_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeUpstream is a PostgreSQL server which accepts any user, and answers `SELECT pg_backend_pid()`.
+// It keeps `SET search_path TO ...` and `PREPARE <name> AS ...` per connection until `DISCARD ALL`.
+type fakeUpstream struct {
+	listener    net.Listener
+	connections int32
+	mu          sync.Mutex
+	queries     []string
+}
+
+func newFakeUpstream(t *testing.T) *fakeUpstream {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f := &fakeUpstream{listener: listener}
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			pid := uint32(atomic.AddInt32(&f.connections, 1))
+			go f.serve(c, pid)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return f
+}
+
+func (f *fakeUpstream) serve(c net.Conn, pid uint32) {
+	defer c.Close()
+	backend := pgproto3.NewBackend(pgproto3.NewChunkReader(c), c)
+	if _, err := backend.ReceiveStartupMessage(); err != nil {
+		return
+	}
+	for _, msg := range []pgproto3.BackendMessage{
+		&pgproto3.AuthenticationOk{},
+		&pgproto3.ParameterStatus{Name: "server_version", Value: "13.0"},
+		&pgproto3.BackendKeyData{ProcessID: pid, SecretKey: pid},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	} {
+		if err := backend.Send(msg); err != nil {
+			return
+		}
+	}
+	txStatus := byte('I')
+	searchPath := "public"
+	prepared := make(map[string]bool)
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		q, ok := msg.(*pgproto3.Query)
+		if !ok {
+			return
+		}
+		f.mu.Lock()
+		f.queries = append(f.queries, q.String)
+		f.mu.Unlock()
+		switch {
+		case q.String == "BEGIN":
+			txStatus = 'T'
+		case q.String == "COMMIT":
+			txStatus = 'I'
+		case q.String == "DISCARD ALL":
+			searchPath = "public"
+			prepared = make(map[string]bool)
+		case q.String == "SELECT pg_backend_pid()":
+			sendTextRow(backend, "pg_backend_pid", strconv.Itoa(int(pid)))
+		case q.String == "SHOW search_path":
+			sendTextRow(backend, "search_path", searchPath)
+		case strings.HasPrefix(q.String, "SET search_path TO "):
+			searchPath = strings.TrimPrefix(q.String, "SET search_path TO ")
+		case strings.HasPrefix(q.String, "PREPARE "):
+			name, _, _ := strings.Cut(strings.TrimPrefix(q.String, "PREPARE "), " ")
+			prepared[name] = true
+		case strings.HasPrefix(q.String, "EXECUTE "):
+			name := strings.TrimPrefix(q.String, "EXECUTE ")
+			if !prepared[name] {
+				backend.Send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "26000", Message: fmt.Sprintf("prepared statement \"%s\" does not exist", name)})
+				backend.Send(&pgproto3.ReadyForQuery{TxStatus: txStatus})
+				continue
+			}
+		}
+		backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("OK")})
+		backend.Send(&pgproto3.ReadyForQuery{TxStatus: txStatus})
+	}
+}
+
+func sendTextRow(backend *pgproto3.Backend, name string, value string) {
+	backend.Send(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{{Name: []byte(name), DataTypeOID: 25, DataTypeSize: -1, TypeModifier: -1}}})
+	backend.Send(&pgproto3.DataRow{Values: [][]byte{[]byte(value)}})
+}
+
+func (f *fakeUpstream) executed(query string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var n int
+	for _, q := range f.queries {
+		if q == query {
+			n++
+		}
+	}
+	return n
+}
+
+func startPooledProxy(t *testing.T, upstream *fakeUpstream, cfg *psqlfront.PoolConfig) string {
+	t.Helper()
+	require.NoError(t, cfg.Restrict())
+	authenticator, err := psqlfront.NewAuthenticator(psqlfront.AuthMethodMD5, map[string]string{"alice": "alice-password"})
+	require.NoError(t, err)
+	credential := &psqlfront.UpstreamCredential{User: "service", Database: "postgres"}
+	host, port, err := net.SplitHostPort(upstream.listener.Addr().String())
+	require.NoError(t, err)
+	portNum, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	dialer, err := psqlfront.NewUpstreamDialer(&psqlfront.CacheDatabaseConfig{Host: host, Port: portNum, SSLMode: "disable"})
+	require.NoError(t, err)
+	pool, err := psqlfront.NewUpstreamPool(dialer, credential, cfg)
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for {
+			client, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn, err := psqlfront.NewProxyConn(client, nil,
+				psqlfront.WithProxyConnAuthentication(authenticator, credential),
+				psqlfront.WithProxyConnPool(pool),
+			)
+			if err != nil {
+				client.Close()
+				continue
+			}
+			go conn.Run(ctx)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		listener.Close()
+		pool.Close()
+	})
+	return listener.Addr().String()
+}
+
+func connectPooledProxy(ctx context.Context, t *testing.T, addr string) (*pgconn.PgConn, error) {
+	t.Helper()
+	host, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	return pgconn.Connect(ctx, fmt.Sprintf("host=%s port=%s user=alice password=alice-password sslmode=disable", host, port))
+}
+
+func backendPID(ctx context.Context, t *testing.T, conn *pgconn.PgConn) string {
+	t.Helper()
+	return queryValue(ctx, t, conn, "SELECT pg_backend_pid()")
+}
+
+func queryValue(ctx context.Context, t *testing.T, conn *pgconn.PgConn, query string) string {
+	t.Helper()
+	results, err := conn.Exec(ctx, query).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Len(t, results[0].Rows, 1)
+	return string(results[0].Rows[0][0])
+}
+
+func TestUpstreamPoolTransactionMode(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	addr := startPooledProxy(t, upstream, &psqlfront.PoolConfig{
+		Mode: psqlfront.PoolModeTransaction,
+		Size: 1,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client1, err := connectPooledProxy(ctx, t, addr)
+	require.NoError(t, err)
+	defer client1.Close(ctx)
+	client2, err := connectPooledProxy(ctx, t, addr)
+	require.NoError(t, err)
+	defer client2.Close(ctx)
+
+	_, err = client1.Exec(ctx, "BEGIN").ReadAll()
+	require.NoError(t, err)
+	pid2 := make(chan string, 1)
+	go func() {
+		pid2 <- backendPID(ctx, t, client2)
+	}()
+	select {
+	case <-pid2:
+		require.Fail(t, "client2 must wait for the transaction of client1")
+	case <-time.After(200 * time.Millisecond):
+	}
+	pid1 := backendPID(ctx, t, client1)
+	_, err = client1.Exec(ctx, "COMMIT").ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, pid1, <-pid2, "the upstream connection is shared")
+	require.EqualValues(t, 1, atomic.LoadInt32(&upstream.connections))
+}
+
+func TestUpstreamPoolTransactionModeResetsSessionState(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	addr := startPooledProxy(t, upstream, &psqlfront.PoolConfig{
+		Mode: psqlfront.PoolModeTransaction,
+		Size: 1,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client1, err := connectPooledProxy(ctx, t, addr)
+	require.NoError(t, err)
+	defer client1.Close(ctx)
+	client2, err := connectPooledProxy(ctx, t, addr)
+	require.NoError(t, err)
+	defer client2.Close(ctx)
+
+	_, err = client1.Exec(ctx, "SET search_path TO restricted").ReadAll()
+	require.NoError(t, err)
+	_, err = client1.Exec(ctx, "PREPARE stmt AS SELECT 1").ReadAll()
+	require.NoError(t, err)
+	pid1 := backendPID(ctx, t, client1)
+
+	require.Equal(t, pid1, backendPID(ctx, t, client2), "the upstream connection is shared")
+	require.Equal(t, "public", queryValue(ctx, t, client2, "SHOW search_path"), "SET of client1 is not visible")
+	_, err = client2.Exec(ctx, "EXECUTE stmt").ReadAll()
+	require.ErrorContains(t, err, "26000", "the prepared statement of client1 is not visible")
+	require.EqualValues(t, 1, atomic.LoadInt32(&upstream.connections))
+}
+
+func TestUpstreamPoolSessionMode(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	addr := startPooledProxy(t, upstream, &psqlfront.PoolConfig{
+		Mode:         psqlfront.PoolModeSession,
+		Size:         1,
+		QueueTimeout: psqlfront.PtrValue(200 * time.Millisecond),
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client1, err := connectPooledProxy(ctx, t, addr)
+	require.NoError(t, err)
+	pid1 := backendPID(ctx, t, client1)
+
+	_, err = connectPooledProxy(ctx, t, addr)
+	require.ErrorContains(t, err, "53300", "queue timeout")
+
+	require.NoError(t, client1.Close(ctx))
+	require.Eventually(t, func() bool {
+		return upstream.executed("DISCARD ALL") == 1
+	}, 5*time.Second, 10*time.Millisecond, "reset before reuse")
+
+	client3, err := connectPooledProxy(ctx, t, addr)
+	require.NoError(t, err)
+	defer client3.Close(ctx)
+	require.Equal(t, pid1, backendPID(ctx, t, client3), "the upstream connection is reused")
+	require.EqualValues(t, 1, atomic.LoadInt32(&upstream.connections))
+}
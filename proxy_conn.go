@@ -3,13 +3,19 @@ package psqlfront
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgproto3/v2"
+	"github.com/samber/lo"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -27,9 +33,35 @@ func (n *notifier) Notify(ctx context.Context, resp *pgproto3.NoticeResponse) er
 	return n.backend.Send(resp)
 }
 
+// QueryRejectedError is returned by the query received handler to reject the query.
+// The query is not sent to upstream, and the client receives the ErrorResponse of Code and Message.
+type QueryRejectedError struct {
+	Code    string
+	Message string
+	Detail  string
+}
+
+func (e *QueryRejectedError) Error() string {
+	if e.Detail == "" {
+		return e.Message
+	}
+	return e.Message + ": " + e.Detail
+}
+
 type ProxyConnOptions struct {
 	tlsConfig              *tls.Config
 	onQueryReceivedHandler ProxyConnOnQueryReceivedHandlerFunc
+	authenticator          *Authenticator
+	upstreamCredential     *UpstreamCredential
+	pool                   *UpstreamPool
+}
+
+// UpstreamCredential is the service credential to connect upstream on behalf of the authenticated client.
+// Database is used if the client does not specify the database.
+type UpstreamCredential struct {
+	User     string
+	Password string
+	Database string
 }
 
 type ProxyConn struct {
@@ -41,6 +73,27 @@ type ProxyConn struct {
 	idleTimeout time.Duration
 	cancel      context.CancelFunc
 	isClosed    bool
+
+	// txStatus is the transaction status of the last ReadyForQuery from upstream.
+	txStatus atomic.Value
+	// discardUntilSync is true after a Parse is rejected, messages of the extended query are not sent to upstream until Sync.
+	discardUntilSync bool
+	// skipUpstreamError is true while the ErrorResponse of abortTransactionQuery is expected from upstream.
+	skipUpstreamError atomic.Bool
+	// session holds the psqlfront.* settings of the connection, the handler gets it by GetSession.
+	session *Session
+
+	// poolMu guards pooled, pending and relayDone.
+	poolMu sync.Mutex
+	// pooled is the upstream connection of the pool the client uses now.
+	pooled *upstreamConn
+	// pending is the number of ReadyForQuery the client waits for from the pooled connection.
+	pending int
+	// relayDone is closed when the relay of the pooled connection finishes.
+	relayDone  chan struct{}
+	relayGroup *errgroup.Group
+	database   string
+	cancelKey  cancelKey
 }
 
 func WithProxyConnTLS(tlsConfig *tls.Config) func(opts *ProxyConnOptions) {
@@ -55,13 +108,33 @@ func WithProxyConnOnQueryReceived(handler ProxyConnOnQueryReceivedHandlerFunc) f
 	}
 }
 
+// WithProxyConnAuthentication makes the proxy conn authenticate the client by the authenticator,
+// and connect upstream with the credential instead of forwarding the client's authentication.
+func WithProxyConnAuthentication(authenticator *Authenticator, credential *UpstreamCredential) func(opts *ProxyConnOptions) {
+	return func(opts *ProxyConnOptions) {
+		opts.authenticator = authenticator
+		opts.upstreamCredential = credential
+	}
+}
+
+// WithProxyConnPool makes the proxy conn use the upstream connections of the pool, instead of the upstream conn of the client.
+// It needs WithProxyConnAuthentication, because the pooled connections are authenticated by the service credential.
+func WithProxyConnPool(pool *UpstreamPool) func(opts *ProxyConnOptions) {
+	return func(opts *ProxyConnOptions) {
+		opts.pool = pool
+	}
+}
+
 func NewProxyConn(client net.Conn, upstream net.Conn, optFns ...func(opts *ProxyConnOptions)) (*ProxyConn, error) {
 	conn := &ProxyConn{
 		backend:  pgproto3.NewBackend(pgproto3.NewChunkReader(client), client),
-		frontend: pgproto3.NewFrontend(pgproto3.NewChunkReader(upstream), upstream),
 		opts:     &ProxyConnOptions{},
 		client:   client,
 		upstream: upstream,
+		session:  NewSession(),
+	}
+	if upstream != nil {
+		conn.frontend = pgproto3.NewFrontend(pgproto3.NewChunkReader(upstream), upstream)
 	}
 	for _, optFn := range optFns {
 		optFn(conn.opts)
@@ -71,6 +144,7 @@ func NewProxyConn(client net.Conn, upstream net.Conn, optFns ...func(opts *Proxy
 
 func (conn *ProxyConn) Run(ctx context.Context) error {
 	defer conn.close()
+	ctx = withSession(ctx, conn.session)
 	remoteAddr := conn.client.RemoteAddr()
 	log.Printf("[debug][%s] start proxy connection", remoteAddr)
 	defer log.Printf("[debug][%s] end proxy connection", remoteAddr)
@@ -112,21 +186,46 @@ func (conn *ProxyConn) Run(ctx context.Context) error {
 			return conn.wrapError(ctx, err, "send gss enc not support")
 		}
 	}
-	if startupMessage, ok := startupMessage.(*pgproto3.StartupMessage); ok {
+	if cr, ok := startupMessage.(*pgproto3.CancelRequest); ok && conn.opts.pool != nil {
+		log.Printf("[debug][%s] cancel request to pooled upstream connection", remoteAddr)
+		if err := conn.opts.pool.cancel(ctx, cancelKey{pid: cr.ProcessID, secretKey: cr.SecretKey}); err != nil {
+			return fmt.Errorf("cancel request:%w", err)
+		}
+		return nil
+	}
+	sm, isStartup := startupMessage.(*pgproto3.StartupMessage)
+	if !isStartup && conn.upstream == nil {
+		return fmt.Errorf("unexpected startup message %T", startupMessage)
+	}
+	if isStartup {
 		var builder strings.Builder
-		fmt.Fprintf(&builder, "protocol_version:%d", startupMessage.ProtocolVersion)
-		for key, value := range startupMessage.Parameters {
+		fmt.Fprintf(&builder, "protocol_version:%d", sm.ProtocolVersion)
+		for key, value := range sm.Parameters {
 			fmt.Fprintf(&builder, " %s:%s", key, value)
 		}
 		log.Printf("[info][%s] %s", remoteAddr, builder.String())
 	}
-	log.Printf("[debug][%s] send startup message to upstream", remoteAddr)
-	if err := conn.frontend.Send(startupMessage); err != nil {
-		return conn.wrapError(ctx, err, "frontend send startup message")
+	if isStartup && conn.opts.authenticator != nil {
+		authenticated, err := conn.authenticate(ctx, sm)
+		if err != nil {
+			return err
+		}
+		if !authenticated {
+			return nil
+		}
+	} else {
+		log.Printf("[debug][%s] send startup message to upstream", remoteAddr)
+		if err := conn.frontend.Send(startupMessage); err != nil {
+			return conn.wrapError(ctx, err, "frontend send startup message")
+		}
+	}
+	if isStartup {
+		ctx = withUser(ctx, sm.Parameters["user"])
 	}
 	var cancelCtx context.Context
 	cancelCtx, conn.cancel = context.WithCancel(ctx)
 	eg, egCtx := errgroup.WithContext(cancelCtx)
+	conn.relayGroup = eg
 	eg.Go(func() error {
 		defer conn.cancel()
 		for {
@@ -145,34 +244,41 @@ func (conn *ProxyConn) Run(ctx context.Context) error {
 			switch fm := fm.(type) {
 			case *pgproto3.Query:
 				log.Printf("[info][%s] receive message from client: incoming SQL: %s", remoteAddr, fm.String)
-				if conn.opts.onQueryReceivedHandler != nil {
-					if err := conn.opts.onQueryReceivedHandler(egCtx, fm.String, false, &notifier{backend: conn.backend}); err != nil {
-						log.Printf("[error] on query received: %v", err)
-						if err := conn.backend.Send(&pgproto3.ErrorResponse{
-							Severity: "ERROR",
-							Code:     "58030",
-							Message:  "Failed on query received handler",
-							Detail:   err.Error(),
-						}); err != nil {
-							return conn.wrapError(egCtx, err, "on query recived")
+				rejected, err := conn.onQueryReceived(egCtx, fm.String, false)
+				if err != nil {
+					return err
+				}
+				if rejected {
+					if conn.TxStatus() != 'I' {
+						// upstream sends ReadyForQuery of the failed transaction to the client.
+						if err := conn.abortTransaction(egCtx, &pgproto3.Query{String: abortTransactionQuery}); err != nil {
+							return conn.wrapError(egCtx, err, "abort transaction of upstream")
 						}
+						continue
 					}
+					if err := conn.backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'}); err != nil {
+						return conn.wrapError(egCtx, err, "send ready for query to client")
+					}
+					continue
 				}
 			case *pgproto3.Parse:
 				log.Printf("[info][%s] receive message from client: parse SQL: %s name=%s", remoteAddr, fm.Query, fm.Name)
-				if conn.opts.onQueryReceivedHandler != nil {
-					if err := conn.opts.onQueryReceivedHandler(egCtx, fm.Query, true, &notifier{backend: conn.backend}); err != nil {
-						log.Printf("[error] on query received: %v", err)
-						if err := conn.backend.Send(&pgproto3.ErrorResponse{
-							Severity: "ERROR",
-							Code:     "58030",
-							Message:  "Failed on query received handler",
-							Detail:   err.Error(),
-						}); err != nil {
-							return conn.wrapError(egCtx, err, "on query recived")
+				rejected, err := conn.onQueryReceived(egCtx, fm.Query, true)
+				if err != nil {
+					return err
+				}
+				if rejected {
+					if !conn.discardUntilSync && conn.TxStatus() != 'I' {
+						if err := conn.abortTransaction(egCtx, &pgproto3.Parse{Query: abortTransactionQuery}); err != nil {
+							return conn.wrapError(egCtx, err, "abort transaction of upstream")
 						}
 					}
+					conn.discardUntilSync = true
+					continue
 				}
+			case *pgproto3.Sync:
+				log.Printf("[debug][%s] receive message from client: sync", remoteAddr)
+				conn.discardUntilSync = false
 			case *pgproto3.Describe:
 				log.Printf("[debug][%s] receive message from client: describe: %s type='%c'", remoteAddr, fm.Name, fm.ObjectType)
 			case *pgproto3.Bind:
@@ -181,8 +287,10 @@ func (conn *ProxyConn) Run(ctx context.Context) error {
 				log.Printf("[debug][%s] receive message from client: execute: %s max_rows=%d", remoteAddr, fm.Portal, fm.MaxRows)
 			case *pgproto3.Terminate:
 				log.Printf("[debug][%s] receive message from client: connection terminate", remoteAddr)
-				if err := conn.frontend.Send(fm); err != nil {
-					return conn.wrapError(egCtx, err, "send terminate message to upstream")
+				if conn.opts.pool == nil {
+					if err := conn.frontend.Send(fm); err != nil {
+						return conn.wrapError(egCtx, err, "send terminate message to upstream")
+					}
 				}
 				if err := conn.backend.Send(&pgproto3.CloseComplete{}); err != nil {
 					return conn.wrapError(egCtx, err, "send close complete message to client")
@@ -191,13 +299,28 @@ func (conn *ProxyConn) Run(ctx context.Context) error {
 			default:
 				log.Printf("[debug][%s] receive message from client: %T", remoteAddr, fm)
 			}
-			err = conn.frontend.Send(fm)
+			if conn.discardUntilSync {
+				log.Printf("[debug][%s] discard message until sync: %T", remoteAddr, fm)
+				continue
+			}
+			err = conn.sendUpstream(egCtx, fm)
 			if err != nil {
 				return conn.wrapError(egCtx, err, "send message to upstream")
 			}
 		}
 	})
+	if conn.opts.pool != nil {
+		conn.poolMu.Lock()
+		if conn.pooled != nil {
+			conn.startRelay(egCtx, conn.pooled)
+		}
+		conn.poolMu.Unlock()
+	}
 	eg.Go(func() error {
+		if conn.opts.pool != nil {
+			// the pooled connections are relayed by startRelay.
+			return nil
+		}
 		defer conn.cancel()
 		for {
 			select {
@@ -213,12 +336,17 @@ func (conn *ProxyConn) Run(ctx context.Context) error {
 			switch bm := bm.(type) {
 			case *pgproto3.ParameterStatus:
 				log.Printf("[debug][%s] set parameter status name=%s, value=%s", remoteAddr, bm.Name, bm.Value)
+			case *pgproto3.ReadyForQuery:
+				conn.txStatus.Store(bm.TxStatus)
 			case *pgproto3.CloseComplete:
 				log.Printf("[debug][%s] close complete from upstream", remoteAddr)
 				return nil
 			default:
 				log.Printf("[debug][%s] receive message from upstream: %T", remoteAddr, bm)
 			}
+			if conn.skipUpstreamMessage(bm) {
+				continue
+			}
 			err = conn.backend.Send(bm)
 			if err != nil {
 				return conn.wrapError(egCtx, err, "send message to client")
@@ -238,6 +366,336 @@ func (conn *ProxyConn) Run(ctx context.Context) error {
 	return nil
 }
 
+// authenticate authenticates the client by the authenticator, and connects upstream with the service credential.
+// authenticated is false if the client is rejected, the ErrorResponse is already sent to the client.
+func (conn *ProxyConn) authenticate(ctx context.Context, sm *pgproto3.StartupMessage) (authenticated bool, err error) {
+	remoteAddr := conn.client.RemoteAddr()
+	user := sm.Parameters["user"]
+	if err := conn.opts.authenticator.Authenticate(conn.backend, user); err != nil {
+		if !errors.Is(err, ErrAuthenticationFailed) {
+			return false, conn.wrapError(ctx, err, "authenticate client")
+		}
+		log.Printf("[warn][%s] password authentication failed for user `%s`", remoteAddr, user)
+		return false, conn.sendFatal(ctx, "28P01", fmt.Sprintf("password authentication failed for user \"%s\"", user))
+	}
+	log.Printf("[info][%s] user `%s` authenticated by %s", remoteAddr, user, conn.opts.authenticator.Method())
+	if conn.opts.pool != nil {
+		return conn.startupPooled(ctx, sm)
+	}
+	hijacked, err := conn.connectUpstream(ctx, sm)
+	if err != nil {
+		log.Printf("[error][%s] can not connect upstream: %v", remoteAddr, err)
+		// the upstream conn is closed by pgconn.
+		conn.upstream = nil
+		return false, conn.sendFatal(ctx, "08006", "psql-front can not connect upstream")
+	}
+	conn.upstream = hijacked.Conn
+	conn.frontend = pgproto3.NewFrontend(pgproto3.NewChunkReader(hijacked.Conn), hijacked.Conn)
+	conn.txStatus.Store(hijacked.TxStatus)
+	if _, err := conn.ExtendDeadline(); err != nil {
+		return false, conn.wrapError(ctx, err, "extend deadline")
+	}
+	msgs := []pgproto3.BackendMessage{&pgproto3.AuthenticationOk{}}
+	for _, name := range lo.Keys(hijacked.ParameterStatuses) {
+		msgs = append(msgs, &pgproto3.ParameterStatus{Name: name, Value: hijacked.ParameterStatuses[name]})
+	}
+	msgs = append(msgs,
+		&pgproto3.BackendKeyData{ProcessID: hijacked.PID, SecretKey: hijacked.SecretKey},
+		&pgproto3.ReadyForQuery{TxStatus: hijacked.TxStatus},
+	)
+	for _, msg := range msgs {
+		if err := conn.backend.Send(msg); err != nil {
+			return false, conn.wrapError(ctx, err, "send %T to client", msg)
+		}
+	}
+	return true, nil
+}
+
+// connectUpstream runs the startup of upstream with the service credential over the upstream conn,
+// the client's startup parameters except user are passed through.
+func (conn *ProxyConn) connectUpstream(ctx context.Context, sm *pgproto3.StartupMessage) (*pgconn.HijackedConn, error) {
+	host, portStr, err := net.SplitHostPort(conn.upstream.RemoteAddr().String())
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := newUpstreamConfig(host, uint16(port), conn.opts.upstreamCredential, sm.Parameters["database"])
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range sm.Parameters {
+		if key != "user" && key != "database" {
+			cfg.RuntimeParams[key] = value
+		}
+	}
+	upstream := conn.upstream
+	cfg.LookupFunc = func(_ context.Context, host string) ([]string, error) {
+		return []string{host}, nil
+	}
+	cfg.DialFunc = func(_ context.Context, _, _ string) (net.Conn, error) {
+		if upstream == nil {
+			return nil, errors.New("upstream conn is already used")
+		}
+		c := upstream
+		upstream = nil
+		return c, nil
+	}
+	pgConn, err := pgconn.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return pgConn.Hijack()
+}
+
+// startupPooled acquires a connection of the pool, and sends its parameter statuses to the client.
+// In transaction mode, the connection is released soon, and acquired again by sendUpstream.
+func (conn *ProxyConn) startupPooled(ctx context.Context, sm *pgproto3.StartupMessage) (bool, error) {
+	remoteAddr := conn.client.RemoteAddr()
+	pool := conn.opts.pool
+	conn.database = sm.Parameters["database"]
+	for key, value := range sm.Parameters {
+		if key != "user" && key != "database" {
+			log.Printf("[debug][%s] startup parameter %s=%s is ignored by the pooled connection", remoteAddr, key, value)
+		}
+	}
+	up, err := pool.acquire(ctx, conn.database)
+	if err != nil {
+		log.Printf("[error][%s] can not acquire upstream connection: %v", remoteAddr, err)
+		return false, conn.sendFatal(ctx, "53300", fmt.Sprintf("psql-front can not acquire upstream connection: %v", err))
+	}
+	key, err := pool.registerCancelKey(conn)
+	if err != nil {
+		pool.release(up, true)
+		return false, err
+	}
+	conn.cancelKey = key
+	conn.txStatus.Store(byte('I'))
+	msgs := []pgproto3.BackendMessage{&pgproto3.AuthenticationOk{}}
+	for _, name := range lo.Keys(up.parameterStatuses) {
+		msgs = append(msgs, &pgproto3.ParameterStatus{Name: name, Value: up.parameterStatuses[name]})
+	}
+	msgs = append(msgs,
+		&pgproto3.BackendKeyData{ProcessID: key.pid, SecretKey: key.secretKey},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	)
+	if pool.Mode() == PoolModeTransaction {
+		pool.release(up, true)
+	} else {
+		conn.poolMu.Lock()
+		conn.pooled = up
+		conn.poolMu.Unlock()
+	}
+	for _, msg := range msgs {
+		if err := conn.backend.Send(msg); err != nil {
+			return false, conn.wrapError(ctx, err, "send %T to client", msg)
+		}
+	}
+	return true, nil
+}
+
+// sendUpstream sends the message to upstream. With the pool, it acquires a connection if the client has none,
+// and counts the messages that ReadyForQuery responds to.
+func (conn *ProxyConn) sendUpstream(ctx context.Context, msg pgproto3.FrontendMessage) error {
+	if conn.opts.pool == nil {
+		return conn.frontend.Send(msg)
+	}
+	conn.poolMu.Lock()
+	defer conn.poolMu.Unlock()
+	if conn.pooled == nil {
+		up, err := conn.opts.pool.acquire(ctx, conn.database)
+		if err != nil {
+			if sendErr := conn.sendFatal(ctx, "53300", fmt.Sprintf("psql-front can not acquire upstream connection: %v", err)); sendErr != nil {
+				log.Printf("[warn][%s] %v", conn.client.RemoteAddr(), sendErr)
+			}
+			return err
+		}
+		conn.pooled = up
+		conn.startRelay(ctx, up)
+	}
+	switch msg.(type) {
+	case *pgproto3.Query, *pgproto3.Sync, *pgproto3.FunctionCall:
+		conn.pending++
+	}
+	return conn.pooled.frontend.Send(msg)
+}
+
+// startRelay starts to relay the messages from the pooled connection to the client, it must be called with poolMu.
+func (conn *ProxyConn) startRelay(ctx context.Context, up *upstreamConn) {
+	done := make(chan struct{})
+	conn.relayDone = done
+	conn.relayGroup.Go(func() error {
+		defer close(done)
+		return conn.relay(ctx, up)
+	})
+}
+
+// relay sends the messages from the pooled connection to the client.
+// In transaction mode, it releases the connection when the client is idle and waits for no response,
+// the session state of the client is reset by the pool before another client uses it.
+func (conn *ProxyConn) relay(ctx context.Context, up *upstreamConn) error {
+	remoteAddr := conn.client.RemoteAddr()
+	for {
+		bm, err := up.frontend.Receive()
+		if err != nil {
+			conn.poolMu.Lock()
+			if conn.pooled != up {
+				// the connection is reclaimed by close.
+				conn.poolMu.Unlock()
+				return nil
+			}
+			conn.pooled = nil
+			conn.poolMu.Unlock()
+			conn.opts.pool.release(up, false)
+			return conn.wrapError(ctx, err, "receive message from upstream")
+		}
+		switch bm := bm.(type) {
+		case *pgproto3.ParameterStatus:
+			log.Printf("[debug][%s] set parameter status name=%s, value=%s", remoteAddr, bm.Name, bm.Value)
+		case *pgproto3.ReadyForQuery:
+			conn.txStatus.Store(bm.TxStatus)
+		default:
+			log.Printf("[debug][%s] receive message from upstream pid=%d: %T", remoteAddr, up.pid, bm)
+		}
+		if conn.skipUpstreamMessage(bm) {
+			continue
+		}
+		if err := conn.backend.Send(bm); err != nil {
+			return conn.wrapError(ctx, err, "send message to client")
+		}
+		rfq, ok := bm.(*pgproto3.ReadyForQuery)
+		if !ok {
+			continue
+		}
+		conn.poolMu.Lock()
+		conn.pending--
+		if conn.opts.pool.Mode() == PoolModeTransaction && rfq.TxStatus == 'I' && conn.pending <= 0 {
+			conn.pending = 0
+			conn.pooled = nil
+			conn.poolMu.Unlock()
+			log.Printf("[debug][%s] release upstream connection pid=%d", remoteAddr, up.pid)
+			conn.opts.pool.release(up, true)
+			return nil
+		}
+		conn.poolMu.Unlock()
+	}
+}
+
+// pooledConn returns the upstream connection of the pool the client uses now.
+func (conn *ProxyConn) pooledConn() *upstreamConn {
+	conn.poolMu.Lock()
+	defer conn.poolMu.Unlock()
+	return conn.pooled
+}
+
+// reclaimPooled stops the relay, and returns the pooled connection to the pool.
+// The connection is closed if the client leaves it in a transaction or waiting for responses.
+func (conn *ProxyConn) reclaimPooled() {
+	remoteAddr := conn.client.RemoteAddr()
+	conn.opts.pool.unregisterCancelKey(conn.cancelKey)
+	conn.poolMu.Lock()
+	up := conn.pooled
+	conn.pooled = nil
+	pending := conn.pending
+	done := conn.relayDone
+	conn.poolMu.Unlock()
+	if up == nil {
+		return
+	}
+	if done != nil {
+		if err := up.conn.SetReadDeadline(time.Now()); err != nil {
+			log.Printf("[debug][%s] upstream pid=%d set read deadline: %v", remoteAddr, up.pid, err)
+		}
+		<-done
+	}
+	reusable := pending <= 0 && conn.TxStatus() == 'I'
+	log.Printf("[debug][%s] release upstream connection pid=%d reusable=%v", remoteAddr, up.pid, reusable)
+	conn.opts.pool.release(up, reusable)
+}
+
+func (conn *ProxyConn) sendFatal(ctx context.Context, code string, message string) error {
+	err := conn.backend.Send(&pgproto3.ErrorResponse{
+		Severity: "FATAL",
+		Code:     code,
+		Message:  message,
+	})
+	if err != nil {
+		return conn.wrapError(ctx, err, "send error response to client")
+	}
+	return nil
+}
+
+// onQueryReceived calls the query received handler, and sends the ErrorResponse if the handler returns an error.
+// rejected is true if the query must not be sent to upstream.
+func (conn *ProxyConn) onQueryReceived(ctx context.Context, query string, isPreparedStmt bool) (rejected bool, err error) {
+	if conn.opts.onQueryReceivedHandler == nil {
+		return false, nil
+	}
+	handlerErr := conn.opts.onQueryReceivedHandler(ctx, query, isPreparedStmt, &notifier{backend: conn.backend})
+	if handlerErr == nil {
+		return false, nil
+	}
+	resp := &pgproto3.ErrorResponse{
+		Severity: "ERROR",
+		Code:     "58030",
+		Message:  "Failed on query received handler",
+		Detail:   handlerErr.Error(),
+	}
+	var qre *QueryRejectedError
+	if errors.As(handlerErr, &qre) {
+		log.Printf("[info][%s] query rejected: %v", conn.client.RemoteAddr(), handlerErr)
+		resp.Code = qre.Code
+		resp.Message = qre.Message
+		resp.Detail = qre.Detail
+		rejected = true
+	} else {
+		log.Printf("[error] on query received: %v", handlerErr)
+	}
+	if err := conn.backend.Send(resp); err != nil {
+		return false, conn.wrapError(ctx, err, "on query recived")
+	}
+	return rejected, nil
+}
+
+// abortTransactionQuery is the invalid statement sent to upstream to abort the transaction of the rejected query.
+const abortTransactionQuery = "psqlfront rejected the query"
+
+// abortTransaction sends the failing msg to upstream after a query is rejected in a transaction,
+// so that the client can not commit the transaction as if the rejected query succeeded.
+// The ErrorResponse of upstream is not sent to the client, because the client already got the one of the rejection.
+func (conn *ProxyConn) abortTransaction(ctx context.Context, msg pgproto3.FrontendMessage) error {
+	log.Printf("[debug][%s] abort transaction of upstream for the rejected query", conn.client.RemoteAddr())
+	conn.skipUpstreamError.Store(true)
+	return conn.sendUpstream(ctx, msg)
+}
+
+// skipUpstreamMessage reports whether the message from upstream is the ErrorResponse of abortTransactionQuery.
+// If upstream is already ignoring messages until Sync, no ErrorResponse comes and ReadyForQuery ends the wait.
+func (conn *ProxyConn) skipUpstreamMessage(bm pgproto3.BackendMessage) bool {
+	switch bm.(type) {
+	case *pgproto3.ErrorResponse:
+		return conn.skipUpstreamError.CompareAndSwap(true, false)
+	case *pgproto3.ReadyForQuery:
+		conn.skipUpstreamError.Store(false)
+	}
+	return false
+}
+
+// Session returns the session of the connection.
+func (conn *ProxyConn) Session() *Session {
+	return conn.session
+}
+
+// TxStatus returns the transaction status of the last ReadyForQuery from upstream.
+func (conn *ProxyConn) TxStatus() byte {
+	if txStatus, ok := conn.txStatus.Load().(byte); ok {
+		return txStatus
+	}
+	return 'I'
+}
+
 func (conn *ProxyConn) SetIdleTimeout(idleTimeout time.Duration) {
 	conn.idleTimeout = idleTimeout
 }
@@ -251,6 +709,9 @@ func (conn *ProxyConn) ExtendDeadline() (time.Time, error) {
 	if err := conn.client.SetDeadline(d); err != nil {
 		return d, err
 	}
+	if conn.upstream == nil {
+		return d, nil
+	}
 	return d, conn.upstream.SetDeadline(d)
 }
 
@@ -287,6 +748,9 @@ func (conn *ProxyConn) close() {
 		}
 
 	}
+	if conn.opts.pool != nil {
+		conn.reclaimPooled()
+	}
 	if conn.upstream != nil {
 		log.Printf("[debug][%s] try upstream close", remoteAddr)
 		if err := conn.frontend.Send(&pgproto3.Terminate{}); err != nil {
@@ -62,17 +62,7 @@ func AnalyzeQuery(query string) ([]*Table, error) {
 			if lo.Contains(ctes, relname) {
 				continue
 			}
-			table := &Table{
-				RelName: relname,
-			}
-			if schemaname, ok := rangeVar["schemaname"].(string); ok {
-				table.SchemaName = schemaname
-			} else if strings.HasPrefix(relname, "pg_") {
-				table.SchemaName = "pg_catalog"
-			} else {
-				table.SchemaName = "public"
-			}
-			tables = append(tables, table)
+			tables = append(tables, rangeVarToTable(rangeVar))
 			if strings.EqualFold(relname, "pg_namespace") {
 				refNamespace = true
 			}
@@ -168,6 +158,239 @@ func AnalyzeQuery(query string) ([]*Table, error) {
 	return tables, nil
 }
 
+// AnalyzeAccessedTables returns the tables the query accesses by any statement,
+// not only SELECT but also INSERT, UPDATE, DELETE, COPY and DDL.
+// SchemaName is empty if the name is not qualified, because it is resolved by search_path of the session.
+func AnalyzeAccessedTables(query string) ([]*Table, error) {
+	tree, err := pgquery.ParseToJSON(query)
+	if err != nil {
+		return nil, fmt.Errorf("parse query: %w", err)
+	}
+	var obj interface{}
+	if err := json.Unmarshal([]byte(tree), &obj); err != nil {
+		return nil, err
+	}
+	ctes, err := findJSONValues[string](obj, "ctename")
+	if err != nil {
+		return nil, err
+	}
+	// RangeVar is wrapped by the node type in the lists such as fromClause,
+	// and is not wrapped in the fields such as relation of INSERT, UPDATE, DELETE and COPY.
+	var rangeVars []map[string]interface{}
+	for _, key := range []string{"RangeVar", "relation", "rel", "view"} {
+		values, err := findJSONValues[map[string]interface{}](obj, key)
+		if err != nil {
+			return nil, err
+		}
+		rangeVars = append(rangeVars, values...)
+	}
+	tables := make([]*Table, 0, len(rangeVars))
+	for _, rangeVar := range rangeVars {
+		relname, ok := rangeVar["relname"].(string)
+		if !ok {
+			continue
+		}
+		if _, ok := rangeVar["schemaname"]; !ok && lo.Contains(ctes, relname) {
+			continue
+		}
+		tables = append(tables, rangeVarToName(rangeVar))
+	}
+	return lo.UniqBy(tables, func(t *Table) string {
+		return t.String()
+	}), nil
+}
+
+// AnalyzeFunctionCalls returns the functions the query calls, as Table of the schema and the name.
+// SchemaName is empty if the name is not qualified.
+func AnalyzeFunctionCalls(query string) ([]*Table, error) {
+	tree, err := pgquery.ParseToJSON(query)
+	if err != nil {
+		return nil, fmt.Errorf("parse query: %w", err)
+	}
+	var obj interface{}
+	if err := json.Unmarshal([]byte(tree), &obj); err != nil {
+		return nil, err
+	}
+	funcCalls, err := findJSONValues[map[string]interface{}](obj, "FuncCall")
+	if err != nil {
+		return nil, err
+	}
+	functions := make([]*Table, 0, len(funcCalls))
+	for _, funcCall := range funcCalls {
+		names, err := findJSONValues[string](funcCall["funcname"], "str")
+		if err != nil {
+			return nil, err
+		}
+		if len(names) > 0 {
+			functions = append(functions, namesToName(names))
+		}
+	}
+	return lo.UniqBy(functions, func(t *Table) string {
+		return t.String()
+	}), nil
+}
+
+// ContainsStmt returns true if the query has any of the statements, such as DoStmt.
+// The statements nested in other statements are also found.
+func ContainsStmt(query string, stmts ...string) (bool, error) {
+	tree, err := pgquery.ParseToJSON(query)
+	if err != nil {
+		return false, fmt.Errorf("parse query: %w", err)
+	}
+	var obj interface{}
+	if err := json.Unmarshal([]byte(tree), &obj); err != nil {
+		return false, err
+	}
+	var found bool
+	walkJSON(obj, func(key string, value interface{}) {
+		if _, ok := value.(map[string]interface{}); ok && lo.Contains(stmts, key) {
+			found = true
+		}
+	})
+	return found, nil
+}
+
+// relationWriteStmts are the statements that write to or change the relation of the `relation` field.
+var relationWriteStmts = []string{
+	"InsertStmt", "UpdateStmt", "DeleteStmt", "CreateStmt", "AlterTableStmt", "RenameStmt",
+	"AlterObjectSchemaStmt", "IndexStmt", "CreateTrigStmt", "RuleStmt",
+}
+
+// AnalyzeWriteTargets returns the objects and the schemas the query writes to or changes by DDL.
+// The objects are tables, views, indexes and functions, they are returned as Table of the schema and the name.
+// SchemaName is empty if the name is not qualified, because it is resolved by search_path of the session.
+// The statements nested in EXPLAIN and WITH are also analyzed.
+func AnalyzeWriteTargets(query string) ([]*Table, []string, error) {
+	tree, err := pgquery.ParseToJSON(query)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse query: %w", err)
+	}
+	var obj interface{}
+	if err := json.Unmarshal([]byte(tree), &obj); err != nil {
+		return nil, nil, err
+	}
+	var objects []*Table
+	var schemas []string
+	walkJSON(obj, func(key string, value interface{}) {
+		node, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		switch {
+		case lo.Contains(relationWriteStmts, key):
+			if relation, ok := node["relation"].(map[string]interface{}); ok {
+				objects = append(objects, rangeVarToName(relation))
+			}
+			if key == "RenameStmt" && node["renameType"] == "OBJECT_SCHEMA" {
+				if subname, ok := node["subname"].(string); ok {
+					schemas = append(schemas, subname)
+				}
+			}
+		case key == "CopyStmt":
+			if isFrom, _ := node["is_from"].(bool); !isFrom {
+				return
+			}
+			if relation, ok := node["relation"].(map[string]interface{}); ok {
+				objects = append(objects, rangeVarToName(relation))
+			}
+		case key == "TruncateStmt":
+			rangeVars, _ := findJSONValues[map[string]interface{}](node["relations"], "RangeVar")
+			for _, rangeVar := range rangeVars {
+				objects = append(objects, rangeVarToName(rangeVar))
+			}
+		case key == "ViewStmt":
+			if view, ok := node["view"].(map[string]interface{}); ok {
+				objects = append(objects, rangeVarToName(view))
+			}
+		case key == "intoClause", key == "into":
+			if rel, ok := node["rel"].(map[string]interface{}); ok {
+				objects = append(objects, rangeVarToName(rel))
+			}
+		case key == "CreateFunctionStmt":
+			names, _ := findJSONValues[string](node["funcname"], "str")
+			objects = append(objects, namesToName(names))
+		case key == "DropStmt":
+			if node["removeType"] == "OBJECT_SCHEMA" {
+				names, _ := findJSONValues[string](node["objects"], "str")
+				schemas = append(schemas, names...)
+				return
+			}
+			items, _ := node["objects"].([]interface{})
+			for _, item := range items {
+				names, _ := findJSONValues[string](item, "str")
+				wrapped, _ := item.(map[string]interface{})
+				if withArgs, ok := wrapped["ObjectWithArgs"].(map[string]interface{}); ok {
+					names, _ = findJSONValues[string](withArgs["objname"], "str")
+				}
+				if len(names) > 0 {
+					objects = append(objects, namesToName(names))
+				}
+			}
+		case key == "GrantStmt":
+			if node["objtype"] == "OBJECT_SCHEMA" || node["targtype"] == "ACL_TARGET_ALL_IN_SCHEMA" {
+				names, _ := findJSONValues[string](node["objects"], "str")
+				schemas = append(schemas, names...)
+				return
+			}
+			rangeVars, _ := findJSONValues[map[string]interface{}](node["objects"], "RangeVar")
+			for _, rangeVar := range rangeVars {
+				objects = append(objects, rangeVarToName(rangeVar))
+			}
+		}
+	})
+	return lo.UniqBy(objects, func(t *Table) string {
+		return t.String()
+	}), lo.Uniq(schemas), nil
+}
+
+// walkJSON calls fn for all key and value pairs of the objects in obj recursively.
+func walkJSON(obj interface{}, fn func(key string, value interface{})) {
+	switch o := obj.(type) {
+	case []interface{}:
+		for _, item := range o {
+			walkJSON(item, fn)
+		}
+	case map[string]interface{}:
+		for key, value := range o {
+			fn(key, value)
+			walkJSON(value, fn)
+		}
+	}
+}
+
+// rangeVarToName returns the schema and the name of RangeVar as written in the query, SchemaName is empty if not qualified.
+func rangeVarToName(rangeVar map[string]interface{}) *Table {
+	relname, _ := rangeVar["relname"].(string)
+	schemaname, _ := rangeVar["schemaname"].(string)
+	return &Table{
+		SchemaName: schemaname,
+		RelName:    relname,
+	}
+}
+
+// namesToName returns the schema and the name of the qualified name such as [schema, name], SchemaName is empty if not qualified.
+func namesToName(names []string) *Table {
+	if len(names) == 1 {
+		return &Table{RelName: names[0]}
+	}
+	return &Table{SchemaName: names[len(names)-2], RelName: names[len(names)-1]}
+}
+
+func rangeVarToTable(rangeVar map[string]interface{}) *Table {
+	relname, _ := rangeVar["relname"].(string)
+	table := &Table{
+		RelName: relname,
+	}
+	if schemaname, ok := rangeVar["schemaname"].(string); ok {
+		table.SchemaName = schemaname
+	} else if strings.HasPrefix(relname, "pg_") {
+		table.SchemaName = "pg_catalog"
+	} else {
+		table.SchemaName = "public"
+	}
+	return table
+}
+
 func findJSONValues[T any](obj interface{}, key string) ([]T, error) {
 	return findJSONValuesHelper(obj, "", key, []T{})
 }
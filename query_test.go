@@ -119,3 +119,255 @@ func BenchmarkAnalyzeQuery(b *testing.B) {
 		}
 	})
 }
+
+func TestAnalyzeRefreshCalls(t *testing.T) {
+	cases := []struct {
+		casename    string
+		query       string
+		tables      []*psqlfront.Table
+		expectedErr error
+	}{
+		{
+			casename: "not refresh",
+			query:    "SELECT * FROM psqlfront.cache_status()",
+		},
+		{
+			casename: "refresh with schema",
+			query:    "SELECT psqlfront.refresh('example.syukujitsu')",
+			tables: []*psqlfront.Table{
+				{SchemaName: "example", RelName: "syukujitsu"},
+			},
+		},
+		{
+			casename: "refresh multiple tables",
+			query:    `SELECT "psqlfront".refresh('syukujitsu'), psqlfront.refresh('public.syukujitsu'), psqlfront.refresh('"example"."hoge"')`,
+			tables: []*psqlfront.Table{
+				{SchemaName: "public", RelName: "syukujitsu"},
+				{SchemaName: "example", RelName: "hoge"},
+			},
+		},
+		{
+			casename:    "refresh with parameter",
+			query:       "SELECT psqlfront.refresh($1)",
+			expectedErr: psqlfront.ErrRefreshArgument,
+		},
+		{
+			casename: "other refresh function",
+			query:    "SELECT refresh('public.syukujitsu')",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.casename, func(t *testing.T) {
+			tables, err := psqlfront.AnalyzeRefreshCalls(c.query)
+			if c.expectedErr != nil {
+				require.ErrorIs(t, err, c.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.ElementsMatch(t, c.tables, tables)
+		})
+	}
+}
+
+func TestAnalyzeInvalidateCalls(t *testing.T) {
+	cases := []struct {
+		casename    string
+		query       string
+		targets     []string
+		expectedErr error
+	}{
+		{
+			casename: "not invalidate",
+			query:    "SELECT * FROM psqlfront.cache_status()",
+		},
+		{
+			casename: "invalidate origin and table",
+			query:    "SELECT psqlfront.invalidate('open_data'), psqlfront.invalidate('example.syukujitsu'), psqlfront.invalidate('open_data')",
+			targets:  []string{"open_data", "example.syukujitsu"},
+		},
+		{
+			casename:    "invalidate with parameter",
+			query:       "SELECT psqlfront.invalidate($1)",
+			expectedErr: psqlfront.ErrInvalidateArgument,
+		},
+		{
+			casename:    "invalidate with column",
+			query:       "SELECT psqlfront.invalidate(origin_id) FROM psqlfront.cache",
+			expectedErr: psqlfront.ErrInvalidateArgument,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.casename, func(t *testing.T) {
+			targets, err := psqlfront.AnalyzeInvalidateCalls(c.query)
+			if c.expectedErr != nil {
+				require.ErrorIs(t, err, c.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.ElementsMatch(t, c.targets, targets)
+		})
+	}
+}
+
+func TestAnalyzeAccessedTables(t *testing.T) {
+	cases := []struct {
+		casename string
+		query    string
+		tables   []*psqlfront.Table
+	}{
+		{
+			casename: "insert into select",
+			query:    LoadFile(t, "testdata/sql/insert_into_select.sql"),
+			tables: []*psqlfront.Table{
+				{SchemaName: "access", RelName: "history"},
+				{SchemaName: "access", RelName: "log"},
+			},
+		},
+		{
+			casename: "with cte",
+			query:    "WITH hr AS (SELECT * FROM hr.salary) SELECT * FROM hr JOIN public.hr ON true",
+			tables: []*psqlfront.Table{
+				{SchemaName: "hr", RelName: "salary"},
+				{SchemaName: "public", RelName: "hr"},
+			},
+		},
+		{
+			casename: "copy",
+			query:    "COPY hr.salary TO STDOUT",
+			tables: []*psqlfront.Table{
+				{SchemaName: "hr", RelName: "salary"},
+			},
+		},
+		{
+			casename: "update from",
+			query:    "UPDATE example.hoge SET x = 1 FROM hr.salary",
+			tables: []*psqlfront.Table{
+				{SchemaName: "example", RelName: "hoge"},
+				{SchemaName: "hr", RelName: "salary"},
+			},
+		},
+		{
+			casename: "select into",
+			query:    "SELECT * INTO tmp FROM hr.salary, hr.salary AS s",
+			tables: []*psqlfront.Table{
+				{SchemaName: "", RelName: "tmp"},
+				{SchemaName: "hr", RelName: "salary"},
+			},
+		},
+		{
+			casename: "unqualified is resolved by search_path",
+			query:    "SET search_path TO hr; SELECT * FROM salary",
+			tables: []*psqlfront.Table{
+				{SchemaName: "", RelName: "salary"},
+			},
+		},
+		{
+			casename: "no table",
+			query:    "SELECT 1",
+			tables:   []*psqlfront.Table{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.casename, func(t *testing.T) {
+			tables, err := psqlfront.AnalyzeAccessedTables(c.query)
+			require.NoError(t, err)
+			require.ElementsMatch(t, c.tables, tables)
+		})
+	}
+}
+
+func TestAnalyzeFunctionCalls(t *testing.T) {
+	functions, err := psqlfront.AnalyzeFunctionCalls("SELECT count(*), public.leak(id) FROM example.hoge WHERE pg_catalog.length(name) > 0")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []*psqlfront.Table{
+		{SchemaName: "", RelName: "count"},
+		{SchemaName: "public", RelName: "leak"},
+		{SchemaName: "pg_catalog", RelName: "length"},
+	}, functions)
+}
+
+func TestContainsStmt(t *testing.T) {
+	found, err := psqlfront.ContainsStmt("SELECT 1; DO $$ BEGIN DELETE FROM psqlfront.cache; END $$", "DoStmt")
+	require.NoError(t, err)
+	require.True(t, found)
+	found, err = psqlfront.ContainsStmt("SELECT 'DO $$ BEGIN END $$'", "DoStmt")
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+func TestAnalyzeWriteTargets(t *testing.T) {
+	cases := []struct {
+		casename string
+		query    string
+		objects  []*psqlfront.Table
+		schemas  []string
+	}{
+		{
+			casename: "select",
+			query:    "SELECT * FROM example.hoge",
+		},
+		{
+			casename: "insert into select",
+			query:    LoadFile(t, "testdata/sql/insert_into_select.sql"),
+			objects: []*psqlfront.Table{
+				{SchemaName: "access", RelName: "history"},
+			},
+		},
+		{
+			casename: "writable cte in explain analyze",
+			query:    "EXPLAIN ANALYZE WITH d AS (DELETE FROM example.hoge RETURNING *) UPDATE psqlfront.cache SET expired_at = NOW()",
+			objects: []*psqlfront.Table{
+				{SchemaName: "example", RelName: "hoge"},
+				{SchemaName: "psqlfront", RelName: "cache"},
+			},
+		},
+		{
+			casename: "copy from and copy to",
+			query:    "COPY example.hoge FROM STDIN; COPY example.fuga TO STDOUT",
+			objects: []*psqlfront.Table{
+				{SchemaName: "example", RelName: "hoge"},
+			},
+		},
+		{
+			casename: "truncate",
+			query:    "TRUNCATE example.hoge, piyo",
+			objects: []*psqlfront.Table{
+				{SchemaName: "example", RelName: "hoge"},
+				{SchemaName: "", RelName: "piyo"},
+			},
+		},
+		{
+			casename: "unqualified is resolved by search_path",
+			query:    "SET search_path TO psqlfront; TRUNCATE cache",
+			objects: []*psqlfront.Table{
+				{SchemaName: "", RelName: "cache"},
+			},
+		},
+		{
+			casename: "drop",
+			query:    "DROP TABLE example.hoge; DROP FUNCTION psqlfront.invalidate(text); DROP SCHEMA example CASCADE",
+			objects: []*psqlfront.Table{
+				{SchemaName: "example", RelName: "hoge"},
+				{SchemaName: "psqlfront", RelName: "invalidate"},
+			},
+			schemas: []string{"example"},
+		},
+		{
+			casename: "ddl",
+			query:    "ALTER TABLE example.hoge ADD COLUMN x INT; CREATE TABLE psqlfront.x AS SELECT 1; ALTER SCHEMA psqlfront RENAME TO old",
+			objects: []*psqlfront.Table{
+				{SchemaName: "example", RelName: "hoge"},
+				{SchemaName: "psqlfront", RelName: "x"},
+			},
+			schemas: []string{"psqlfront"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.casename, func(t *testing.T) {
+			objects, schemas, err := psqlfront.AnalyzeWriteTargets(c.query)
+			require.NoError(t, err)
+			require.ElementsMatch(t, c.objects, objects)
+			require.ElementsMatch(t, c.schemas, schemas)
+		})
+	}
+}
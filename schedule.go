@@ -0,0 +1,105 @@
+package psqlfront
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Songmu/flextime"
+	"github.com/robfig/cron/v3"
+)
+
+// RefreshSchedule returns the next refresh time after the given time.
+type RefreshSchedule interface {
+	Next(time.Time) time.Time
+}
+
+// ParseRefreshSchedule parses refresh_schedule.
+// It is an interval such as `30m`, or a cron expression such as `0 3 * * *`, `@hourly` and `CRON_TZ=Asia/Tokyo 0 9 * * *`.
+func ParseRefreshSchedule(str string) (RefreshSchedule, error) {
+	if d, err := time.ParseDuration(str); err == nil {
+		if d < time.Second {
+			return nil, fmt.Errorf("refresh_schedule `%s` is too short, must be at least 1s", str)
+		}
+		return cron.Every(d), nil
+	}
+	schedule, err := cron.ParseStandard(str)
+	if err != nil {
+		return nil, fmt.Errorf("refresh_schedule `%s` is neither an interval nor a cron expression: %w", str, err)
+	}
+	return schedule, nil
+}
+
+// setRefreshSchedule sets refresh_schedule of the table, or of the origin if the table has none.
+func (server *Server) setRefreshSchedule(originID string, table *Table) error {
+	str := table.RefreshSchedule
+	if str == "" {
+		str = server.originSchedules[originID]
+	}
+	if str == "" {
+		return nil
+	}
+	schedule, err := ParseRefreshSchedule(str)
+	if err != nil {
+		return err
+	}
+	server.refreshSchedules[table.String()] = schedule
+	return nil
+}
+
+// scheduling refreshes the tables that have refresh_schedule proactively, and runs until ctx is done.
+func (server *Server) scheduling(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	now := flextime.Now()
+	next := make(map[string]time.Time, len(server.refreshSchedules))
+	for name, schedule := range server.refreshSchedules {
+		next[name] = schedule.Next(now)
+		log.Printf("[info] %s next scheduled refresh at %s", name, next[name].Format(time.RFC3339))
+	}
+	for {
+		var earliest time.Time
+		for _, at := range next {
+			if earliest.IsZero() || at.Before(earliest) {
+				earliest = at
+			}
+		}
+		timer := time.NewTimer(earliest.Sub(flextime.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		now = flextime.Now()
+		for name, at := range next {
+			if at.After(now) {
+				continue
+			}
+			next[name] = server.refreshSchedules[name].Next(now)
+			table, ok := server.tables[name]
+			if !ok {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				server.scheduledRefresh(ctx, table)
+			}()
+		}
+	}
+}
+
+func (server *Server) scheduledRefresh(ctx context.Context, t *Table) {
+	log.Printf("[info] %s start scheduled refresh", t)
+	if err := server.refreshTableWithTx(ctx, ctx, t); err != nil {
+		log.Printf("[warn] %s scheduled refresh failed: %v", t, err)
+		return
+	}
+	if err := server.analezeTables(ctx, []*Table{t}); err != nil {
+		log.Printf("[warn] %s analyze after scheduled refresh failed: %v", t, err)
+		return
+	}
+	log.Printf("[info] %s scheduled refresh finished", t)
+}
@@ -0,0 +1,33 @@
+package psqlfront_test
+
+import (
+	"testing"
+	"time"
+
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRefreshSchedule(t *testing.T) {
+	base := time.Date(2022, 8, 1, 10, 30, 0, 0, time.UTC)
+	cases := []struct {
+		str      string
+		expected time.Time
+	}{
+		{str: "30m", expected: time.Date(2022, 8, 1, 11, 0, 0, 0, time.UTC)},
+		{str: "@hourly", expected: time.Date(2022, 8, 1, 11, 0, 0, 0, time.UTC)},
+		{str: "0 3 * * *", expected: time.Date(2022, 8, 2, 3, 0, 0, 0, time.UTC)},
+		{str: "CRON_TZ=Asia/Tokyo 0 9 * * *", expected: time.Date(2022, 8, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		t.Run(c.str, func(t *testing.T) {
+			schedule, err := psqlfront.ParseRefreshSchedule(c.str)
+			require.NoError(t, err)
+			require.True(t, c.expected.Equal(schedule.Next(base)), "next: %s", schedule.Next(base))
+		})
+	}
+	for _, str := range []string{"", "100ms", "every day", "0 3 * *"} {
+		_, err := psqlfront.ParseRefreshSchedule(str)
+		require.Error(t, err, str)
+	}
+}
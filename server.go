@@ -8,6 +8,7 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
 	"net"
 	"strings"
@@ -44,16 +45,28 @@ func (conn *ProxyConnection) Close(ctx context.Context) error {
 type Server struct {
 	db                   *pgxpool.Pool
 	cacheTTL             map[string]time.Duration
+	maxStaleness         map[string]time.Duration
+	refreshMode          map[string]string
+	originSchedules      map[string]string
+	refreshStrategy      map[string]string
+	refreshSchedules     map[string]RefreshSchedule
 	origins              map[string]Origin
 	originIDsByTable     map[string]string
 	tables               map[string]*Table
-	tableCond            map[string]*sync.Cond
-	tableMutex           map[string]*sync.Mutex
+	tableRefreshes       map[string]*tableRefresh
 	tlsConfig            *tls.Config
+	authenticator        *Authenticator
+	upstreamCredential   *UpstreamCredential
+	accessControl        *AccessControl
+	readOnly             bool
+	rejectProceduralCode bool
+	pool                 *UpstreamPool
+	adminUsers           []string
 	initialFetch         bool
 	idleTimeout          time.Duration
 	cacheControllTimeout time.Duration
-	upstreamAddr         string
+	loadMethod           string
+	upstreamDialer       *UpstreamDialer
 	statsCfg             *StatsConfig
 
 	startedAt time.Time
@@ -86,13 +99,17 @@ func New(ctx context.Context, cfg *Config) (*Server, error) {
 	server := &Server{
 		db:               db,
 		cacheTTL:         make(map[string]time.Duration, len(cfg.Origins)),
+		maxStaleness:     make(map[string]time.Duration, len(cfg.Origins)),
+		refreshMode:      make(map[string]string, len(cfg.Origins)),
+		originSchedules:  make(map[string]string, len(cfg.Origins)),
+		refreshStrategy:  make(map[string]string, len(cfg.Origins)),
+		refreshSchedules: make(map[string]RefreshSchedule),
 		origins:          make(map[string]Origin, len(cfg.Origins)),
 		originIDsByTable: make(map[string]string),
 		tables:           make(map[string]*Table),
-		tableCond:        make(map[string]*sync.Cond),
-		tableMutex:       make(map[string]*sync.Mutex),
-		upstreamAddr:     fmt.Sprintf("%s:%d", cfg.CacheDatabase.Host, cfg.CacheDatabase.Port),
+		tableRefreshes:   make(map[string]*tableRefresh),
 		statsCfg:         cfg.Stats,
+		loadMethod:       cfg.LoadMethod,
 	}
 	if cfg.IdleTimeout != nil {
 		server.idleTimeout = *cfg.IdleTimeout
@@ -112,8 +129,42 @@ func New(ctx context.Context, cfg *Config) (*Server, error) {
 			Certificates: certs,
 		}
 	}
+	if cfg.Authentication != nil && cfg.Authentication.authenticator != nil {
+		log.Printf("[info] authenticate clients by %s", cfg.Authentication.Method)
+		server.authenticator = cfg.Authentication.authenticator
+		server.upstreamCredential = &UpstreamCredential{
+			User:     cfg.Authentication.Upstream.Username,
+			Password: cfg.Authentication.Upstream.Password,
+			Database: cfg.Authentication.Upstream.Database,
+		}
+	}
+	if cfg.AccessControl != nil {
+		server.accessControl = cfg.AccessControl.accessControl
+	}
+	server.upstreamDialer, err = NewUpstreamDialer(cfg.CacheDatabase)
+	if err != nil {
+		return nil, fmt.Errorf("upstream dialer initialize: %w", err)
+	}
+	if cfg.Pool != nil && server.upstreamCredential != nil {
+		log.Printf("[info] pool upstream connections: mode=%s size=%d", cfg.Pool.Mode, cfg.Pool.Size)
+		server.pool, err = NewUpstreamPool(server.upstreamDialer, server.upstreamCredential, cfg.Pool)
+		if err != nil {
+			return nil, fmt.Errorf("upstream pool initialize: %w", err)
+		}
+	}
+	server.readOnly = cfg.ReadOnly.enabled()
+	if cfg.ReadOnly != nil {
+		server.adminUsers = cfg.ReadOnly.AdminUsers
+		server.rejectProceduralCode = cfg.ReadOnly.RejectProceduralCode
+	}
 	for _, origin := range cfg.Origins {
 		server.cacheTTL[origin.ID] = *origin.TTL
+		if origin.MaxStaleness != nil {
+			server.maxStaleness[origin.ID] = *origin.MaxStaleness
+		}
+		server.refreshMode[origin.ID] = origin.RefreshMode
+		server.originSchedules[origin.ID] = origin.RefreshSchedule
+		server.refreshStrategy[origin.ID] = origin.RefreshStrategy
 		o, err := origin.NewOrigin()
 		if err != nil {
 			return nil, fmt.Errorf("origin `%s` initialize: %w", origin.ID, err)
@@ -154,6 +205,9 @@ func (server *Server) RunWithContextAndListener(ctx context.Context, listener ne
 	log.Printf("[notice] start psql-front running version: %s", Version)
 	server.startedAt = flextime.Now()
 	defer listener.Close()
+	if server.pool != nil {
+		defer server.pool.Close()
+	}
 
 	scanner := bufio.NewScanner(strings.NewReader(systemTableDDL))
 	scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
@@ -188,8 +242,10 @@ func (server *Server) RunWithContextAndListener(ctx context.Context, listener ne
 		for _, table := range t {
 			server.originIDsByTable[table.String()] = origin.ID()
 			server.tables[table.String()] = table
-			server.tableCond[table.String()] = sync.NewCond(&sync.Mutex{})
-			server.tableMutex[table.String()] = &sync.Mutex{}
+			server.tableRefreshes[table.String()] = newTableRefresh()
+			if err := server.setRefreshSchedule(origin.ID(), table); err != nil {
+				return fmt.Errorf("origin_id `%s` table %s: %w", origin.ID(), table, err)
+			}
 			log.Printf("[debug] %s: %d columns", table.String(), len(table.Columns))
 			if table.SchemaName != "public" {
 				sql := fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS "%s";`, table.SchemaName)
@@ -219,6 +275,12 @@ func (server *Server) RunWithContextAndListener(ctx context.Context, listener ne
 	if server.tlsConfig != nil {
 		opts = append(opts, WithProxyConnTLS(server.tlsConfig))
 	}
+	if server.authenticator != nil {
+		opts = append(opts, WithProxyConnAuthentication(server.authenticator, server.upstreamCredential))
+	}
+	if server.pool != nil {
+		opts = append(opts, WithProxyConnPool(server.pool))
+	}
 
 	cctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -227,6 +289,10 @@ func (server *Server) RunWithContextAndListener(ctx context.Context, listener ne
 		wg.Add(1)
 		go server.monitoring(cctx, &wg)
 	}
+	if len(server.refreshSchedules) > 0 {
+		wg.Add(1)
+		go server.scheduling(cctx, &wg)
+	}
 
 	wg.Add(1)
 	go func() {
@@ -247,18 +313,23 @@ func (server *Server) RunWithContextAndListener(ctx context.Context, listener ne
 				atomic.AddInt64(&(server.currConnections), 1)
 				remoteAddr := client.RemoteAddr().String()
 				log.Printf("[notice][%s] new connection", remoteAddr)
-				upstream, err := net.Dial("tcp", server.upstreamAddr)
-				if err != nil {
-					log.Printf("[error][%s] can not connect upstream:%v", remoteAddr, err)
-					client.Close()
-					atomic.AddInt64(&(server.currConnections), -1)
-					continue
+				var upstream net.Conn
+				if server.pool == nil {
+					upstream, err = server.upstreamDialer.DialContext(withRemoteAddr(cctx, remoteAddr))
+					if err != nil {
+						log.Printf("[error][%s] can not connect upstream:%v", remoteAddr, err)
+						client.Close()
+						atomic.AddInt64(&(server.currConnections), -1)
+						continue
+					}
 				}
 				conn, err := NewProxyConn(client, upstream, opts...)
 				if err != nil {
 					log.Printf("[error][%s] can create proxy conn:%v", remoteAddr, err)
 					client.Close()
-					upstream.Close()
+					if upstream != nil {
+						upstream.Close()
+					}
 					atomic.AddInt64(&(server.currConnections), -1)
 					continue
 				}
@@ -293,7 +364,10 @@ func (server *Server) RunWithContextAndListener(ctx context.Context, listener ne
 		}
 		err = func() error {
 			for _, table := range server.tables {
-				if err := server.refreshCache(ctx, tx, table); err != nil {
+				err := server.refreshOnce(ctx, table, func() error {
+					return server.refreshCache(ctx, tx, table)
+				})
+				if err != nil {
 					return err
 				}
 			}
@@ -318,11 +392,52 @@ func (server *Server) handleQuery(ctx context.Context, query string, isPrepareSt
 	atomic.AddInt64(&(server.queries), 1)
 	remoteAddr := GetRemoteAddr(ctx)
 	log.Printf("[debug][%s] analyze SQL: %s", remoteAddr, query)
+	session := GetSession(ctx)
+	if session != nil {
+		if err := session.ApplyQuery(query); err != nil {
+			if errors.Is(err, ErrUnknownSetting) {
+				return &QueryRejectedError{
+					Code:    "42704",
+					Message: err.Error(),
+				}
+			}
+			return &QueryRejectedError{
+				Code:    "22023",
+				Message: err.Error(),
+			}
+		}
+	}
+	settings := session.Settings()
 	tables, err := AnalyzeQuery(query)
 	if err != nil {
 		log.Printf("[debug][%s] analyze SQL failed: %v", remoteAddr, err)
 		return err
 	}
+	refreshTables, err := AnalyzeRefreshCalls(query)
+	if err != nil {
+		if errors.Is(err, ErrRefreshArgument) {
+			return &QueryRejectedError{
+				Code:    "22023",
+				Message: err.Error(),
+			}
+		}
+		return err
+	}
+	if server.accessControl != nil {
+		if err := server.checkAccessControl(ctx, query, refreshTables); err != nil {
+			return err
+		}
+	}
+	if server.readOnly && !lo.Contains(server.adminUsers, GetUser(ctx)) {
+		if err := server.checkReadOnly(ctx, query); err != nil {
+			return err
+		}
+	}
+	if len(refreshTables) > 0 {
+		if err := server.handleRefreshCalls(ctx, refreshTables, notifier); err != nil {
+			return err
+		}
+	}
 	if len(tables) == 0 {
 		return nil
 	}
@@ -330,19 +445,37 @@ func (server *Server) handleQuery(ctx context.Context, query string, isPrepareSt
 		return table.String()
 	}), ", "))
 	finished := make(chan struct{})
+	var controlErr error
 	go func() {
 		ctx, cancel := context.WithTimeout(withRemoteAddr(context.Background(), remoteAddr), 24*time.Hour)
 		defer cancel()
-		if err := server.controlCache(ctx, query, tables, notifier); err != nil {
+		if err := server.controlCache(ctx, query, tables, settings, notifier); err != nil {
 			log.Printf("[error][%s] cache controll failed: %v", remoteAddr, err)
+			controlErr = err
 		}
 		close(finished)
 		log.Printf("[info][%s] cache controll finished", remoteAddr)
 	}()
+	timeout := server.cacheControllTimeout
+	if !settings.WaitForRefresh {
+		log.Printf("[debug][%s] %s is off, cache control is done on the background", remoteAddr, SettingWaitForRefresh)
+		timeout = 0
+	}
 	select {
 	case <-finished:
 		log.Printf("[debug][%s] trap finish cache controll", remoteAddr)
-	case <-time.After(server.cacheControllTimeout):
+		var cue *CacheUnavailableError
+		if errors.As(controlErr, &cue) {
+			return &QueryRejectedError{
+				Code:    "58030",
+				Message: cue.Error(),
+				Detail:  cue.err.Error(),
+			}
+		}
+	case <-time.After(timeout):
+		if !settings.WaitForRefresh {
+			break
+		}
 		log.Printf("[info][%s] since the timeout has arrived, cache control should be done on the background.", remoteAddr)
 		notifier.Notify(ctx, &pgproto3.NoticeResponse{
 			Severity: "NOTICE",
@@ -352,6 +485,153 @@ func (server *Server) handleQuery(ctx context.Context, query string, isPrepareSt
 	return nil
 }
 
+// checkAccessControl returns QueryRejectedError if the user can not access any of the tables of the query, or the tables the views depend on.
+// The functions defined in the cache database and DO are rejected, because they can read any table.
+// The tables of psqlfront.refresh() and psqlfront.invalidate() are also checked, and psqlfront.cache_status() is allowed only for the users who can access all the tables.
+func (server *Server) checkAccessControl(ctx context.Context, query string, refreshTables []*Table) error {
+	remoteAddr := GetRemoteAddr(ctx)
+	user := GetUser(ctx)
+	invalidateTargets, err := AnalyzeInvalidateCalls(query)
+	if err != nil {
+		if errors.Is(err, ErrInvalidateArgument) {
+			return &QueryRejectedError{
+				Code:    "22023",
+				Message: err.Error(),
+				Detail:  "the argument is checked by access_control of psql-front",
+			}
+		}
+		return err
+	}
+	controlledTables := append([]*Table{}, refreshTables...)
+	for _, target := range invalidateTargets {
+		controlledTables = append(controlledTables, server.invalidateTargetTables(target)...)
+	}
+	hasDo, err := ContainsStmt(query, "DoStmt")
+	if err != nil {
+		log.Printf("[debug][%s] analyze SQL failed: %v", remoteAddr, err)
+		return err
+	}
+	if hasDo {
+		return &QueryRejectedError{
+			Code:    "42501",
+			Message: "permission denied for DO",
+			Detail:  "DO can read any table, so it is not allowed by access_control of psql-front",
+		}
+	}
+	names, err := AnalyzeAccessedTables(query)
+	if err != nil {
+		log.Printf("[debug][%s] analyze SQL failed: %v", remoteAddr, err)
+		return err
+	}
+	tables, err := server.resolveRelations(ctx, names)
+	if err != nil {
+		return err
+	}
+	if err := server.accessControl.Check(user, append(tables, controlledTables...)); err != nil {
+		return err
+	}
+	calls, err := AnalyzeFunctionCalls(query)
+	if err != nil {
+		log.Printf("[debug][%s] analyze SQL failed: %v", remoteAddr, err)
+		return err
+	}
+	for _, call := range calls {
+		if call.String() == cacheStatusFunction.String() {
+			for _, table := range server.tables {
+				if !server.accessControl.IsAllowed(user, table) {
+					return &QueryRejectedError{
+						Code:    "42501",
+						Message: fmt.Sprintf("permission denied for function %s", call.RelName),
+						Detail:  fmt.Sprintf("%s lists all the tables, user `%s` is not allowed to access %s by access_control of psql-front", call, user, table),
+					}
+				}
+			}
+			continue
+		}
+		if call.SchemaName == cacheLifecycleTable.SchemaName {
+			// the other functions of psqlfront schema are checked by psql-front.
+			continue
+		}
+		functions, err := server.resolveFunctions(ctx, []*Table{call})
+		if err != nil {
+			return err
+		}
+		for _, function := range functions {
+			detail := fmt.Sprintf("%s can read any table, so it is not allowed by access_control of psql-front", function)
+			if function.SchemaName == cacheLifecycleTable.SchemaName {
+				detail = fmt.Sprintf("call the function with the schema name such as %s", function)
+			}
+			return &QueryRejectedError{
+				Code:    "42501",
+				Message: fmt.Sprintf("permission denied for function %s", call.RelName),
+				Detail:  detail,
+			}
+		}
+	}
+	return nil
+}
+
+// checkReadOnly rejects the query if it writes to or changes the tables managed by psql-front or psqlfront schema.
+// The unqualified names are resolved in all schemas same as access control, and the writes through the views are also rejected.
+// DO and CREATE FUNCTION are rejected only with reject_procedural_code, because their procedural code can not be inspected.
+func (server *Server) checkReadOnly(ctx context.Context, query string) error {
+	remoteAddr := GetRemoteAddr(ctx)
+	if server.rejectProceduralCode {
+		hasCode, err := ContainsStmt(query, "DoStmt", "CreateFunctionStmt")
+		if err != nil {
+			log.Printf("[debug][%s] analyze SQL failed: %v", remoteAddr, err)
+			return err
+		}
+		if hasCode {
+			return &QueryRejectedError{
+				Code:    "25006",
+				Message: "cannot execute DO or CREATE FUNCTION with read_only of psql-front",
+				Detail:  "the procedural code can modify the tables managed by psql-front, only admin_users can execute it",
+			}
+		}
+	}
+	names, schemas, err := AnalyzeWriteTargets(query)
+	if err != nil {
+		log.Printf("[debug][%s] analyze SQL failed: %v", remoteAddr, err)
+		return err
+	}
+	objects, err := server.resolveRelations(ctx, names)
+	if err != nil {
+		return err
+	}
+	functions, err := server.resolveFunctions(ctx, names)
+	if err != nil {
+		return err
+	}
+	objects = append(objects, functions...)
+	reject := func(target string) error {
+		return &QueryRejectedError{
+			Code:    "25006",
+			Message: fmt.Sprintf("cannot modify %s managed by psql-front", target),
+			Detail:  "the tables managed by psql-front and psqlfront schema are read only",
+		}
+	}
+	for _, object := range objects {
+		if object.SchemaName == cacheLifecycleTable.SchemaName {
+			return reject(object.String())
+		}
+		if _, ok := server.tables[object.String()]; ok {
+			return reject(object.String())
+		}
+	}
+	for _, schema := range schemas {
+		if schema == cacheLifecycleTable.SchemaName {
+			return reject(fmt.Sprintf(`schema "%s"`, schema))
+		}
+		for _, table := range server.tables {
+			if table.SchemaName == schema {
+				return reject(fmt.Sprintf(`schema "%s"`, schema))
+			}
+		}
+	}
+	return nil
+}
+
 var cacheLifecycleTable = &Table{
 	SchemaName: "psqlfront",
 	RelName:    "cache",
@@ -362,6 +642,11 @@ var statsTable = &Table{
 	RelName:    "stats",
 }
 
+var cacheStatusFunction = &Table{
+	SchemaName: "psqlfront",
+	RelName:    "cache_status",
+}
+
 func (server *Server) analezeTables(ctx context.Context, tables []*Table) error {
 	remoteAddr := GetRemoteAddr(ctx)
 	log.Printf("[debug][%s] try analyze table", remoteAddr)
@@ -376,7 +661,7 @@ func (server *Server) analezeTables(ctx context.Context, tables []*Table) error
 	return err
 }
 
-func (server *Server) controlCache(ctx context.Context, query string, refarencedTables []*Table, notifier Notifier) error {
+func (server *Server) controlCache(ctx context.Context, query string, refarencedTables []*Table, settings *SessionSettings, notifier Notifier) error {
 	remoteAddr := GetRemoteAddr(ctx)
 	log.Printf("[debug][%s] try cache control SQL: %s", remoteAddr, query)
 	tables := make([]*Table, 0, len(refarencedTables))
@@ -401,14 +686,23 @@ func (server *Server) controlCache(ctx context.Context, query string, refarenced
 	if err != nil {
 		return fmt.Errorf("get cache info:%w", err)
 	}
+	now := flextime.Now()
 	noHitTables := lo.Filter(tables, func(t *Table, _ int) bool {
-		_, ok := cacheInfo[t.String()]
-		return !ok
+		info, ok := cacheInfo[t.String()]
+		return !ok || info.IsExpired(now) || settings.BypassCache
 	})
-	hitTables := lo.Filter(tables, func(t *Table, _ int) bool {
-		_, ok := cacheInfo[t.String()]
-		return ok
+	hitTables := lo.Without(tables, noHitTables...)
+	revalidateTables := lo.Filter(noHitTables, func(t *Table, _ int) bool {
+		info, ok := cacheInfo[t.String()]
+		if !ok || !info.IsExpired(now) || settings.BypassCache {
+			return false
+		}
+		if settings.MaxStaleness == nil && server.refreshModeOf(info.OriginID, t.String()) != RefreshModeStaleWhileRevalidate {
+			return false
+		}
+		return server.canServeStale(info, now, settings)
 	})
+	noHitTables = lo.Without(noHitTables, revalidateTables...)
 	defer func() {
 		if len(hitTables) > 0 {
 			notifier.Notify(ctx, &pgproto3.NoticeResponse{
@@ -418,9 +712,18 @@ func (server *Server) controlCache(ctx context.Context, query string, refarenced
 				}), ", ")),
 			})
 		}
-		atomic.AddInt64(&(server.cacheHits), int64(len(hitTables)))
+		atomic.AddInt64(&(server.cacheHits), int64(len(hitTables)+len(revalidateTables)))
 		atomic.AddInt64(&(server.cacheMisses), int64(len(noHitTables)))
 	}()
+	for _, t := range revalidateTables {
+		info := cacheInfo[t.String()]
+		log.Printf("[info][%s] %s serve stale cache and refresh in background, cached_at:%s", remoteAddr, t, info.CachedAt.Format(time.RFC3339))
+		notifier.Notify(ctx, &pgproto3.NoticeResponse{
+			Severity: "NOTICE",
+			Message:  fmt.Sprintf("stale cache: %s cached at %s, refreshing in background", t, info.CachedAt.Format(time.RFC3339)),
+		})
+		go server.revalidate(remoteAddr, t)
+	}
 	if len(noHitTables) == 0 {
 		log.Printf("[info][%s] all tables cache hit", remoteAddr)
 		return nil
@@ -428,42 +731,44 @@ func (server *Server) controlCache(ctx context.Context, query string, refarenced
 	log.Printf("[info][%s] cache no hit tables: [%s]", remoteAddr, strings.Join(lo.Map(noHitTables, func(table *Table, _ int) string {
 		return table.String()
 	}), ", "))
+	var mu sync.Mutex
+	staleCaches := make([]*staleCache, 0)
 	eg, egctx := errgroup.WithContext(ctx)
 	for _, noHitTable := range noHitTables {
 		t := noHitTable
 		eg.Go(func() error {
-			tx, err := server.db.Begin(egctx)
-			log.Printf("[debug] start `%s` tx", t.String())
-			if err != nil {
-				return fmt.Errorf("start tx:%w", err)
-			}
-			var commited bool
-			defer func() {
-				if !commited {
-					if err := tx.Rollback(ctx); err != nil {
-						log.Printf("[warn][%s] %s tx rollback failed: %v", remoteAddr, t.String(), err)
-					} else {
-						log.Printf("[debug][%s] %s tx rollback", remoteAddr, t.String())
-					}
-				}
-				log.Printf("[debug][%s] end `%s` tx", remoteAddr, t.String())
-			}()
-			if err := server.refreshCache(egctx, tx, t); err != nil {
+			if err := server.refreshTableWithTx(egctx, ctx, t); err != nil {
 				log.Printf("[warn][%s] %s can not refresh cache: %v", remoteAddr, t, err)
 				var onfe *OriginNotFoundError
-				if !errors.As(err, &onfe) {
-					return fmt.Errorf("refresh cache:%w", err)
+				if errors.As(err, &onfe) {
+					return nil
 				}
-				return nil
-			}
-			if err := tx.Commit(ctx); err != nil {
-				return fmt.Errorf("commit tx:%w", err)
+				info, ok := cacheInfo[t.String()]
+				if !ok {
+					return &CacheUnavailableError{Table: t, err: err}
+				}
+				if !server.canServeStale(info, now, settings) {
+					return &CacheUnavailableError{Table: t, CachedAt: info.CachedAt, err: err}
+				}
+				log.Printf("[warn][%s] %s serve stale cache, cached_at:%s", remoteAddr, t, info.CachedAt.Format(time.RFC3339))
+				mu.Lock()
+				staleCaches = append(staleCaches, &staleCache{info: info, err: err})
+				mu.Unlock()
 			}
-			commited = true
 			return nil
 		})
 	}
-	if err := eg.Wait(); err != nil {
+	err = eg.Wait()
+	for _, sc := range staleCaches {
+		notifier.Notify(ctx, &pgproto3.NoticeResponse{
+			Severity: "WARNING",
+			Message: fmt.Sprintf(`stale cache: "%s"."%s" cached at %s, refresh failed`,
+				sc.info.SchemaName, sc.info.TableName, sc.info.CachedAt.Format(time.RFC3339),
+			),
+			Detail: sc.err.Error(),
+		})
+	}
+	if err != nil {
 		return fmt.Errorf("refresh cache failed:%w", err)
 	}
 	if err := server.analezeTables(ctx, noHitTables); err != nil {
@@ -472,6 +777,57 @@ func (server *Server) controlCache(ctx context.Context, query string, refarenced
 	return nil
 }
 
+// revalidate refreshes the table in background, while the stale cache is served.
+func (server *Server) revalidate(remoteAddr string, t *Table) {
+	ctx, cancel := context.WithTimeout(withRemoteAddr(context.Background(), remoteAddr), 24*time.Hour)
+	defer cancel()
+	if err := server.refreshTableWithTx(ctx, ctx, t); err != nil {
+		log.Printf("[warn][%s] %s background refresh failed: %v", remoteAddr, t, err)
+		return
+	}
+	if err := server.analezeTables(ctx, []*Table{t}); err != nil {
+		log.Printf("[warn][%s] %s analyze after background refresh failed: %v", remoteAddr, t, err)
+		return
+	}
+	log.Printf("[info][%s] %s background refresh finished", remoteAddr, t)
+}
+
+// refreshTableWithTx refreshes the table in a transaction, and commits it if the refresh succeeded.
+// txCtx is used to end the transaction, even if ctx is canceled.
+func (server *Server) refreshTableWithTx(ctx context.Context, txCtx context.Context, t *Table) error {
+	return server.refreshOnce(ctx, t, func() error {
+		return server.refreshTableInTx(ctx, txCtx, t)
+	})
+}
+
+func (server *Server) refreshTableInTx(ctx context.Context, txCtx context.Context, t *Table) error {
+	remoteAddr := GetRemoteAddr(ctx)
+	tx, err := server.db.Begin(ctx)
+	log.Printf("[debug] start `%s` tx", t.String())
+	if err != nil {
+		return fmt.Errorf("start tx:%w", err)
+	}
+	var commited bool
+	defer func() {
+		if !commited {
+			if err := tx.Rollback(txCtx); err != nil {
+				log.Printf("[warn][%s] %s tx rollback failed: %v", remoteAddr, t.String(), err)
+			} else {
+				log.Printf("[debug][%s] %s tx rollback", remoteAddr, t.String())
+			}
+		}
+		log.Printf("[debug][%s] end `%s` tx", remoteAddr, t.String())
+	}()
+	if err := server.refreshCache(ctx, tx, t); err != nil {
+		return err
+	}
+	if err := tx.Commit(txCtx); err != nil {
+		return fmt.Errorf("commit tx:%w", err)
+	}
+	commited = true
+	return nil
+}
+
 type OriginNotFoundError struct {
 	err error
 }
@@ -493,8 +849,79 @@ type CacheInfo struct {
 	CachedAt, ExpiredAt             time.Time
 }
 
+func (info *CacheInfo) IsExpired(now time.Time) bool {
+	return now.After(info.ExpiredAt)
+}
+
+// CacheUnavailableError is returned when the origin refresh failed, and the cache is not exists or is staler than max_staleness.
+type CacheUnavailableError struct {
+	Table    *Table
+	CachedAt time.Time
+	err      error
+}
+
+func (cue *CacheUnavailableError) Error() string {
+	if cue.CachedAt.IsZero() {
+		return fmt.Sprintf("%s refresh failed and not cached", cue.Table)
+	}
+	return fmt.Sprintf("%s refresh failed and cache at %s exceeds max staleness", cue.Table, cue.CachedAt.Format(time.RFC3339))
+}
+
+func (cue *CacheUnavailableError) Unwrap() error {
+	return cue.err
+}
+
+type staleCache struct {
+	info *CacheInfo
+	err  error
+}
+
+// canServeStale returns true if the expired cache is within max_staleness of the session or the table.
+func (server *Server) canServeStale(info *CacheInfo, now time.Time, settings *SessionSettings) bool {
+	if settings.MaxStaleness != nil {
+		return now.Sub(info.ExpiredAt) <= *settings.MaxStaleness
+	}
+	t := &Table{
+		SchemaName: info.SchemaName,
+		RelName:    info.TableName,
+	}
+	maxStaleness, ok := server.maxStalenessOf(info.OriginID, t.String())
+	if !ok {
+		return true
+	}
+	return now.Sub(info.ExpiredAt) <= maxStaleness
+}
+
+// cacheTTLOf returns ttl of the table, the table-level ttl overrides the one of the origin.
+func (server *Server) cacheTTLOf(originID string, name string) (time.Duration, bool) {
+	if t, ok := server.tables[name]; ok && t.TTL != nil {
+		return *t.TTL, true
+	}
+	ttl, ok := server.cacheTTL[originID]
+	return ttl, ok
+}
+
+// maxStalenessOf returns max_staleness of the table, the table-level max_staleness overrides the one of the origin.
+// If both are not set, returns false and the stale cache is served without limit.
+func (server *Server) maxStalenessOf(originID string, name string) (time.Duration, bool) {
+	if t, ok := server.tables[name]; ok && t.MaxStaleness != nil {
+		return *t.MaxStaleness, true
+	}
+	maxStaleness, ok := server.maxStaleness[originID]
+	return maxStaleness, ok
+}
+
+// refreshModeOf returns refresh_mode of the table, the table-level refresh_mode overrides the one of the origin.
+func (server *Server) refreshModeOf(originID string, name string) string {
+	if t, ok := server.tables[name]; ok && t.RefreshMode != "" {
+		return t.RefreshMode
+	}
+	return server.refreshMode[originID]
+}
+
 var psqlQueryBuilder = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
+// getCacheInfo returns the cache info of the tables including the expired ones.
 func (server *Server) getCacheInfo(ctx context.Context, tables []*Table) (map[string]*CacheInfo, error) {
 	remoteAddr := GetRemoteAddr(ctx)
 	log.Printf("[debug][%s] get cache info", remoteAddr)
@@ -520,7 +947,6 @@ func (server *Server) getCacheInfo(ctx context.Context, tables []*Table) (map[st
 	if err != nil {
 		return nil, err
 	}
-	now := flextime.Now()
 	defer rows.Close()
 	result := make(map[string]*CacheInfo)
 	for rows.Next() {
@@ -541,7 +967,7 @@ func (server *Server) getCacheInfo(ctx context.Context, tables []*Table) (map[st
 		originID, ok := server.originIDsByTable[t.String()]
 		if ok && originID != cacheInfo.OriginID {
 			cacheInfo.OriginID = originID
-			ttl, ok := server.cacheTTL[originID]
+			ttl, ok := server.cacheTTLOf(originID, t.String())
 			if ok {
 				renew := cacheInfo.CachedAt.Add(ttl)
 				log.Printf("[debug][%s] origin_id:%s schema_name:%s table_name:%s expred_at:%s=>%s", remoteAddr,
@@ -555,17 +981,206 @@ func (server *Server) getCacheInfo(ctx context.Context, tables []*Table) (map[st
 			"[debug][%s] origin_id:%s schema_name:%s table_name:%s cached_at:%s, exired_at:%s", remoteAddr,
 			cacheInfo.OriginID, cacheInfo.SchemaName, cacheInfo.TableName, cacheInfo.CachedAt.Format(time.RFC3339), cacheInfo.ExpiredAt.Format(time.RFC3339),
 		)
-
-		if !now.After(cacheInfo.ExpiredAt) {
-			result[t.String()] = &cacheInfo
-		}
+		result[t.String()] = &cacheInfo
 	}
 	return result, nil
 }
 
 type cacheWriter struct {
-	tx    pgx.Tx
-	table *Table
+	tx         pgx.Tx
+	table      *Table
+	validators *CacheValidators
+
+	// with swap strategy, the rows are loaded into the shadow table outside tx, and swapped in tx at the end.
+	db       *pgxpool.Pool
+	strategy string
+	shadow   *Table
+
+	loadMethod string
+}
+
+const shadowTablePrefix = "_psqlfront_shadow_"
+
+// shadowTableName returns the name of the shadow table within the 63 bytes identifier limit.
+func shadowTableName(relName string) string {
+	return truncateIdentifier(shadowTablePrefix+relName, relName)
+}
+
+// truncateIdentifier truncates name within the 63 bytes identifier limit, the hash of seed keeps it unique.
+func truncateIdentifier(name string, seed string) string {
+	if len(name) <= 63 {
+		return name
+	}
+	h := fnv.New32a()
+	h.Write([]byte(seed))
+	return fmt.Sprintf("%s_%08x", name[:63-9], h.Sum32())
+}
+
+// createShadowTable creates the empty shadow table with the columns of the target table.
+// The shadow table of the target table left by the interrupted refresh is dropped first.
+func (w *cacheWriter) createShadowTable(ctx context.Context) error {
+	shadow := &Table{
+		SchemaName:  w.table.SchemaName,
+		RelName:     shadowTableName(w.table.RelName),
+		Columns:     w.table.Columns,
+		Constraints: w.table.Constraints,
+	}
+	ddl, err := shadow.GenerateDDL()
+	if err != nil {
+		return err
+	}
+	dropSQL := fmt.Sprintf(`DROP TABLE IF EXISTS %s`, shadow.String())
+	log.Printf("[debug] execute: %s;", dropSQL)
+	if _, err := w.db.Exec(ctx, dropSQL); err != nil {
+		return fmt.Errorf("execute drop table `%s` query:%w", shadow, err)
+	}
+	log.Printf("[debug] execute: %s;", ddl)
+	if _, err := w.db.Exec(ctx, ddl); err != nil {
+		return fmt.Errorf("execute create table `%s` query:%w", shadow, err)
+	}
+	log.Printf("[info] %s created shadow table %s", w.table, shadow)
+	w.shadow = shadow
+	return nil
+}
+
+// swapShadowTable replaces the target table with the loaded shadow table in tx.
+// The target table is locked only from here to the end of tx.
+// The indexes and constraints of the shadow table are renamed for the target table, and the grants of the target table are kept.
+// If views depend on the target table, the rows are copied into the target table instead, because dropping it breaks the views.
+func (w *cacheWriter) swapShadowTable(ctx context.Context) error {
+	if w.shadow == nil {
+		return nil
+	}
+	var dependentViews int
+	sql := `SELECT COUNT(DISTINCT r.ev_class) FROM pg_catalog.pg_depend d JOIN pg_catalog.pg_rewrite r ON r.oid = d.objid ` +
+		`WHERE d.classid = 'pg_catalog.pg_rewrite'::regclass AND d.refobjid = to_regclass($1) AND r.ev_class <> d.refobjid`
+	log.Printf("[debug] execute: %s; [%s]", sql, w.table)
+	if err := w.tx.QueryRow(ctx, sql, w.table.String()).Scan(&dependentViews); err != nil {
+		return fmt.Errorf("select dependent views of `%s`:%w", w.table, err)
+	}
+	if dependentViews > 0 {
+		log.Printf("[info] %s has %d dependent views, copy rows from shadow table %s", w.table, dependentViews, w.shadow)
+		return w.copyShadowTable(ctx)
+	}
+	grants, err := w.tableGrants(ctx)
+	if err != nil {
+		return err
+	}
+	stmts := []string{
+		fmt.Sprintf(`DROP TABLE IF EXISTS %s`, w.table.String()),
+		fmt.Sprintf(`ALTER TABLE %s RENAME TO "%s"`, w.shadow.String(), w.table.RelName),
+	}
+	for _, sql := range append(stmts, grants...) {
+		log.Printf("[debug] execute: %s;", sql)
+		if _, err := w.tx.Exec(ctx, sql); err != nil {
+			return fmt.Errorf("swap shadow table `%s`:%w", w.table, err)
+		}
+	}
+	if err := w.renameShadowIndexes(ctx); err != nil {
+		return err
+	}
+	log.Printf("[info] %s swapped with shadow table %s", w.table, w.shadow)
+	w.shadow = nil
+	return nil
+}
+
+// tableGrants returns the GRANT statements to give the privileges of the target table to the swapped table.
+func (w *cacheWriter) tableGrants(ctx context.Context) ([]string, error) {
+	sql := `SELECT CASE WHEN a.grantee = 0 THEN 'PUBLIC' ELSE quote_ident(pg_catalog.pg_get_userbyid(a.grantee)) END, a.privilege_type, a.is_grantable ` +
+		`FROM pg_catalog.pg_class c, pg_catalog.aclexplode(c.relacl) a WHERE c.oid = to_regclass($1) AND a.grantee <> c.relowner`
+	log.Printf("[debug] execute: %s; [%s]", sql, w.table)
+	rows, err := w.tx.Query(ctx, sql, w.table.String())
+	if err != nil {
+		return nil, fmt.Errorf("select grants of `%s`:%w", w.table, err)
+	}
+	defer rows.Close()
+	grants := make([]string, 0)
+	for rows.Next() {
+		var grantee, privilege string
+		var grantable bool
+		if err := rows.Scan(&grantee, &privilege, &grantable); err != nil {
+			return nil, fmt.Errorf("row scan: %w", err)
+		}
+		grant := fmt.Sprintf(`GRANT %s ON %s TO %s`, privilege, w.shadow.String(), grantee)
+		if grantable {
+			grant += " WITH GRANT OPTION"
+		}
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
+
+// renameShadowIndexes renames the indexes named after the shadow table, such as `_psqlfront_shadow_<table>_pkey`, to `<table>_pkey`.
+// The constraints of the indexes are renamed together, so that the next shadow table can use the names.
+func (w *cacheWriter) renameShadowIndexes(ctx context.Context) error {
+	sql, args, err := psqlQueryBuilder.Select("indexname").From("pg_catalog.pg_indexes").Where(sq.Eq{
+		"schemaname": w.table.SchemaName,
+		"tablename":  w.table.RelName,
+	}).Where(sq.Like{
+		"indexname": strings.ReplaceAll(shadowTablePrefix, "_", `\_`) + "%",
+	}).ToSql()
+	if err != nil {
+		return fmt.Errorf("build select indexes of `%s` query:%w", w.table, err)
+	}
+	log.Printf("[debug] execute: %s; %v", sql, args)
+	rows, err := w.tx.Query(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("select indexes of `%s`:%w", w.table, err)
+	}
+	indexes := make([]string, 0)
+	for rows.Next() {
+		var index string
+		if err := rows.Scan(&index); err != nil {
+			rows.Close()
+			return fmt.Errorf("row scan: %w", err)
+		}
+		indexes = append(indexes, index)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		sql := fmt.Sprintf(`ALTER INDEX "%s"."%s" RENAME TO "%s"`, w.table.SchemaName, index, truncateIdentifier(strings.TrimPrefix(index, shadowTablePrefix), index))
+		log.Printf("[debug] execute: %s;", sql)
+		if _, err := w.tx.Exec(ctx, sql); err != nil {
+			return fmt.Errorf("rename index of `%s`:%w", w.table, err)
+		}
+	}
+	return nil
+}
+
+// copyShadowTable replaces the rows of the target table with the rows of the shadow table in tx, and drops the shadow table.
+func (w *cacheWriter) copyShadowTable(ctx context.Context) error {
+	columns := strings.Join(lo.Map(w.table.Columns, func(c *Column, _ int) string {
+		return `"` + strings.ToLower(c.Name) + `"`
+	}), ",")
+	for _, sql := range []string{
+		fmt.Sprintf(`TRUNCATE %s`, w.table.String()),
+		fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM %s`, w.table.String(), columns, columns, w.shadow.String()),
+		fmt.Sprintf(`DROP TABLE %s`, w.shadow.String()),
+	} {
+		log.Printf("[debug] execute: %s;", sql)
+		if _, err := w.tx.Exec(ctx, sql); err != nil {
+			return fmt.Errorf("copy shadow table `%s`:%w", w.table, err)
+		}
+	}
+	log.Printf("[info] %s copied from shadow table %s", w.table, w.shadow)
+	w.shadow = nil
+	return nil
+}
+
+// dropShadowTable drops the shadow table left by the failed refresh.
+func (w *cacheWriter) dropShadowTable(ctx context.Context) {
+	if w.shadow == nil {
+		return
+	}
+	sql := fmt.Sprintf(`DROP TABLE IF EXISTS %s`, w.shadow.String())
+	log.Printf("[debug] execute: %s;", sql)
+	if _, err := w.db.Exec(ctx, sql); err != nil {
+		log.Printf("[warn] %s drop shadow table failed: %v", w.table, err)
+	}
+	w.shadow = nil
 }
 
 func (w *cacheWriter) ReplaceCacheTable(ctx context.Context, t *Table) error {
@@ -574,6 +1189,11 @@ func (w *cacheWriter) ReplaceCacheTable(ctx context.Context, t *Table) error {
 	}
 	w.table.Columns = t.Columns
 	w.table.Constraints = t.Constraints
+	w.table.KeyColumns = t.KeyColumns
+	w.table.WatermarkColumn = t.WatermarkColumn
+	if w.strategy == RefreshStrategySwap {
+		return w.createShadowTable(ctx)
+	}
 	ddl, err := w.table.GenerateDDL()
 	if err != nil {
 		return err
@@ -597,21 +1217,70 @@ func (w *cacheWriter) ReplaceCacheTable(ctx context.Context, t *Table) error {
 }
 
 func (w *cacheWriter) AppendRows(ctx context.Context, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	if w.loadMethod == LoadMethodCopy {
+		if w.canCopyBinary(rows) {
+			return w.copyRowsBinary(ctx, rows)
+		}
+		if canCopyText(rows) {
+			return w.copyRowsText(ctx, rows)
+		}
+		log.Printf("[debug] %s rows have values that can not be copied, fallback to insert", w.table)
+	}
 	chunk := lo.Chunk(rows, 1000)
 	for _, r := range chunk {
-		if err := w.appendRows(ctx, r); err != nil {
+		if err := w.appendRows(ctx, r, ""); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (w *cacheWriter) appendRows(ctx context.Context, rows [][]interface{}) error {
+// appendBatchSize is the number of rows passed to AppendRows at once by AppendRowIterator.
+const appendBatchSize = 10000
+
+func (w *cacheWriter) AppendRowIterator(ctx context.Context, iter RowIterator) error {
+	buf := make([][]interface{}, 0, appendBatchSize)
+	var total int
+	for iter.Next() {
+		values, err := iter.Values()
+		if err != nil {
+			return err
+		}
+		buf = append(buf, values)
+		if len(buf) < appendBatchSize {
+			continue
+		}
+		if err := w.AppendRows(ctx, buf); err != nil {
+			return err
+		}
+		total += len(buf)
+		buf = buf[:0]
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if err := w.AppendRows(ctx, buf); err != nil {
+		return err
+	}
+	total += len(buf)
+	log.Printf("[info] %s %d rows appended", w.table, total)
+	return nil
+}
 
+func (w *cacheWriter) appendRows(ctx context.Context, rows [][]interface{}, suffix string) error {
+	target := w.table
+	exec := w.tx.Exec
+	if w.shadow != nil {
+		target = w.shadow
+		exec = w.db.Exec
+	}
 	columns := lo.Map(w.table.Columns, func(c *Column, _ int) string {
 		return `"` + strings.ToLower(c.Name) + `"`
 	})
-	q := psqlQueryBuilder.Insert(w.table.String()).Columns(columns...)
+	q := psqlQueryBuilder.Insert(target.String()).Columns(columns...)
 
 	for _, row := range rows {
 		if len(row) != len(columns) {
@@ -619,20 +1288,78 @@ func (w *cacheWriter) appendRows(ctx context.Context, rows [][]interface{}) erro
 		}
 		q = q.Values(row...)
 	}
+	if suffix != "" {
+		q = q.Suffix(suffix)
+	}
 	sql, args, err := q.ToSql()
 	if err != nil {
 		return fmt.Errorf("build insert into `%s` query:%w", w.table, err)
 	}
-	log.Printf("[debug] execute: %s; %v", sql, args)
-	tag, err := w.tx.Exec(ctx, sql, args...)
+	log.Printf("[debug] execute: INSERT INTO %s (%s) VALUES ...; %d rows", target, strings.Join(columns, ","), len(rows))
+	tag, err := exec(ctx, sql, args...)
 	if err != nil {
-		return fmt.Errorf("execute insert into `%s` query:%w", w.table, err)
+		return fmt.Errorf("execute insert into `%s` query:%w", target, err)
+	}
+	log.Printf("[info] %s %d rows inserted", target, tag.RowsAffected())
+	return nil
+}
+
+func (w *cacheWriter) UpsertRows(ctx context.Context, rows [][]interface{}) error {
+	if len(w.table.KeyColumns) == 0 {
+		return fmt.Errorf("%s has no key columns to upsert", w.table)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := w.createKeyIndex(ctx); err != nil {
+		return err
+	}
+	keys := lo.Map(w.table.KeyColumns, func(c string, _ int) string {
+		return `"` + strings.ToLower(c) + `"`
+	})
+	updates := make([]string, 0, len(w.table.Columns))
+	for _, c := range w.table.Columns {
+		column := `"` + strings.ToLower(c.Name) + `"`
+		if lo.Contains(keys, column) {
+			continue
+		}
+		updates = append(updates, column+"=EXCLUDED."+column)
+	}
+	suffix := fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", strings.Join(keys, ","))
+	if len(updates) > 0 {
+		suffix = fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(keys, ","), strings.Join(updates, ","))
+	}
+	for _, r := range lo.Chunk(w.table.UniqRowsByKey(rows), 1000) {
+		if err := w.appendRows(ctx, r, suffix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createKeyIndex creates the unique index of the key columns for ON CONFLICT, if not exists.
+func (w *cacheWriter) createKeyIndex(ctx context.Context) error {
+	target := w.table
+	exec := w.tx.Exec
+	if w.shadow != nil {
+		target = w.shadow
+		exec = w.db.Exec
+	}
+	keys := lo.Map(w.table.KeyColumns, func(c string, _ int) string {
+		return `"` + strings.ToLower(c) + `"`
+	})
+	sql := fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS "%s" ON %s (%s)`, truncateIdentifier(target.RelName+"_psqlfront_key", target.RelName), target, strings.Join(keys, ","))
+	log.Printf("[debug] execute: %s;", sql)
+	if _, err := exec(ctx, sql); err != nil {
+		return fmt.Errorf("execute create unique index `%s` query:%w", target, err)
 	}
-	log.Printf("[info] %s %d rows inserted", w.table, tag.RowsAffected())
 	return nil
 }
 
 func (w *cacheWriter) DeleteRows(ctx context.Context) error {
+	if w.strategy == RefreshStrategySwap {
+		return w.createShadowTable(ctx)
+	}
 	sql, args, err := psqlQueryBuilder.Delete(w.table.String()).ToSql()
 	if err != nil {
 		return fmt.Errorf("build delete from `%s` query:%w", w.table, err)
@@ -650,31 +1377,149 @@ func (w *cacheWriter) TargetTable() *Table {
 	return w.table
 }
 
-func (server *Server) refreshCache(ctx context.Context, tx pgx.Tx, table *Table) error {
-	remoteAddr := GetRemoteAddr(ctx)
-	cond, ok := server.tableCond[table.String()]
-	if !ok {
-		server.tableCond[table.String()] = sync.NewCond(&sync.Mutex{})
+func (w *cacheWriter) CacheValidators(ctx context.Context) (*CacheValidators, error) {
+	sql, args, err := psqlQueryBuilder.Select(
+		"COALESCE(etag, '')",
+		"COALESCE(last_modified, '')",
+	).From(cacheLifecycleTable.String()).Where(sq.Eq{
+		"schema_name": w.table.SchemaName,
+		"table_name":  w.table.RelName,
+	}).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build select validators `%s` query:%w", w.table, err)
+	}
+	log.Printf("[debug] execute: %s; %v", sql, args)
+	var v CacheValidators
+	if err := w.tx.QueryRow(ctx, sql, args...).Scan(&v.ETag, &v.LastModified); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &CacheValidators{}, nil
+		}
+		return nil, fmt.Errorf("execute select validators `%s` query:%w", w.table, err)
+	}
+	if v.IsEmpty() {
+		return &v, nil
+	}
+	// the validators are of the rows cached before, so they are not used if the table was recreated or emptied.
+	existsSQL := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s)`, w.table)
+	log.Printf("[debug] execute: %s;", existsSQL)
+	var exists bool
+	if err := w.tx.QueryRow(ctx, existsSQL).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("execute select exists `%s` query:%w", w.table, err)
+	}
+	if !exists {
+		log.Printf("[info] %s has no rows, request the origin without the validators", w.table)
+		return &CacheValidators{}, nil
+	}
+	return &v, nil
+}
+
+func (w *cacheWriter) SetCacheValidators(_ context.Context, v *CacheValidators) error {
+	w.validators = v
+	return nil
+}
+
+func (w *cacheWriter) Watermark(ctx context.Context) (string, error) {
+	sql, args, err := psqlQueryBuilder.Select(
+		"COALESCE(watermark, '')",
+	).From(cacheLifecycleTable.String()).Where(sq.Eq{
+		"schema_name": w.table.SchemaName,
+		"table_name":  w.table.RelName,
+	}).ToSql()
+	if err != nil {
+		return "", fmt.Errorf("build select watermark `%s` query:%w", w.table, err)
+	}
+	log.Printf("[debug] execute: %s; %v", sql, args)
+	var watermark string
+	if err := w.tx.QueryRow(ctx, sql, args...).Scan(&watermark); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("execute select watermark `%s` query:%w", w.table, err)
+	}
+	return watermark, nil
+}
+
+// currentWatermark returns MAX(WatermarkColumn) of the refreshed table, returns nil if the table is not incremental or empty.
+func (w *cacheWriter) currentWatermark(ctx context.Context) (interface{}, error) {
+	if !w.table.IsIncremental() {
+		return nil, nil
 	}
-	mu, ok := server.tableMutex[table.String()]
+	sql := fmt.Sprintf(`SELECT MAX("%s")::text FROM %s`, strings.ToLower(w.table.WatermarkColumn), w.table)
+	log.Printf("[debug] execute: %s;", sql)
+	var watermark *string
+	if err := w.tx.QueryRow(ctx, sql).Scan(&watermark); err != nil {
+		return nil, fmt.Errorf("execute select max watermark `%s` query:%w", w.table, err)
+	}
+	if watermark == nil {
+		return nil, nil
+	}
+	log.Printf("[info] %s watermark is %s", w.table, *watermark)
+	return *watermark, nil
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// tableRefresh shares the result of the running refresh of a table with the callers waiting for it.
+type tableRefresh struct {
+	cond       *sync.Cond
+	running    bool
+	generation int
+	err        error
+}
+
+func newTableRefresh() *tableRefresh {
+	return &tableRefresh{
+		cond: sync.NewCond(&sync.Mutex{}),
+	}
+}
+
+// refreshOnce calls refresh of the table, if other refresh of the table is running, waits for it and returns its error instead.
+func (server *Server) refreshOnce(ctx context.Context, table *Table, refresh func() error) error {
+	remoteAddr := GetRemoteAddr(ctx)
+	tr, ok := server.tableRefreshes[table.String()]
 	if !ok {
-		server.tableMutex[table.String()] = &sync.Mutex{}
+		// the table not managed by psql-front fails in refresh.
+		return refresh()
 	}
 	log.Printf("[debug][%s] lock check for %s", remoteAddr, table)
-	cond.L.Lock()
-	if !mu.TryLock() {
+	tr.cond.L.Lock()
+	if tr.running {
 		log.Printf("[info][%s] wait other refresh for %s ", remoteAddr, table)
-		cond.Wait()
+		generation := tr.generation
+		for tr.generation == generation {
+			tr.cond.Wait()
+		}
+		err := tr.err
+		tr.cond.L.Unlock()
 		log.Printf("[info][%s] finish other refresh for %s ", remoteAddr, table)
-		cond.L.Unlock()
+		if err != nil {
+			return fmt.Errorf("other refresh of %s failed: %w", table, err)
+		}
 		return nil
 	}
-	cond.L.Unlock()
+	tr.running = true
+	tr.cond.L.Unlock()
+
+	var err error
 	defer func() {
-		mu.Unlock()
-		cond.Broadcast()
+		tr.cond.L.Lock()
+		tr.running = false
+		tr.err = err
+		tr.generation++
+		tr.cond.Broadcast()
+		tr.cond.L.Unlock()
 	}()
+	err = refresh()
+	return err
+}
 
+func (server *Server) refreshCache(ctx context.Context, tx pgx.Tx, table *Table) error {
+	remoteAddr := GetRemoteAddr(ctx)
 	log.Printf("[debug] refresh target %s: %d columns", table.String(), len(table.Columns))
 	originID, ok := server.originIDsByTable[table.String()]
 	if !ok {
@@ -685,16 +1530,36 @@ func (server *Server) refreshCache(ctx context.Context, tx pgx.Tx, table *Table)
 		return WrapOriginNotFoundError(fmt.Errorf("origin %s not found", table))
 	}
 	log.Printf("[info] refresh cache origin `%s`", originID)
-	err := origin.RefreshCache(ctx, &cacheWriter{
-		tx:    tx,
-		table: table,
-	})
+	ttl, ok := server.cacheTTLOf(originID, table.String())
+	if !ok {
+		return fmt.Errorf("%s's ttl not found", originID)
+	}
+	w := &cacheWriter{
+		tx:         tx,
+		table:      table,
+		db:         server.db,
+		strategy:   server.refreshStrategy[originID],
+		loadMethod: server.loadMethod,
+	}
+	defer w.dropShadowTable(ctx)
+	err := origin.RefreshCache(ctx, w)
+	if err == nil {
+		err = w.swapShadowTable(ctx)
+	}
+	if errors.Is(err, ErrNotModified) {
+		log.Printf("[info][%s] %s is not modified, extend expiration", remoteAddr, table)
+		return server.extendCacheExpiration(ctx, tx, table, originID, ttl)
+	}
 	if err != nil {
 		return fmt.Errorf("origin %s, table %s get rows:%w", originID, table, err)
 	}
-	ttl, ok := server.cacheTTL[originID]
-	if !ok {
-		return fmt.Errorf("%s's ttl not found", originID)
+	var etag, lastModified interface{}
+	if !w.validators.IsEmpty() {
+		etag, lastModified = nullIfEmpty(w.validators.ETag), nullIfEmpty(w.validators.LastModified)
+	}
+	watermark, err := w.currentWatermark(ctx)
+	if err != nil {
+		return err
 	}
 	sql, args, err := psqlQueryBuilder.Insert(cacheLifecycleTable.String()).Columns(
 		"schema_name",
@@ -702,14 +1567,20 @@ func (server *Server) refreshCache(ctx context.Context, tx pgx.Tx, table *Table)
 		"origin_id",
 		"cached_at",
 		"expired_at",
+		"etag",
+		"last_modified",
+		"watermark",
 	).Values(
 		table.SchemaName,
 		table.RelName,
 		originID,
 		sq.Expr("NOW()"),
 		sq.Expr(fmt.Sprintf("NOW() + interval '%d seconds'", int64(ttl.Seconds()))),
+		etag,
+		lastModified,
+		watermark,
 	).Suffix(
-		"ON CONFLICT (schema_name, table_name) DO UPDATE SET origin_id=EXCLUDED.origin_id, cached_at=EXCLUDED.cached_at,expired_at=EXCLUDED.expired_at",
+		"ON CONFLICT (schema_name, table_name) DO UPDATE SET origin_id=EXCLUDED.origin_id, cached_at=EXCLUDED.cached_at,expired_at=EXCLUDED.expired_at,etag=EXCLUDED.etag,last_modified=EXCLUDED.last_modified,watermark=EXCLUDED.watermark",
 	).ToSql()
 	if err != nil {
 		return fmt.Errorf("build cache upsert `%s` query:%w", table, err)
@@ -722,3 +1593,24 @@ func (server *Server) refreshCache(ctx context.Context, tx pgx.Tx, table *Table)
 	log.Printf("[info] %s %s", cacheLifecycleTable.String(), tag)
 	return nil
 }
+
+// extendCacheExpiration keeps cached_at and the validators, and only extends expired_at.
+func (server *Server) extendCacheExpiration(ctx context.Context, tx pgx.Tx, table *Table, originID string, ttl time.Duration) error {
+	sql, args, err := psqlQueryBuilder.Update(cacheLifecycleTable.String()).
+		Set("origin_id", originID).
+		Set("expired_at", sq.Expr(fmt.Sprintf("NOW() + interval '%d seconds'", int64(ttl.Seconds())))).
+		Where(sq.Eq{
+			"schema_name": table.SchemaName,
+			"table_name":  table.RelName,
+		}).ToSql()
+	if err != nil {
+		return fmt.Errorf("build cache update `%s` query:%w", table, err)
+	}
+	log.Printf("[debug] execute: %s; %v", sql, args)
+	tag, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("execute cache update `%s` query:%w", table, err)
+	}
+	log.Printf("[info] %s %s", cacheLifecycleTable.String(), tag)
+	return nil
+}
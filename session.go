@@ -0,0 +1,224 @@
+package psqlfront
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	json "github.com/goccy/go-json"
+	pgquery "github.com/pganalyze/pg_query_go/v2"
+)
+
+const (
+	// SettingMaxStaleness overrides max_staleness in the session, the expired tables within it are served and refreshed in background.
+	SettingMaxStaleness = "psqlfront.max_staleness"
+	// SettingBypassCache refreshes the referenced tables before every query in the session, regardless of the expiration.
+	SettingBypassCache = "psqlfront.bypass_cache"
+	// SettingWaitForRefresh is on by default. If off, the query is sent without waiting for the refresh.
+	SettingWaitForRefresh = "psqlfront.wait_for_refresh"
+)
+
+// SessionSettings are the psqlfront.* settings changed by SET command in the session.
+type SessionSettings struct {
+	MaxStaleness   *time.Duration
+	BypassCache    bool
+	WaitForRefresh bool
+}
+
+// DefaultSessionSettings returns the settings at the start of the session.
+func DefaultSessionSettings() *SessionSettings {
+	return &SessionSettings{
+		WaitForRefresh: true,
+	}
+}
+
+// Session holds the settings of the connection, and is safe for concurrent use.
+type Session struct {
+	mu       sync.Mutex
+	settings SessionSettings
+}
+
+func NewSession() *Session {
+	return &Session{
+		settings: *DefaultSessionSettings(),
+	}
+}
+
+// Settings returns the snapshot of the current settings.
+func (s *Session) Settings() *SessionSettings {
+	if s == nil {
+		return DefaultSessionSettings()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings := s.settings
+	return &settings
+}
+
+// ErrUnknownSetting is returned by Session.ApplyQuery when the query sets an unknown psqlfront.* setting.
+var ErrUnknownSetting = errors.New("unrecognized configuration parameter")
+
+// ApplyQuery applies SET, RESET and DISCARD ALL commands of psqlfront.* settings in the query.
+// SET LOCAL is applied as SET, and the settings are not reverted by ROLLBACK.
+func (s *Session) ApplyQuery(query string) error {
+	lower := strings.ToLower(query)
+	if !strings.Contains(lower, "psqlfront.") && !strings.Contains(lower, "reset") && !strings.Contains(lower, "discard") {
+		return nil
+	}
+	tree, err := pgquery.ParseToJSON(query)
+	if err != nil {
+		// the syntax error is reported by upstream.
+		return nil
+	}
+	var obj interface{}
+	if err := json.Unmarshal([]byte(tree), &obj); err != nil {
+		return err
+	}
+	stmts, err := findJSONValues[map[string]interface{}](obj, "stmt")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings := s.settings
+	for _, stmt := range stmts {
+		if discard, ok := stmt["DiscardStmt"].(map[string]interface{}); ok {
+			if discard["target"] == "DISCARD_ALL" {
+				settings = *DefaultSessionSettings()
+			}
+			continue
+		}
+		set, ok := stmt["VariableSetStmt"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		kind, _ := set["kind"].(string)
+		if kind == "VAR_RESET_ALL" {
+			settings = *DefaultSessionSettings()
+			continue
+		}
+		name, _ := set["name"].(string)
+		name = strings.ToLower(name)
+		if !strings.HasPrefix(name, "psqlfront.") {
+			continue
+		}
+		var value *string
+		if kind == "VAR_SET_VALUE" {
+			args, _ := set["args"].([]interface{})
+			if len(args) != 1 {
+				return fmt.Errorf("SET %s takes only one argument", name)
+			}
+			v, err := settingValue(args[0])
+			if err != nil {
+				return fmt.Errorf("SET %s: %w", name, err)
+			}
+			value = &v
+		}
+		if err := settings.set(name, value); err != nil {
+			return err
+		}
+	}
+	s.settings = settings
+	return nil
+}
+
+func settingValue(arg interface{}) (string, error) {
+	aConst, ok := arg.(map[string]interface{})["A_Const"].(map[string]interface{})
+	if !ok {
+		return "", errors.New("value must be a constant")
+	}
+	val, _ := aConst["val"].(map[string]interface{})
+	if str, ok := val["String"].(map[string]interface{}); ok {
+		if s, ok := str["str"].(string); ok {
+			return s, nil
+		}
+	}
+	if integer, ok := val["Integer"].(map[string]interface{}); ok {
+		if i, ok := integer["ival"].(float64); ok {
+			return strconv.FormatInt(int64(i), 10), nil
+		}
+	}
+	return "", errors.New("value must be a string or an integer")
+}
+
+// set sets the value of the setting, nil value resets it to the default.
+func (settings *SessionSettings) set(name string, value *string) error {
+	defaults := DefaultSessionSettings()
+	switch name {
+	case SettingMaxStaleness:
+		if value == nil {
+			settings.MaxStaleness = defaults.MaxStaleness
+			return nil
+		}
+		d, err := parseSettingDuration(*value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+		settings.MaxStaleness = &d
+	case SettingBypassCache, SettingWaitForRefresh:
+		b := defaults.BypassCache
+		if name == SettingWaitForRefresh {
+			b = defaults.WaitForRefresh
+		}
+		if value != nil {
+			var err error
+			if b, err = parseSettingBool(*value); err != nil {
+				return fmt.Errorf("invalid value for %s: %w", name, err)
+			}
+		}
+		if name == SettingBypassCache {
+			settings.BypassCache = b
+		} else {
+			settings.WaitForRefresh = b
+		}
+	default:
+		return fmt.Errorf("%w \"%s\"", ErrUnknownSetting, name)
+	}
+	return nil
+}
+
+// parseSettingDuration parses a duration such as `5m`, the integer is seconds.
+func parseSettingDuration(str string) (time.Duration, error) {
+	str = strings.TrimSpace(str)
+	if sec, err := strconv.ParseInt(str, 10, 64); err == nil {
+		str = fmt.Sprintf("%ds", sec)
+	}
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("must not be negative")
+	}
+	return d, nil
+}
+
+// parseSettingBool parses a boolean same as PostgreSQL, such as on/off, true/false, yes/no and 1/0.
+func parseSettingBool(str string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(str)) {
+	case "on", "true", "yes", "1", "t", "y":
+		return true, nil
+	case "off", "false", "no", "0", "f", "n":
+		return false, nil
+	}
+	return false, fmt.Errorf("`%s` is not a boolean", str)
+}
+
+var sessionCtxKey psqlfrontCtxKey = "__session"
+
+func withSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, sessionCtxKey, session)
+}
+
+// GetSession returns the session of the connection, returns nil if not in a connection.
+func GetSession(ctx context.Context) *Session {
+	session, ok := ctx.Value(sessionCtxKey).(*Session)
+	if ok {
+		return session
+	}
+	return nil
+}
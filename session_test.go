@@ -0,0 +1,39 @@
+package psqlfront_test
+
+import (
+	"testing"
+	"time"
+
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionApplyQuery(t *testing.T) {
+	session := psqlfront.NewSession()
+	require.EqualValues(t, psqlfront.DefaultSessionSettings(), session.Settings())
+
+	require.NoError(t, session.ApplyQuery("SET psqlfront.max_staleness = '5m'"))
+	require.NoError(t, session.ApplyQuery("SET psqlfront.bypass_cache = on; SET LOCAL psqlfront.wait_for_refresh TO false"))
+	require.NoError(t, session.ApplyQuery("SET search_path = example, public"))
+	require.EqualValues(t, &psqlfront.SessionSettings{
+		MaxStaleness:   psqlfront.PtrValue(5 * time.Minute),
+		BypassCache:    true,
+		WaitForRefresh: false,
+	}, session.Settings())
+
+	require.NoError(t, session.ApplyQuery("SET psqlfront.max_staleness = 30"))
+	require.Equal(t, 30*time.Second, *session.Settings().MaxStaleness, "integer is seconds")
+
+	require.NoError(t, session.ApplyQuery("RESET psqlfront.bypass_cache"))
+	require.NoError(t, session.ApplyQuery("SET psqlfront.wait_for_refresh = DEFAULT"))
+	require.False(t, session.Settings().BypassCache)
+	require.True(t, session.Settings().WaitForRefresh)
+
+	require.ErrorIs(t, session.ApplyQuery("SET psqlfront.bypass = on"), psqlfront.ErrUnknownSetting)
+	require.EqualError(t, session.ApplyQuery("SET psqlfront.bypass_cache = maybe"), "invalid value for psqlfront.bypass_cache: `maybe` is not a boolean")
+	require.Error(t, session.ApplyQuery("SET psqlfront.max_staleness = '-5m'"))
+	require.Equal(t, 30*time.Second, *session.Settings().MaxStaleness, "invalid values are not applied")
+
+	require.NoError(t, session.ApplyQuery("RESET ALL"))
+	require.EqualValues(t, psqlfront.DefaultSessionSettings(), session.Settings())
+}
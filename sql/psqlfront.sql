@@ -24,3 +24,37 @@ CREATE TABLE IF NOT EXISTS "psqlfront"."cache" (
     expired_at TIMESTAMP NOT NULL,
     PRIMARY KEY(schema_name,table_name)
 );
+
+ALTER TABLE "psqlfront"."cache" ADD COLUMN IF NOT EXISTS etag TEXT;
+ALTER TABLE "psqlfront"."cache" ADD COLUMN IF NOT EXISTS last_modified TEXT;
+ALTER TABLE "psqlfront"."cache" ADD COLUMN IF NOT EXISTS watermark TEXT;
+
+CREATE OR REPLACE FUNCTION "psqlfront"."refresh"(target TEXT) RETURNS TIMESTAMP AS $$
+    SELECT cached_at FROM "psqlfront"."cache"
+    WHERE schema_name || '.' || table_name = CASE WHEN strpos(target, '.') > 0 THEN target ELSE 'public.' || target END
+$$ LANGUAGE SQL STABLE;
+
+CREATE OR REPLACE FUNCTION "psqlfront"."invalidate"(target TEXT) RETURNS BIGINT AS $$
+    WITH invalidated AS (
+        UPDATE "psqlfront"."cache" SET expired_at = LEAST(expired_at, NOW()::TIMESTAMP)
+        WHERE origin_id = target OR schema_name || '.' || table_name = target
+        RETURNING 1
+    )
+    SELECT COUNT(*) FROM invalidated
+$$ LANGUAGE SQL VOLATILE;
+
+CREATE OR REPLACE FUNCTION "psqlfront"."cache_status"() RETURNS TABLE (
+    schema_name VARCHAR(255),
+    table_name VARCHAR(255),
+    origin_id VARCHAR(255),
+    cached_at TIMESTAMP,
+    expired_at TIMESTAMP,
+    expired BOOLEAN,
+    etag TEXT,
+    last_modified TEXT,
+    watermark TEXT
+) AS $$
+    SELECT c.schema_name, c.table_name, c.origin_id, c.cached_at, c.expired_at, c.expired_at <= NOW(), c.etag, c.last_modified, c.watermark
+    FROM "psqlfront"."cache" AS c
+    ORDER BY c.schema_name, c.table_name
+$$ LANGUAGE SQL STABLE;
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 )
 
 type Table struct {
@@ -12,6 +13,114 @@ type Table struct {
 
 	Columns     []*Column
 	Constraints []string
+
+	// RefreshSchedule overrides refresh_schedule of the origin, if not empty.
+	RefreshSchedule string
+	// TTL, MaxStaleness and RefreshMode override the cache policy of the origin, if set.
+	TTL          *time.Duration
+	MaxStaleness *time.Duration
+	RefreshMode  string
+
+	// KeyColumns and WatermarkColumn are set for the table refreshed incrementally.
+	// The rows are upserted by KeyColumns, and MAX(WatermarkColumn) is saved as the watermark for the next refresh.
+	KeyColumns      []string
+	WatermarkColumn string
+}
+
+// IsIncremental returns true if the table is refreshed incrementally.
+func (t *Table) IsIncremental() bool {
+	return len(t.KeyColumns) > 0 && t.WatermarkColumn != ""
+}
+
+// UniqRowsByKey returns the rows with the unique KeyColumns, the rows are the values of Columns in order.
+// For the rows of the same key, the row of the highest WatermarkColumn is kept, and the later row is kept if the watermarks are equal.
+// ON CONFLICT DO UPDATE can not update a row twice in a statement, so the rows are made unique before upserting.
+func (t *Table) UniqRowsByKey(rows [][]interface{}) [][]interface{} {
+	keyIndexes := make([]int, 0, len(t.KeyColumns))
+	watermarkIndex := -1
+	for i, c := range t.Columns {
+		for _, key := range t.KeyColumns {
+			if strings.EqualFold(c.Name, key) {
+				keyIndexes = append(keyIndexes, i)
+			}
+		}
+		if strings.EqualFold(c.Name, t.WatermarkColumn) {
+			watermarkIndex = i
+		}
+	}
+	if len(keyIndexes) == 0 {
+		return rows
+	}
+	positions := make(map[string]int, len(rows))
+	uniq := make([][]interface{}, 0, len(rows))
+	for _, row := range rows {
+		keyValues := make([]string, 0, len(keyIndexes))
+		for _, i := range keyIndexes {
+			if i < len(row) {
+				keyValues = append(keyValues, fmt.Sprintf("%T:%v", row[i], row[i]))
+			}
+		}
+		key := strings.Join(keyValues, "\x00")
+		pos, ok := positions[key]
+		if !ok {
+			positions[key] = len(uniq)
+			uniq = append(uniq, row)
+			continue
+		}
+		if watermarkIndex < 0 || watermarkIndex >= len(row) || compareWatermarks(row[watermarkIndex], uniq[pos][watermarkIndex]) >= 0 {
+			uniq[pos] = row
+		}
+	}
+	return uniq
+}
+
+// compareWatermarks compares the values of the watermark column, the values of the unknown types are compared as strings.
+func compareWatermarks(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+	switch a := a.(type) {
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			switch {
+			case a.Before(b):
+				return -1
+			case a.After(b):
+				return 1
+			}
+			return 0
+		}
+	case int64:
+		if b, ok := b.(int64); ok {
+			return compareOrdered(a, b)
+		}
+	case int32:
+		if b, ok := b.(int32); ok {
+			return compareOrdered(a, b)
+		}
+	case float64:
+		if b, ok := b.(float64); ok {
+			return compareOrdered(a, b)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func compareOrdered[T int32 | int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
 }
 
 type Column struct {
@@ -21,6 +130,22 @@ type Column struct {
 	Contraint string
 }
 
+var textTypes = []string{"TEXT", "VARCHAR", "CHARACTER VARYING", "CHAR", "CHARACTER", "BPCHAR"}
+
+// IsTextType returns true if the column is a character type.
+func (c *Column) IsTextType() bool {
+	dataType := strings.ToUpper(strings.TrimSpace(c.DataType))
+	if i := strings.IndexByte(dataType, '('); i >= 0 {
+		dataType = strings.TrimSpace(dataType[:i])
+	}
+	for _, t := range textTypes {
+		if dataType == t {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *Table) String() string {
 	return fmt.Sprintf(`"%s"."%s"`, t.SchemaName, t.RelName)
 }
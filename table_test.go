@@ -0,0 +1,39 @@
+package psqlfront_test
+
+import (
+	"testing"
+	"time"
+
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableUniqRowsByKey(t *testing.T) {
+	table := &psqlfront.Table{
+		SchemaName: "public",
+		RelName:    "events",
+		Columns: []*psqlfront.Column{
+			{Name: "id", DataType: "BIGINT"},
+			{Name: "name", DataType: "TEXT"},
+			{Name: "updated_at", DataType: "TIMESTAMP"},
+		},
+		KeyColumns:      []string{"ID"},
+		WatermarkColumn: "updated_at",
+	}
+	day := func(d int) time.Time {
+		return time.Date(2022, 8, d, 0, 0, 0, 0, time.UTC)
+	}
+	rows := [][]interface{}{
+		{int64(1), "signup", day(1)},
+		{int64(2), "login", day(3)},
+		{int64(1), "login", day(2)},
+		{int64(2), "signup", day(2)},
+		{int64(3), "signup", day(1)},
+		{int64(3), "logout", day(1)},
+	}
+	require.EqualValues(t, [][]interface{}{
+		{int64(1), "login", day(2)},
+		{int64(2), "login", day(3)},
+		{int64(3), "logout", day(1)},
+	}, table.UniqRowsByKey(rows), "the row of the highest watermark is kept, and the later row for the same watermark")
+}
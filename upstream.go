@@ -0,0 +1,93 @@
+package psqlfront
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+)
+
+// ErrUpstreamSSLNotSupported is returned when ssl_mode requires SSL but the cache database does not support it.
+var ErrUpstreamSSLNotSupported = errors.New("upstream does not support SSL")
+
+// UpstreamDialer dials the cache database for the proxied connections, and negotiates SSL by SSLRequest as ssl_mode of cache_database.
+type UpstreamDialer struct {
+	addr        string
+	tlsConfig   *tls.Config
+	tlsRequired bool
+}
+
+// NewUpstreamDialer returns UpstreamDialer of the cache database.
+// ssl_mode follows libpq: disable and allow do not use SSL, prefer uses SSL if the cache database supports it,
+// require, verify-ca and verify-full fail if it does not. verify-ca and verify-full verify the certificate by ssl_root_cert or the system roots.
+func NewUpstreamDialer(cfg *CacheDatabaseConfig) (*UpstreamDialer, error) {
+	pgCfg, err := pgconn.ParseConfig(cfg.DSN())
+	if err != nil {
+		return nil, fmt.Errorf("parse cache_database: %w", err)
+	}
+	d := &UpstreamDialer{
+		addr:      net.JoinHostPort(cfg.Host, fmt.Sprint(cfg.Port)),
+		tlsConfig: pgCfg.TLSConfig,
+	}
+	if d.tlsConfig != nil {
+		d.tlsRequired = true
+		for _, fallback := range pgCfg.Fallbacks {
+			if fallback.TLSConfig == nil {
+				d.tlsRequired = false
+			}
+		}
+	}
+	return d, nil
+}
+
+// Addr returns the address of the cache database.
+func (d *UpstreamDialer) Addr() string {
+	return d.addr
+}
+
+// DialContext connects to the cache database, the returned conn is ready to send the startup message.
+func (d *UpstreamDialer) DialContext(ctx context.Context) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return nil, err
+	}
+	if d.tlsConfig == nil {
+		return conn, nil
+	}
+	if _, err := conn.Write((&pgproto3.SSLRequest{}).Encode(nil)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("send SSLRequest:%w", err)
+	}
+	var resp [1]byte
+	if _, err := io.ReadFull(conn, resp[:]); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("receive SSLRequest response:%w", err)
+	}
+	switch resp[0] {
+	case 'S':
+		tlsConn := tls.Client(conn, d.tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("upstream TLS handshake:%w", err)
+		}
+		log.Printf("[debug][%s] upstream connection uses SSL", GetRemoteAddr(ctx))
+		return tlsConn, nil
+	case 'N':
+		if d.tlsRequired {
+			conn.Close()
+			return nil, ErrUpstreamSSLNotSupported
+		}
+		log.Printf("[debug][%s] upstream does not support SSL, connection is not encrypted", GetRemoteAddr(ctx))
+		return conn, nil
+	default:
+		conn.Close()
+		return nil, fmt.Errorf("unexpected SSLRequest response `%c`", resp[0])
+	}
+}
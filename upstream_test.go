@@ -0,0 +1,150 @@
+package psqlfront_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgproto3/v2"
+	psqlfront "github.com/mashiike/psql-front"
+	"github.com/stretchr/testify/require"
+)
+
+// startSSLUpstream starts a server which answers SSLRequest, it uses TLS with the certificate if it is not nil.
+// The returned channel receives whether the client sent SSLRequest.
+func startSSLUpstream(t *testing.T, cert *tls.Certificate) (*psqlfront.CacheDatabaseConfig, <-chan bool) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	sslRequested := make(chan bool, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		backend := pgproto3.NewBackend(pgproto3.NewChunkReader(conn), conn)
+		msg, err := backend.ReceiveStartupMessage()
+		if err != nil {
+			return
+		}
+		_, ok := msg.(*pgproto3.SSLRequest)
+		sslRequested <- ok
+		if !ok {
+			return
+		}
+		if cert == nil {
+			conn.Write([]byte{'N'})
+		} else {
+			conn.Write([]byte{'S'})
+			tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{*cert}})
+			defer tlsConn.Close()
+			conn = tlsConn
+		}
+		pgproto3.NewBackend(pgproto3.NewChunkReader(conn), conn).ReceiveStartupMessage()
+	}()
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+	portNum, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return &psqlfront.CacheDatabaseConfig{
+		Host:     host,
+		Port:     portNum,
+		Username: "postgres",
+		Database: "postgres",
+	}, sslRequested
+}
+
+// generateCertificate returns the certificate of 127.0.0.1 and the path of its self-signed CA certificate.
+func generateCertificate(t *testing.T) (*tls.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "psql-front test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	rootCert := filepath.Join(t.TempDir(), "root.crt")
+	require.NoError(t, os.WriteFile(rootCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, rootCert
+}
+
+func TestUpstreamDialer(t *testing.T) {
+	cert, rootCert := generateCertificate(t)
+	cases := []struct {
+		casename     string
+		sslMode      string
+		sslRootCert  bool
+		serverCert   *tls.Certificate
+		sslRequested bool
+		expectedErr  bool
+		expectedTLS  bool
+	}{
+		{casename: "disable", sslMode: "disable", serverCert: cert, sslRequested: false},
+		{casename: "prefer with SSL", sslMode: "prefer", serverCert: cert, sslRequested: true, expectedTLS: true},
+		{casename: "prefer without SSL", sslMode: "prefer", sslRequested: true},
+		{casename: "verify-ca", sslMode: "verify-ca", sslRootCert: true, serverCert: cert, sslRequested: true, expectedTLS: true},
+		{casename: "verify-full", sslMode: "verify-full", sslRootCert: true, serverCert: cert, sslRequested: true, expectedTLS: true},
+		{casename: "verify-full by unknown CA", sslMode: "verify-full", serverCert: cert, sslRequested: true, expectedErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.casename, func(t *testing.T) {
+			cfg, sslRequested := startSSLUpstream(t, c.serverCert)
+			cfg.SSLMode = c.sslMode
+			if c.sslRootCert {
+				cfg.SSLRootCert = rootCert
+			}
+			dialer, err := psqlfront.NewUpstreamDialer(cfg)
+			require.NoError(t, err)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			conn, err := dialer.DialContext(ctx)
+			if c.expectedErr {
+				require.Error(t, err)
+				require.Equal(t, c.sslRequested, <-sslRequested)
+				return
+			}
+			require.NoError(t, err)
+			defer conn.Close()
+			_, isTLS := conn.(*tls.Conn)
+			require.Equal(t, c.expectedTLS, isTLS)
+			_, err = conn.Write((&pgproto3.StartupMessage{
+				ProtocolVersion: pgproto3.ProtocolVersionNumber,
+				Parameters:      map[string]string{"user": "postgres"},
+			}).Encode(nil))
+			require.NoError(t, err)
+			require.Equal(t, c.sslRequested, <-sslRequested)
+		})
+	}
+}
+
+func TestUpstreamDialerRequireWithoutSSL(t *testing.T) {
+	cfg, _ := startSSLUpstream(t, nil)
+	cfg.SSLMode = "require"
+	dialer, err := psqlfront.NewUpstreamDialer(cfg)
+	require.NoError(t, err)
+	_, err = dialer.DialContext(context.Background())
+	require.ErrorIs(t, err, psqlfront.ErrUpstreamSSLNotSupported)
+}